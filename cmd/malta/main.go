@@ -12,7 +12,9 @@ import (
 
 	"malta/internal"
 	"malta/internal/database/sqlite3"
+	"malta/internal/service"
 	"malta/internal/service/node"
+	"malta/internal/service/webhook"
 	"malta/internal/transport/http"
 )
 
@@ -64,14 +66,84 @@ type config struct {
 	Service struct {
 		Node struct {
 			Client struct {
-				TTL string `hcl:"ttl"`
+				TTL     string `hcl:"ttl"`
+				MinTTL  string `hcl:"min-ttl,optional"`
+				MaxTTL  string `hcl:"max-ttl,optional"`
+				Pending bool   `hcl:"pending,optional"`
 			} `hcl:"client,block"`
 			Health struct {
-				Concurrency int    `hcl:"concurrency"`
-				Interval    string `hcl:"interval"`
-				MaxFailures int    `hcl:"maxFailures"`
+				Concurrency      int     `hcl:"concurrency"`
+				Interval         string  `hcl:"interval"`
+				MaxFailures      int     `hcl:"maxFailures"`
+				SuccessThreshold int     `hcl:"success-threshold,optional"`
+				FailureWindow    int     `hcl:"failure-window,optional"`
+				FailureRatio     float64 `hcl:"failure-ratio,optional"`
+				Timeout          string  `hcl:"timeout,optional"`
+				GracePeriod      string  `hcl:"grace-period,optional"`
+				HistorySize      int     `hcl:"history-size,optional"`
+				Recovery         *struct {
+					Interval  string `hcl:"interval"`
+					Successes int    `hcl:"successes"`
+				} `hcl:"recovery,block"`
+				Exec *struct {
+					Command []string `hcl:"command"`
+				} `hcl:"exec,block"`
+				Status *struct {
+					Timeout string `hcl:"timeout"`
+				} `hcl:"status,block"`
+				HTTP *struct {
+					Path          string            `hcl:"path,optional"`
+					Method        string            `hcl:"method,optional"`
+					Statuses      []string          `hcl:"statuses,optional"`
+					Headers       map[string]string `hcl:"headers,optional"`
+					BodyRegex     string            `hcl:"body-regex,optional"`
+					BodyJSONPath  string            `hcl:"body-json-path,optional"`
+					BodyJSONValue string            `hcl:"body-json-value,optional"`
+					MaxBodySize   int64             `hcl:"max-body-size,optional"`
+				} `hcl:"http,block"`
+				HTTPClient *struct {
+					ConnectTimeout            string `hcl:"connect-timeout,optional"`
+					TLSHandshakeTimeout       string `hcl:"tls-handshake-timeout,optional"`
+					KeepAlive                 string `hcl:"keep-alive,optional"`
+					MaxIdleConnections        int    `hcl:"max-idle-connections,optional"`
+					MaxIdleConnectionsPerHost int    `hcl:"max-idle-connections-per-host,optional"`
+					IdleConnectionTimeout     string `hcl:"idle-connection-timeout,optional"`
+					Proxy                     string `hcl:"proxy,optional"`
+					TLS                       *struct {
+						CAFile             string `hcl:"ca-file,optional"`
+						CertFile           string `hcl:"cert-file,optional"`
+						KeyFile            string `hcl:"key-file,optional"`
+						ServerName         string `hcl:"server-name,optional"`
+						InsecureSkipVerify bool   `hcl:"insecure-skip-verify,optional"`
+					} `hcl:"tls,block"`
+				} `hcl:"http-client,block"`
 			} `hcl:"health,block"`
+			Reaper *struct {
+				Interval string `hcl:"interval"`
+			} `hcl:"reaper,block"`
+			Watch *struct {
+				BufferSize int `hcl:"buffer-size"`
+			} `hcl:"watch,block"`
+			Outbox *struct {
+				PollInterval string `hcl:"poll-interval,optional"`
+				Retention    string `hcl:"retention,optional"`
+			} `hcl:"outbox,block"`
+			Cluster *struct {
+				Observer           string `hcl:"observer"`
+				Quorum             int    `hcl:"quorum,optional"`
+				ObservationTimeout string `hcl:"observation-timeout,optional"`
+				SyncInterval       string `hcl:"sync-interval,optional"`
+			} `hcl:"cluster,block"`
 		} `hcl:"node,block"`
+		Webhook *struct {
+			Concurrency  int    `hcl:"concurrency,optional"`
+			Timeout      string `hcl:"timeout,optional"`
+			PollInterval string `hcl:"poll-interval,optional"`
+			MaxAttempts  int    `hcl:"max-attempts,optional"`
+			Backoff      string `hcl:"backoff,optional"`
+			MaxBackoff   string `hcl:"max-backoff,optional"`
+			LogSize      int    `hcl:"log-size,optional"`
+		} `hcl:"webhook,block"`
 	} `hcl:"service,block"`
 	Database struct {
 		SQLite3 struct {
@@ -79,6 +151,7 @@ type config struct {
 			MaxOpenConnections int    `hcl:"max-open-connections,optional"`
 			MaxIdleConnections int    `hcl:"max-idle-connections,optional"`
 			ConnectionLifetime string `hcl:"connection-lifetime,optional"`
+			BusyTimeout        string `hcl:"busy-timeout,optional"`
 		} `hcl:"sqlite3,block"`
 	} `hcl:"database,block"`
 }
@@ -110,6 +183,98 @@ func parseConfig(path string, logger zerolog.Logger) (internal.ClientConfig, err
 	}
 
 	duration := parseTimeDuration(logger)
+
+	health := node.HealthConfig{
+		Interval:         duration(cfg.Service.Node.Health.Interval),
+		Concurrency:      cfg.Service.Node.Health.Concurrency,
+		MaxFailures:      cfg.Service.Node.Health.MaxFailures,
+		SuccessThreshold: cfg.Service.Node.Health.SuccessThreshold,
+		FailureWindow:    cfg.Service.Node.Health.FailureWindow,
+		FailureRatio:     cfg.Service.Node.Health.FailureRatio,
+		Timeout:          duration(cfg.Service.Node.Health.Timeout),
+		GracePeriod:      duration(cfg.Service.Node.Health.GracePeriod),
+		HistorySize:      cfg.Service.Node.Health.HistorySize,
+	}
+	if recovery := cfg.Service.Node.Health.Recovery; recovery != nil {
+		health.RecoveryInterval = duration(recovery.Interval)
+		health.RecoverySuccesses = recovery.Successes
+	}
+
+	var checker internal.ClientConfigServiceNodeChecker
+	if exec := cfg.Service.Node.Health.Exec; exec != nil {
+		checker.Exec.Command = exec.Command
+	}
+	if status := cfg.Service.Node.Health.Status; status != nil {
+		checker.Status.Timeout = duration(status.Timeout)
+	}
+	if httpChecker := cfg.Service.Node.Health.HTTP; httpChecker != nil {
+		checker.HTTP.Options = service.NodeCheckHTTP{
+			Path:          httpChecker.Path,
+			Method:        httpChecker.Method,
+			Statuses:      httpChecker.Statuses,
+			Headers:       httpChecker.Headers,
+			BodyRegex:     httpChecker.BodyRegex,
+			BodyJSONPath:  httpChecker.BodyJSONPath,
+			BodyJSONValue: httpChecker.BodyJSONValue,
+		}
+		checker.HTTP.MaxBodySize = httpChecker.MaxBodySize
+	}
+	if httpClient := cfg.Service.Node.Health.HTTPClient; httpClient != nil {
+		checker.HTTP.ClientConfig = node.HTTPClientConfig{
+			ConnectTimeout:            duration(httpClient.ConnectTimeout),
+			TLSHandshakeTimeout:       duration(httpClient.TLSHandshakeTimeout),
+			KeepAlive:                 duration(httpClient.KeepAlive),
+			MaxIdleConnections:        httpClient.MaxIdleConnections,
+			MaxIdleConnectionsPerHost: httpClient.MaxIdleConnectionsPerHost,
+			IdleConnectionTimeout:     duration(httpClient.IdleConnectionTimeout),
+			Proxy:                     httpClient.Proxy,
+		}
+		if tls := httpClient.TLS; tls != nil {
+			checker.HTTP.ClientConfig.TLS = node.HTTPClientTLSConfig{
+				CAFile:             tls.CAFile,
+				CertFile:           tls.CertFile,
+				KeyFile:            tls.KeyFile,
+				ServerName:         tls.ServerName,
+				InsecureSkipVerify: tls.InsecureSkipVerify,
+			}
+		}
+	}
+
+	var reaper node.ReaperConfig
+	if cfg.Service.Node.Reaper != nil {
+		reaper.Interval = duration(cfg.Service.Node.Reaper.Interval)
+	}
+
+	var watcher node.WatcherConfig
+	if cfg.Service.Node.Watch != nil {
+		watcher.BufferSize = cfg.Service.Node.Watch.BufferSize
+	}
+
+	var outbox node.OutboxConfig
+	if cfg.Service.Node.Outbox != nil {
+		outbox.PollInterval = duration(cfg.Service.Node.Outbox.PollInterval)
+		outbox.Retention = duration(cfg.Service.Node.Outbox.Retention)
+	}
+
+	var manager node.ManagerConfig
+	if cluster := cfg.Service.Node.Cluster; cluster != nil {
+		manager.SyncInterval = duration(cluster.SyncInterval)
+		health.ObserverID = cluster.Observer
+		health.Quorum = cluster.Quorum
+		health.ObservationTimeout = duration(cluster.ObservationTimeout)
+	}
+
+	var dispatcher webhook.DispatcherConfig
+	if cfg.Service.Webhook != nil {
+		dispatcher.Concurrency = cfg.Service.Webhook.Concurrency
+		dispatcher.Timeout = duration(cfg.Service.Webhook.Timeout)
+		dispatcher.PollInterval = duration(cfg.Service.Webhook.PollInterval)
+		dispatcher.MaxAttempts = cfg.Service.Webhook.MaxAttempts
+		dispatcher.Backoff = duration(cfg.Service.Webhook.Backoff)
+		dispatcher.MaxBackoff = duration(cfg.Service.Webhook.MaxBackoff)
+		dispatcher.LogSize = cfg.Service.Webhook.LogSize
+	}
+
 	return internal.ClientConfig{
 		Transport: internal.ClientConfigTransport{
 			HTTP: http.ServerConfig{
@@ -119,15 +284,20 @@ func parseConfig(path string, logger zerolog.Logger) (internal.ClientConfig, err
 		},
 		Service: internal.ClientConfigService{
 			Node: internal.ClientConfigServiceNode{
+				Manager: manager,
+				Outbox:  outbox,
 				Client: node.ClientConfig{
-					TTL: duration(cfg.Service.Node.Client.TTL),
-				},
-				Health: node.HealthConfig{
-					Interval:    duration(cfg.Service.Node.Health.Interval),
-					Concurrency: cfg.Service.Node.Health.Concurrency,
-					MaxFailures: cfg.Service.Node.Health.MaxFailures,
+					TTL:     duration(cfg.Service.Node.Client.TTL),
+					MinTTL:  duration(cfg.Service.Node.Client.MinTTL),
+					MaxTTL:  duration(cfg.Service.Node.Client.MaxTTL),
+					Pending: cfg.Service.Node.Client.Pending,
 				},
+				Health:  health,
+				Reaper:  reaper,
+				Watcher: watcher,
+				Checker: checker,
 			},
+			Webhook: dispatcher,
 		},
 		Database: internal.ClientConfigDatabase{
 			SQLite3: sqlite3.ClientConfig{
@@ -135,6 +305,7 @@ func parseConfig(path string, logger zerolog.Logger) (internal.ClientConfig, err
 				MaxOpenConnections: cfg.Database.SQLite3.MaxOpenConnections,
 				MaxIdleConnections: cfg.Database.SQLite3.MaxIdleConnections,
 				ConnectionLifetime: duration(cfg.Database.SQLite3.ConnectionLifetime),
+				BusyTimeout:        duration(cfg.Database.SQLite3.BusyTimeout),
 			},
 		},
 	}, nil
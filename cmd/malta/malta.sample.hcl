@@ -8,14 +8,92 @@ transport {
 service {
   node {
     client {
-      ttl = "20s"
+      ttl     = "20s"
+      min-ttl = "5s"
+      max-ttl = "1h"
+      pending = false
     }
 
     health {
-      concurrency = 10
-      interval    = "10s"
-      maxFailures = 6
+      concurrency       = 10
+      interval          = "10s"
+      maxFailures       = 6
+      success-threshold = 3
+      failure-window    = 20
+      failure-ratio     = 0.5
+      timeout           = "5s"
+      grace-period      = "30s"
+      history-size      = 1000
+
+      recovery {
+        interval  = "30s"
+        successes = 3
+      }
+
+      exec {
+        command = ["/usr/local/bin/check-node"]
+      }
+
+      status {
+        timeout = "1m"
+      }
+
+      http {
+        path            = "/health"
+        method          = "GET"
+        statuses        = ["200-299"]
+        headers         = { "Authorization" = "Bearer token" }
+        body-json-path  = "$.status"
+        body-json-value = "ok"
+        max-body-size   = 65536
+      }
+
+      http-client {
+        connect-timeout               = "2s"
+        tls-handshake-timeout         = "2s"
+        keep-alive                    = "30s"
+        max-idle-connections          = 100
+        max-idle-connections-per-host = 2
+        idle-connection-timeout       = "90s"
+
+        tls {
+          ca-file     = "/etc/malta/ca.pem"
+          cert-file   = "/etc/malta/client.pem"
+          key-file    = "/etc/malta/client-key.pem"
+          server-name = "node.malta.internal"
+        }
+      }
+    }
+
+    reaper {
+      interval = "5s"
     }
+
+    watch {
+      buffer-size = 1000
+    }
+
+    outbox {
+      poll-interval = "1s"
+      retention     = "1h"
+    }
+
+    cluster {
+      observer            = "malta-1"
+      quorum              = 1
+      observation-timeout = "1m"
+      sync-interval       = "5s"
+    }
+  }
+
+  webhook {
+    concurrency   = 4
+    timeout       = "10s"
+    poll-interval = "1s"
+    max-attempts  = 10
+    backoff       = "1s"
+    max-backoff   = "1h"
+    log-size      = 1000
   }
 }
 
@@ -25,5 +103,6 @@ database {
     max-open-connections = 100
     max-idle-connections = 100
     connection-lifetime  = "2m"
+    busy-timeout         = "5s"
   }
 }
@@ -3,6 +3,7 @@ package internal
 import (
 	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
 
 	"github.com/go-chi/chi"
@@ -12,6 +13,7 @@ import (
 	"malta/internal/database/sqlite3"
 	"malta/internal/service"
 	"malta/internal/service/node"
+	"malta/internal/service/webhook"
 	transportHTTP "malta/internal/transport/http"
 )
 
@@ -25,15 +27,30 @@ type ClientConfigTransport struct {
 	HTTP transportHTTP.ServerConfig
 }
 
+// ClientConfigServiceNodeChecker used to configure the checkers available to the node health.
+type ClientConfigServiceNodeChecker struct {
+	HTTP   node.HTTPChecker
+	TCP    node.TCPChecker
+	Exec   node.ExecChecker
+	GRPC   node.GRPCChecker
+	Status node.StatusChecker
+}
+
 // ClientConfigServiceNode used to configure the internal node service state.
 type ClientConfigServiceNode struct {
-	Client node.ClientConfig
-	Health node.HealthConfig
+	Manager node.ManagerConfig
+	Outbox  node.OutboxConfig
+	Client  node.ClientConfig
+	Health  node.HealthConfig
+	Reaper  node.ReaperConfig
+	Watcher node.WatcherConfig
+	Checker ClientConfigServiceNodeChecker
 }
 
 // ClientConfigService used to configure the internal service state.
 type ClientConfigService struct {
-	Node ClientConfigServiceNode
+	Node    ClientConfigServiceNode
+	Webhook webhook.DispatcherConfig
 }
 
 // ClientConfig used to configure the internal state.
@@ -49,8 +66,14 @@ type Client struct {
 	Config ClientConfig
 
 	service struct {
-		node       node.Client
-		nodeHealth node.Health
+		node        node.Client
+		nodeManager node.Manager
+		nodeOutbox  node.Outbox
+		nodeHealth  node.Health
+		nodeReaper  node.Reaper
+		nodeWatcher node.Watcher
+		webhook     webhook.Client
+		dispatcher  webhook.Dispatcher
 	}
 
 	transport struct {
@@ -59,9 +82,17 @@ type Client struct {
 
 	database struct {
 		sqlite3 struct {
-			client    sqlite3.Client
-			node      sqlite3.Node
-			nodeCheck sqlite3.NodeCheck
+			client      sqlite3.Client
+			node        sqlite3.Node
+			nodeCheck   sqlite3.NodeCheck
+			history     sqlite3.NodeCheckHistory
+			status      sqlite3.NodeStatus
+			observation sqlite3.NodeObservation
+			outbox      sqlite3.NodeOutbox
+			event       sqlite3.NodeEvent
+			allocation  sqlite3.NodeAllocation
+			webhook     sqlite3.Webhook
+			delivery    sqlite3.WebhookDelivery
 		}
 	}
 }
@@ -70,41 +101,136 @@ type Client struct {
 func (c *Client) Init() error {
 	c.database.sqlite3.node.Client = &c.database.sqlite3.client
 	c.database.sqlite3.nodeCheck.Client = &c.database.sqlite3.client
+	c.database.sqlite3.history.Client = &c.database.sqlite3.client
+	c.database.sqlite3.status.Client = &c.database.sqlite3.client
+	c.database.sqlite3.observation.Client = &c.database.sqlite3.client
+	c.database.sqlite3.outbox.Client = &c.database.sqlite3.client
+	c.database.sqlite3.event.Client = &c.database.sqlite3.client
+	c.database.sqlite3.allocation.Client = &c.database.sqlite3.client
+	c.database.sqlite3.webhook.Client = &c.database.sqlite3.client
+	c.database.sqlite3.delivery.Client = &c.database.sqlite3.client
 	c.database.sqlite3.client.Config = c.Config.Database.SQLite3
 	c.database.sqlite3.client.Config.ClientLifecycleHook = append(
 		c.database.sqlite3.client.Config.ClientLifecycleHook,
 		&c.database.sqlite3.node,
 		&c.database.sqlite3.nodeCheck,
+		&c.database.sqlite3.history,
+		&c.database.sqlite3.status,
+		&c.database.sqlite3.observation,
+		&c.database.sqlite3.outbox,
+		&c.database.sqlite3.event,
+		&c.database.sqlite3.allocation,
+		&c.database.sqlite3.webhook,
+		&c.database.sqlite3.delivery,
 	)
 	if err := c.database.sqlite3.client.Init(); err != nil {
 		return fmt.Errorf("failed to initialize sqlite3 client: %w", err)
 	}
 
+	c.service.nodeOutbox.Config = c.Config.Service.Node.Outbox
+	c.service.nodeOutbox.Config.Repository = &c.database.sqlite3.outbox
+	c.service.nodeOutbox.Config.Logger = c.Config.Logger
+	if err := c.service.nodeOutbox.Init(); err != nil {
+		return fmt.Errorf("failed to initialize the node outbox: %w", err)
+	}
+
+	c.service.nodeManager.Config = c.Config.Service.Node.Manager
+	c.service.nodeManager.Config.Repository = &c.database.sqlite3.node
+	c.service.nodeManager.Config.OutboxRepository = &c.database.sqlite3.outbox
+	c.service.nodeManager.Config.AuditRepository = &c.database.sqlite3.event
+	c.service.nodeManager.Config.Outbox = &c.service.nodeOutbox
+	c.service.nodeManager.Config.Transaction = &c.database.sqlite3.client
+	c.service.nodeManager.Config.TransactionHandler = database.TransactionHandler(c.Config.Logger)
+	c.service.nodeManager.Config.Logger = c.Config.Logger
+	if err := c.service.nodeManager.Init(); err != nil {
+		return fmt.Errorf("failed to initialize the node manager: %w", err)
+	}
+
 	c.service.node.Config = c.Config.Service.Node.Client
-	c.service.node.Notification = &c.service.nodeHealth
+	c.service.node.Manager = &c.service.nodeManager
+	c.service.node.Health = &c.service.nodeHealth
+	c.service.node.AuditRepository = &c.database.sqlite3.event
+	c.service.node.AllocationRepository = &c.database.sqlite3.allocation
 	c.service.node.Repository = &c.database.sqlite3.node
+	c.service.node.HistoryRepository = &c.database.sqlite3.history
+	c.service.node.StatusRepository = &c.database.sqlite3.status
+	c.service.node.ObservationRepository = &c.database.sqlite3.observation
 	c.service.node.Transaction = &c.database.sqlite3.client
 	c.service.node.TransactionHandler = database.TransactionHandler(c.Config.Logger)
 
+	if err := node.ValidateHTTPCheck(c.Config.Service.Node.Checker.HTTP.Options); err != nil {
+		return fmt.Errorf("invalid http checker configuration: %w", err)
+	}
 	c.service.nodeHealth.Config = c.Config.Service.Node.Health
 	c.service.nodeHealth.Config.CheckRepository = &c.database.sqlite3.nodeCheck
-	c.service.nodeHealth.Config.Repository = &c.database.sqlite3.node
+	c.service.nodeHealth.Config.HistoryRepository = &c.database.sqlite3.history
+	c.service.nodeHealth.Config.ObservationRepository = &c.database.sqlite3.observation
+	c.service.nodeHealth.Config.Manager = &c.service.nodeManager
 	c.service.nodeHealth.Config.Logger = c.Config.Logger
-	c.service.nodeHealth.Config.HTTPClient = http.DefaultClient
+	if err := c.Config.Service.Node.Checker.HTTP.Init(); err != nil {
+		return fmt.Errorf("http checker initialization error: %w", err)
+	}
+	c.service.nodeHealth.Config.Checkers = c.checkers()
+	c.service.node.Checkers = c.service.nodeHealth.Config.Checkers
+
+	c.service.nodeReaper.Config = c.Config.Service.Node.Reaper
+	c.service.nodeReaper.Config.Repository = &c.database.sqlite3.node
+	c.service.nodeReaper.Config.Manager = &c.service.nodeManager
+	c.service.nodeReaper.Config.Logger = c.Config.Logger
+
+	c.service.nodeWatcher.Config = c.Config.Service.Node.Watcher
+	c.service.nodeWatcher.Config.Manager = &c.service.nodeManager
+	if err := c.service.nodeWatcher.Init(); err != nil {
+		return fmt.Errorf("failed to initialize the node watcher: %w", err)
+	}
+
+	c.service.webhook.Repository = &c.database.sqlite3.webhook
+	c.service.webhook.DeliveryRepository = &c.database.sqlite3.delivery
+	c.service.webhook.Transaction = &c.database.sqlite3.client
+	c.service.webhook.TransactionHandler = database.TransactionHandler(c.Config.Logger)
+
+	c.service.dispatcher.Config = c.Config.Service.Webhook
+	c.service.dispatcher.Config.Outbox = &c.service.nodeOutbox
+	c.service.dispatcher.Config.Repository = &c.database.sqlite3.webhook
+	c.service.dispatcher.Config.DeliveryRepository = &c.database.sqlite3.delivery
+	c.service.dispatcher.Config.Logger = c.Config.Logger
+	if err := c.service.dispatcher.Init(); err != nil {
+		return fmt.Errorf("failed to initialize the webhook dispatcher: %w", err)
+	}
 
 	c.transport.http = transportHTTP.Server{Config: c.Config.Transport.HTTP}
 	c.transport.http.Config.Handler.Node.Repository = &c.service.node
+	c.transport.http.Config.Handler.Node.Watcher = &c.service.nodeWatcher
 	c.transport.http.Config.Handler.Node.ResourceAddress = func(node service.Node) string {
-		return fmt.Sprintf(
-			"http://%s:%d/nodes/%d",
-			c.transport.http.Config.Address,
-			c.transport.http.Config.Port,
-			node.ID,
-		)
+		return fmt.Sprintf("%s/nodes/%d", c.transport.http.Address(), node.ID)
+	}
+	c.transport.http.Config.Handler.Node.IndexAddress = func(query url.Values) string {
+		return fmt.Sprintf("%s/nodes?%s", c.transport.http.Address(), query.Encode())
 	}
 	c.transport.http.Config.Handler.Node.ResourceID = func(r *http.Request) string {
 		return chi.URLParam(r, "id")
 	}
+	c.transport.http.Config.Handler.Node.AllocationID = func(r *http.Request) string {
+		return chi.URLParam(r, "allocation")
+	}
+	c.transport.http.Config.Handler.Cluster.Repository = &c.service.node
+	c.transport.http.Config.Handler.Event.Repository = &c.service.node
+	c.transport.http.Config.Handler.Event.IndexAddress = func(query url.Values) string {
+		return fmt.Sprintf("%s/events?%s", c.transport.http.Address(), query.Encode())
+	}
+	c.transport.http.Config.Handler.Event.NodeIndexAddress = func(id string, query url.Values) string {
+		return fmt.Sprintf("%s/nodes/%s/events?%s", c.transport.http.Address(), id, query.Encode())
+	}
+	c.transport.http.Config.Handler.Event.ResourceID = func(r *http.Request) string {
+		return chi.URLParam(r, "id")
+	}
+	c.transport.http.Config.Handler.Webhook.Repository = &c.service.webhook
+	c.transport.http.Config.Handler.Webhook.ResourceAddress = func(webhook service.Webhook) string {
+		return fmt.Sprintf("%s/webhooks/%d", c.transport.http.Address(), webhook.ID)
+	}
+	c.transport.http.Config.Handler.Webhook.ResourceID = func(r *http.Request) string {
+		return chi.URLParam(r, "id")
+	}
 	c.transport.http.Config.Logger = c.Config.Logger
 	if err := c.transport.http.Init(); err != nil {
 		return fmt.Errorf("http transport initialization error: %w", err)
@@ -113,6 +239,21 @@ func (c *Client) Init() error {
 	return nil
 }
 
+func (c *Client) checkers() map[service.NodeCheckType]node.Checker {
+	checker := &c.Config.Service.Node.Checker
+	checker.Status.Repository = &c.database.sqlite3.status
+	checkers := map[service.NodeCheckType]node.Checker{
+		service.NodeCheckTypeHTTP:   &checker.HTTP,
+		service.NodeCheckTypeTCP:    &checker.TCP,
+		service.NodeCheckTypeGRPC:   &checker.GRPC,
+		service.NodeCheckTypeStatus: &checker.Status,
+	}
+	if len(checker.Exec.Command) > 0 {
+		checkers[service.NodeCheckTypeExec] = &checker.Exec
+	}
+	return checkers
+}
+
 // Start the application.
 func (c *Client) Start() error {
 	c.Config.Logger.Info().Msg("Starting application")
@@ -121,10 +262,30 @@ func (c *Client) Start() error {
 		return fmt.Errorf("failed to start sqlite3 database: %w", err)
 	}
 
+	if err := c.service.nodeManager.Start(); err != nil {
+		return fmt.Errorf("failed to start the node manager: %w", err)
+	}
+
+	if err := c.service.nodeOutbox.Start(); err != nil {
+		return fmt.Errorf("failed to start the node outbox: %w", err)
+	}
+
+	if err := c.service.nodeWatcher.Start(); err != nil {
+		return fmt.Errorf("failed to start the node watcher: %w", err)
+	}
+
+	if err := c.service.dispatcher.Start(); err != nil {
+		return fmt.Errorf("failed to start the webhook dispatcher: %w", err)
+	}
+
 	if err := c.service.nodeHealth.Start(); err != nil {
 		return fmt.Errorf("failed to start the node health service: %w", err)
 	}
 
+	if err := c.service.nodeReaper.Start(); err != nil {
+		return fmt.Errorf("failed to start the node reaper service: %w", err)
+	}
+
 	c.transport.http.Start()
 	c.Config.Logger.Info().Msg("Application started")
 	return nil
@@ -133,7 +294,12 @@ func (c *Client) Start() error {
 // Stop the application.
 func (c *Client) Stop() error {
 	var errs []error
+	c.service.nodeReaper.Stop()
 	c.service.nodeHealth.Stop()
+	c.service.dispatcher.Stop()
+	c.service.nodeWatcher.Stop()
+	c.service.nodeOutbox.Stop()
+	c.service.nodeManager.Stop()
 
 	c.Config.Logger.Info().Msg("Stopping application")
 	if err := c.transport.http.Stop(); err != nil {
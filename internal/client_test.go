@@ -0,0 +1,258 @@
+//go:build sqlite_json
+// +build sqlite_json
+
+package internal
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"malta/internal/database/sqlite3"
+	"malta/internal/service"
+	"malta/internal/service/node"
+)
+
+// TestClientQuorum runs the observers as clients sharing the database, each one sees the node
+// through its own checker.
+func TestClientQuorum(t *testing.T) {
+	dir, err := ioutil.TempDir("", "malta")
+	if err != nil {
+		t.Fatalf("failed to create the database directory: %s", err)
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+
+	file := filepath.Join(dir, "malta.sqlite3")
+	var observers []*testObserver
+	for i := 1; i <= 3; i++ {
+		observer := newTestObserver(t, file, fmt.Sprintf("observer-%d", i))
+		defer observer.stop(t)
+		observers = append(observers, observer)
+	}
+
+	ctx := context.Background()
+	created, _, err := observers[0].client.service.node.Create(
+		ctx, service.Node{Address: "http://node"},
+	)
+	if err != nil {
+		t.Fatalf("failed to create the node: %s", err)
+	}
+
+	// A single dissenter sees the node as unhealthy, but it's not enough to disable the node.
+	observers[2].fail()
+	waitFor(t, "the dissenter to see the node as unhealthy", func() bool {
+		return observers[0].observed(t, created.ID, "observer-3") == service.NodeHealthUnhealthy
+	})
+	checks := []int64{observers[0].checked(), observers[1].checked()}
+	waitFor(t, "the other observers to check the node", func() bool {
+		for _, observer := range observers {
+			if current := observer.node(t, created.ID); !current.Active {
+				t.Fatalf(
+					"expected the node to be active at '%s', got the health '%s'",
+					observer.id, current.Health,
+				)
+			}
+		}
+		return observers[0].checked() >= checks[0]+5 && observers[1].checked() >= checks[1]+5
+	})
+
+	// A second observer sees the node as unhealthy and the quorum disables it.
+	observers[1].fail()
+	waitFor(t, "the quorum to disable the node", func() bool {
+		for _, observer := range observers {
+			current := observer.node(t, created.ID)
+			if current.Active || current.Health != service.NodeHealthUnhealthy {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// TestClientConcurrentChanges runs two clients sharing the database, the changes made at the same
+// time by both to the same node are all kept.
+func TestClientConcurrentChanges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "malta")
+	if err != nil {
+		t.Fatalf("failed to create the database directory: %s", err)
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+
+	file := filepath.Join(dir, "malta.sqlite3")
+	var observers []*testObserver
+	for i := 1; i <= 2; i++ {
+		observer := newTestObserver(t, file, fmt.Sprintf("observer-%d", i))
+		defer observer.stop(t)
+		observers = append(observers, observer)
+	}
+
+	// The node is found at the other client before the outbox delivers it.
+	ctx := context.Background()
+	created, _, err := observers[0].client.service.node.Create(
+		ctx, service.Node{Address: "http://node"},
+	)
+	if err != nil {
+		t.Fatalf("failed to create the node: %s", err)
+	}
+	id := strconv.Itoa(created.ID)
+	if _, err := observers[1].client.service.node.FindOne(ctx, id); err != nil {
+		t.Fatalf("failed to find the node at the other client: %s", err)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		failures = make(chan error, 40)
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			client := &observers[i%2].client.service.node
+			value := strconv.Itoa(i)
+			patch := service.NodePatch{Metadata: map[string]*string{value: &value}}
+			if _, err := client.Update(ctx, id, patch); err != nil {
+				failures <- fmt.Errorf("failed to update the node: %w", err)
+			}
+			if _, err := client.Heartbeat(ctx, id); err != nil {
+				failures <- fmt.Errorf("failed to renew the lease: %w", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(failures)
+	for err := range failures {
+		t.Error(err)
+	}
+
+	current, err := observers[1].client.service.node.FindOne(ctx, id)
+	if err != nil {
+		t.Fatalf("failed to find the node: %s", err)
+	}
+	if len(current.Metadata) != 20 {
+		t.Errorf("expected the metadata of every update, got %v", current.Metadata)
+	}
+}
+
+type testObserver struct {
+	id      string
+	client  Client
+	failing int32
+	checks  int64
+}
+
+func newTestObserver(t *testing.T, file, id string) *testObserver {
+	t.Helper()
+	observer := &testObserver{id: id}
+	observer.client.Config = ClientConfig{
+		Transport: ClientConfigTransport{},
+		Service: ClientConfigService{
+			Node: ClientConfigServiceNode{
+				Manager: node.ManagerConfig{SyncInterval: 100 * time.Millisecond},
+				Outbox:  node.OutboxConfig{PollInterval: 20 * time.Millisecond},
+				Health: node.HealthConfig{
+					Interval:           20 * time.Millisecond,
+					ObserverID:         id,
+					Quorum:             2,
+					ObservationTimeout: 5 * time.Second,
+					MaxFailures:        2,
+					Timeout:            time.Second,
+				},
+				Checker: ClientConfigServiceNodeChecker{
+					HTTP: node.HTTPChecker{Client: &http.Client{Transport: observer}},
+				},
+			},
+		},
+		Database: ClientConfigDatabase{
+			SQLite3: sqlite3.ClientConfig{DatabaseFile: file},
+		},
+		Logger: zerolog.Nop(),
+	}
+	observer.client.Config.Transport.HTTP.Address = "127.0.0.1"
+	observer.client.Config.Transport.HTTP.AsyncErrorHandler = func(error) {}
+
+	if err := observer.client.Init(); err != nil {
+		t.Fatalf("failed to initialize '%s': %s", id, err)
+	}
+	if err := observer.client.Start(); err != nil {
+		t.Fatalf("failed to start '%s': %s", id, err)
+	}
+	return observer
+}
+
+// RoundTrip answers the checks of the observer, the node is failing only to this observer.
+func (o *testObserver) RoundTrip(*http.Request) (*http.Response, error) {
+	atomic.AddInt64(&o.checks, 1)
+	status := http.StatusOK
+	if atomic.LoadInt32(&o.failing) == 1 {
+		status = http.StatusServiceUnavailable
+	}
+	return &http.Response{
+		StatusCode: status,
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+	}, nil
+}
+
+func (o *testObserver) fail() {
+	atomic.StoreInt32(&o.failing, 1)
+}
+
+func (o *testObserver) checked() int64 {
+	return atomic.LoadInt64(&o.checks)
+}
+
+func (o *testObserver) node(t *testing.T, id int) service.Node {
+	t.Helper()
+	nodes, _ := o.client.service.nodeManager.Snapshot()
+	for _, n := range nodes {
+		if n.ID == id {
+			return n
+		}
+	}
+	t.Fatalf("node '%d' not found at '%s'", id, o.id)
+	return service.Node{}
+}
+
+func (o *testObserver) observed(t *testing.T, id int, observerID string) service.NodeHealth {
+	t.Helper()
+	observations, err := o.client.database.sqlite3.observation.Select(
+		context.Background(), id, time.Time{},
+	)
+	if err != nil {
+		t.Fatalf("failed to fetch the observations: %s", err)
+	}
+	for _, observation := range observations {
+		if observation.ObserverID == observerID {
+			return observation.Health
+		}
+	}
+	return ""
+}
+
+func (o *testObserver) stop(t *testing.T) {
+	t.Helper()
+	if err := o.client.Stop(); err != nil {
+		t.Errorf("failed to stop '%s': %s", o.id, err)
+	}
+}
+
+func waitFor(t *testing.T, description string, fn func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !fn() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", description)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
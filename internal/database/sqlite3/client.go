@@ -14,6 +14,8 @@ import (
 	"malta/internal/database/sqlite3/migration"
 )
 
+const defaultBusyTimeout = 5 * time.Second
+
 // ClientLifecycleHook is used during the start an stop of the client.
 type ClientLifecycleHook interface {
 	open() error
@@ -32,6 +34,10 @@ type ClientConfig struct {
 	MaxOpenConnections int
 	MaxIdleConnections int
 	ConnectionLifetime time.Duration
+
+	// BusyTimeout is how long a connection waits for the database to be unlocked by the other
+	// connections and servers before failing. The default is 5 seconds.
+	BusyTimeout time.Duration
 }
 
 // Client used to access the SQLite3.
@@ -50,7 +56,16 @@ func (c *Client) Init() error {
 
 // Start the client.
 func (c *Client) Start() (err error) {
-	path := fmt.Sprintf("%s?_journal=wal", c.Config.DatabaseFile)
+	busyTimeout := c.Config.BusyTimeout
+	if busyTimeout <= 0 {
+		busyTimeout = defaultBusyTimeout
+	}
+	// The transactions take the write lock as they begin, otherwise a transaction that reads before
+	// writing fails right away once another one commits in between, the busy timeout doesn't apply.
+	path := fmt.Sprintf(
+		"%s?_journal=wal&_txlock=immediate&_busy_timeout=%d",
+		c.Config.DatabaseFile, busyTimeout.Milliseconds(),
+	)
 	c.instance, err = sql.Open("sqlite3", path)
 	if err != nil {
 		return fmt.Errorf("failed to start sqlite3: %w", err)
@@ -89,10 +104,14 @@ func (c *Client) Stop() error {
 func (c *Client) Begin(
 	ctx context.Context, readOnly bool, level sql.IsolationLevel,
 ) (*sql.Tx, error) {
-	return c.instance.BeginTx(ctx, &sql.TxOptions{
+	tx, err := c.instance.BeginTx(ctx, &sql.TxOptions{
 		Isolation: level,
 		ReadOnly:  readOnly,
 	})
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return tx, nil
 }
 
 func (c *Client) execMigration() (err error) {
@@ -107,7 +126,9 @@ func (c *Client) execMigration() (err error) {
 		return fmt.Errorf("failed to create the sqlite3 driver to migrate: %w", err)
 	}
 
-	m, err := migrate.NewWithDatabaseInstance("static://malta", "malta", driver)
+	// The source is given as an instance instead of being registered, the registry is global and
+	// doesn't allow more than one client at the same process.
+	m, err := migrate.NewWithInstance("static", &mm, "malta", driver)
 	if err != nil {
 		return fmt.Errorf("failed to create the migration instance: %w", err)
 	}
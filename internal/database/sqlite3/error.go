@@ -0,0 +1,44 @@
+package sqlite3
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	driverSqlite3 "github.com/mattn/go-sqlite3"
+
+	"malta/internal/service"
+)
+
+// wrapError classify the database errors into service errors.
+func wrapError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return service.Error{Kind: service.ErrorKindNotFound, Err: err}
+	}
+
+	var serr driverSqlite3.Error
+	if !errors.As(err, &serr) {
+		return err
+	}
+	switch serr.Code {
+	case driverSqlite3.ErrConstraint:
+		return service.Error{Kind: service.ErrorKindConflict, Err: err}
+	case driverSqlite3.ErrBusy, driverSqlite3.ErrLocked:
+		return service.Error{Kind: service.ErrorKindUnavailable, Err: err}
+	default:
+		return err
+	}
+}
+
+// errAffectedRows is used when a single row was expected to be affected.
+func errAffectedRows(affectedRows int64) error {
+	err := fmt.Errorf("expected one row to be affected but '%d' was", affectedRows)
+	if affectedRows == 0 {
+		return service.Error{Kind: service.ErrorKindNotFound, Err: err}
+	}
+	return err
+}
@@ -17,8 +17,26 @@ type Manager struct {
 
 // Init internal state.
 func (m *Manager) Init() {
-	m.revisions = []revision{revision0{}}
-	source.Register("static", m)
+	m.revisions = []revision{
+		revision0{},
+		revision1{},
+		revision2{},
+		revision3{},
+		revision4{},
+		revision5{},
+		revision6{},
+		revision7{},
+		revision8{},
+		revision9{},
+		revision10{},
+		revision11{},
+		revision12{},
+		revision13{},
+		revision14{},
+		revision15{},
+		revision16{},
+		revision17{},
+	}
 }
 
 // Open is not used, it's here just to fulfill the source.Driver interface.
@@ -0,0 +1,39 @@
+package migration
+
+type revision1 struct{}
+
+func (revision1) name() string {
+	return "Revision 1"
+}
+
+func (revision1) version() uint {
+	return 1
+}
+
+func (revision1) up() (string, error) {
+	return `
+		ALTER TABLE node ADD COLUMN last_seen DATETIME;
+		ALTER TABLE node ADD COLUMN expires_at DATETIME;
+		UPDATE node SET last_seen = created_at;
+		UPDATE node
+		   SET expires_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now', (ttl / 1000000000) || ' seconds')
+		 WHERE active = true AND ttl > 0;
+	`, nil
+}
+
+func (revision1) down() (string, error) {
+	return `
+		CREATE TABLE node_revision0 (
+			id         INTEGER PRIMARY KEY AUTOINCREMENT,
+			address    TEXT NOT NULL,
+			metadata   JSON,
+			ttl        INTEGER NOT NULL,
+			active     BOOL NOT NULL,
+			created_at DATETIME NOT NULL
+		);
+		INSERT INTO node_revision0 (id, address, metadata, ttl, active, created_at)
+		     SELECT id, address, metadata, ttl, active, created_at FROM node;
+		DROP TABLE node;
+		ALTER TABLE node_revision0 RENAME TO node;
+	`, nil
+}
@@ -0,0 +1,31 @@
+package migration
+
+type revision10 struct{}
+
+func (revision10) name() string {
+	return "Revision 10"
+}
+
+func (revision10) version() uint {
+	return 10
+}
+
+func (revision10) up() (string, error) {
+	return `
+		CREATE TABLE node_status (
+			node_id     INTEGER PRIMARY KEY,
+			status      TEXT NOT NULL,
+			components  JSON,
+			gauges      JSON,
+			reported_at DATETIME NOT NULL,
+
+			FOREIGN KEY(node_id) REFERENCES node(id)
+		);
+	`, nil
+}
+
+func (revision10) down() (string, error) {
+	return `
+		DROP TABLE node_status;
+	`, nil
+}
@@ -0,0 +1,82 @@
+package migration
+
+type revision11 struct{}
+
+func (revision11) name() string {
+	return "Revision 11"
+}
+
+func (revision11) version() uint {
+	return 11
+}
+
+func (revision11) up() (string, error) {
+	return `
+		CREATE TABLE node_check_observer (
+			id          INTEGER NOT NULL,
+			observer_id TEXT NOT NULL DEFAULT '',
+			count       INTEGER NOT NULL,
+			success     INTEGER NOT NULL DEFAULT 0,
+			outcomes    TEXT NOT NULL DEFAULT '',
+
+			PRIMARY KEY (id, observer_id),
+			FOREIGN KEY(id) REFERENCES node(id)
+		);
+		INSERT INTO node_check_observer (id, observer_id, count, success, outcomes)
+		     SELECT id, '', count, success, outcomes FROM node_check;
+		DROP TABLE node_check;
+		ALTER TABLE node_check_observer RENAME TO node_check;
+
+		ALTER TABLE node_check_history ADD COLUMN observer_id TEXT NOT NULL DEFAULT '';
+
+		CREATE TABLE node_observation (
+			node_id     INTEGER NOT NULL,
+			observer_id TEXT NOT NULL,
+			health      TEXT NOT NULL,
+			observed_at DATETIME NOT NULL,
+
+			PRIMARY KEY (node_id, observer_id),
+			FOREIGN KEY(node_id) REFERENCES node(id)
+		);
+	`, nil
+}
+
+func (revision11) down() (string, error) {
+	return `
+		DROP TABLE node_observation;
+
+		CREATE TABLE node_check_history_revision10 (
+			id         INTEGER PRIMARY KEY AUTOINCREMENT,
+			node_id    INTEGER NOT NULL,
+			type       TEXT NOT NULL,
+			checked_at DATETIME NOT NULL,
+			latency    INTEGER NOT NULL,
+			status     INTEGER NOT NULL,
+			error      TEXT,
+			healthy    BOOL NOT NULL,
+
+			FOREIGN KEY(node_id) REFERENCES node(id)
+		);
+		INSERT INTO node_check_history_revision10 (
+			id, node_id, type, checked_at, latency, status, error, healthy
+		) SELECT id, node_id, type, checked_at, latency, status, error, healthy
+		    FROM node_check_history;
+		DROP TABLE node_check_history;
+		ALTER TABLE node_check_history_revision10 RENAME TO node_check_history;
+		CREATE INDEX node_check_history_node_id ON node_check_history (node_id, id);
+		CREATE INDEX node_check_history_checked_at ON node_check_history (node_id, checked_at);
+
+		CREATE TABLE node_check_revision10 (
+			id       INTEGER PRIMARY KEY UNIQUE,
+			count    INTEGER NOT NULL,
+			success  INTEGER NOT NULL DEFAULT 0,
+			outcomes TEXT NOT NULL DEFAULT '',
+
+			FOREIGN KEY(id) REFERENCES node(id)
+		);
+		INSERT INTO node_check_revision10 (id, count, success, outcomes)
+		     SELECT id, max(count), max(success), max(outcomes) FROM node_check GROUP BY id;
+		DROP TABLE node_check;
+		ALTER TABLE node_check_revision10 RENAME TO node_check;
+	`, nil
+}
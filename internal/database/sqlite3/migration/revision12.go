@@ -0,0 +1,51 @@
+package migration
+
+type revision12 struct{}
+
+func (revision12) name() string {
+	return "Revision 12"
+}
+
+func (revision12) version() uint {
+	return 12
+}
+
+func (revision12) up() (string, error) {
+	return `
+		CREATE TABLE webhook (
+			id         INTEGER PRIMARY KEY AUTOINCREMENT,
+			url        TEXT NOT NULL,
+			events     JSON,
+			secret     TEXT NOT NULL,
+			created_at DATETIME NOT NULL
+		);
+
+		CREATE TABLE webhook_delivery (
+			id              INTEGER PRIMARY KEY AUTOINCREMENT,
+			webhook_id      INTEGER NOT NULL,
+			event           TEXT NOT NULL,
+			node_id         INTEGER NOT NULL,
+			key             TEXT NOT NULL,
+			payload         BLOB NOT NULL,
+			status          TEXT NOT NULL,
+			attempts        INTEGER NOT NULL DEFAULT 0,
+			next_attempt_at DATETIME NOT NULL,
+			last_status     INTEGER NOT NULL DEFAULT 0,
+			last_error      TEXT,
+			created_at      DATETIME NOT NULL,
+			updated_at      DATETIME NOT NULL,
+
+			FOREIGN KEY(webhook_id) REFERENCES webhook(id)
+		);
+		CREATE UNIQUE INDEX webhook_delivery_key ON webhook_delivery (webhook_id, key);
+		CREATE INDEX webhook_delivery_webhook_id ON webhook_delivery (webhook_id, id);
+		CREATE INDEX webhook_delivery_next_attempt_at ON webhook_delivery (status, next_attempt_at);
+	`, nil
+}
+
+func (revision12) down() (string, error) {
+	return `
+		DROP TABLE webhook_delivery;
+		DROP TABLE webhook;
+	`, nil
+}
@@ -0,0 +1,29 @@
+package migration
+
+type revision13 struct{}
+
+func (revision13) name() string {
+	return "Revision 13"
+}
+
+func (revision13) version() uint {
+	return 13
+}
+
+func (revision13) up() (string, error) {
+	return `
+		CREATE TABLE node_outbox (
+			id         INTEGER PRIMARY KEY AUTOINCREMENT,
+			node_id    INTEGER NOT NULL,
+			type       TEXT NOT NULL,
+			created_at DATETIME NOT NULL
+		);
+		CREATE INDEX node_outbox_created_at ON node_outbox (created_at);
+	`, nil
+}
+
+func (revision13) down() (string, error) {
+	return `
+		DROP TABLE node_outbox;
+	`, nil
+}
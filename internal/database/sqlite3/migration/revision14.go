@@ -0,0 +1,34 @@
+package migration
+
+type revision14 struct{}
+
+func (revision14) name() string {
+	return "Revision 14"
+}
+
+func (revision14) version() uint {
+	return 14
+}
+
+func (revision14) up() (string, error) {
+	return `
+		CREATE TABLE node_event (
+			id         INTEGER PRIMARY KEY AUTOINCREMENT,
+			node_id    INTEGER NOT NULL,
+			type       TEXT NOT NULL,
+			actor_kind TEXT NOT NULL,
+			actor_id   TEXT NOT NULL DEFAULT '',
+			before     JSON NOT NULL,
+			after      JSON NOT NULL,
+			created_at DATETIME NOT NULL
+		);
+		CREATE INDEX node_event_node_id ON node_event (node_id, id);
+		CREATE INDEX node_event_created_at ON node_event (created_at);
+	`, nil
+}
+
+func (revision14) down() (string, error) {
+	return `
+		DROP TABLE node_event;
+	`, nil
+}
@@ -0,0 +1,59 @@
+package migration
+
+type revision15 struct{}
+
+func (revision15) name() string {
+	return "Revision 15"
+}
+
+func (revision15) version() uint {
+	return 15
+}
+
+func (revision15) up() (string, error) {
+	return `
+		ALTER TABLE node ADD COLUMN capacity JSON NOT NULL DEFAULT '{}';
+
+		CREATE TABLE node_allocation (
+			id         TEXT NOT NULL,
+			node_id    INTEGER NOT NULL,
+			resources  JSON NOT NULL,
+			created_at DATETIME NOT NULL,
+
+			PRIMARY KEY (node_id, id),
+			FOREIGN KEY(node_id) REFERENCES node(id)
+		);
+	`, nil
+}
+
+func (revision15) down() (string, error) {
+	return `
+		DROP TABLE node_allocation;
+
+		CREATE TABLE node_revision14 (
+			id                INTEGER PRIMARY KEY AUTOINCREMENT,
+			address           TEXT NOT NULL,
+			metadata          JSON,
+			ttl               INTEGER NOT NULL,
+			active            BOOL NOT NULL,
+			created_at        DATETIME NOT NULL,
+			last_seen         DATETIME,
+			expires_at        DATETIME,
+			reactivated_at    DATETIME,
+			check_config      JSON,
+			health            TEXT NOT NULL DEFAULT 'healthy',
+			health_changed_at DATETIME,
+			registered_at     DATETIME
+		);
+		INSERT INTO node_revision14 (
+			id, address, metadata, ttl, active, created_at, last_seen, expires_at, reactivated_at,
+			check_config, health, health_changed_at, registered_at
+		) SELECT id, address, metadata, ttl, active, created_at, last_seen, expires_at, reactivated_at,
+		         check_config, health, health_changed_at, registered_at
+		    FROM node;
+		DROP TABLE node;
+		ALTER TABLE node_revision14 RENAME TO node;
+		CREATE INDEX node_created_at ON node (created_at, id);
+		CREATE UNIQUE INDEX node_address ON node (address);
+	`, nil
+}
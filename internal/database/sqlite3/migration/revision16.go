@@ -0,0 +1,41 @@
+package migration
+
+type revision16 struct{}
+
+func (revision16) name() string {
+	return "Revision 16"
+}
+
+func (revision16) version() uint {
+	return 16
+}
+
+// The values of the check headers are redacted from the audit history, they usually have
+// credentials.
+func (revision16) up() (string, error) {
+	return `
+		UPDATE node_event
+		   SET before = (
+		         SELECT json_group_object(
+		                  key, CASE WHEN key LIKE 'check.http.headers.%' THEN '[redacted]' ELSE value END
+		                )
+		           FROM json_each(node_event.before)
+		       )
+		 WHERE before LIKE '%"check.http.headers.%';
+		UPDATE node_event
+		   SET after = (
+		         SELECT json_group_object(
+		                  key, CASE WHEN key LIKE 'check.http.headers.%' THEN '[redacted]' ELSE value END
+		                )
+		           FROM json_each(node_event.after)
+		       )
+		 WHERE after LIKE '%"check.http.headers.%';
+	`, nil
+}
+
+// The redacted values can't be restored.
+func (revision16) down() (string, error) {
+	return `
+		SELECT 1;
+	`, nil
+}
@@ -0,0 +1,45 @@
+package migration
+
+type revision17 struct{}
+
+func (revision17) name() string {
+	return "Revision 17"
+}
+
+func (revision17) version() uint {
+	return 17
+}
+
+// The webhook position starts at the end of the outbox, the events written before don't have the
+// node state.
+func (revision17) up() (string, error) {
+	return `
+		ALTER TABLE node_outbox ADD COLUMN watch_type TEXT NOT NULL DEFAULT '';
+		ALTER TABLE node_outbox ADD COLUMN node JSON NOT NULL DEFAULT '{}';
+
+		CREATE TABLE webhook_position (
+			id       INTEGER PRIMARY KEY CHECK (id = 1),
+			position INTEGER NOT NULL
+		);
+		INSERT INTO webhook_position (id, position)
+		VALUES (1, COALESCE((SELECT seq FROM sqlite_sequence WHERE name = 'node_outbox'), 0));
+	`, nil
+}
+
+func (revision17) down() (string, error) {
+	return `
+		DROP TABLE webhook_position;
+
+		CREATE TABLE node_outbox_revision16 (
+			id         INTEGER PRIMARY KEY AUTOINCREMENT,
+			node_id    INTEGER NOT NULL,
+			type       TEXT NOT NULL,
+			created_at DATETIME NOT NULL
+		);
+		INSERT INTO node_outbox_revision16 (id, node_id, type, created_at)
+		SELECT id, node_id, type, created_at FROM node_outbox;
+		DROP TABLE node_outbox;
+		ALTER TABLE node_outbox_revision16 RENAME TO node_outbox;
+		CREATE INDEX node_outbox_created_at ON node_outbox (created_at);
+	`, nil
+}
@@ -0,0 +1,23 @@
+package migration
+
+type revision2 struct{}
+
+func (revision2) name() string {
+	return "Revision 2"
+}
+
+func (revision2) version() uint {
+	return 2
+}
+
+func (revision2) up() (string, error) {
+	return `
+		UPDATE node SET metadata = CAST(metadata AS TEXT) WHERE typeof(metadata) = 'blob';
+	`, nil
+}
+
+func (revision2) down() (string, error) {
+	return `
+		UPDATE node SET metadata = CAST(metadata AS BLOB) WHERE typeof(metadata) = 'text';
+	`, nil
+}
@@ -0,0 +1,25 @@
+package migration
+
+type revision3 struct{}
+
+func (revision3) name() string {
+	return "Revision 3"
+}
+
+func (revision3) version() uint {
+	return 3
+}
+
+func (revision3) up() (string, error) {
+	return `
+		CREATE INDEX node_created_at ON node (created_at, id);
+		CREATE INDEX node_address ON node (address, id);
+	`, nil
+}
+
+func (revision3) down() (string, error) {
+	return `
+		DROP INDEX node_address;
+		DROP INDEX node_created_at;
+	`, nil
+}
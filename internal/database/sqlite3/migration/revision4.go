@@ -0,0 +1,50 @@
+package migration
+
+type revision4 struct{}
+
+func (revision4) name() string {
+	return "Revision 4"
+}
+
+func (revision4) version() uint {
+	return 4
+}
+
+func (revision4) up() (string, error) {
+	return `
+		ALTER TABLE node ADD COLUMN reactivated_at DATETIME;
+		ALTER TABLE node_check ADD COLUMN success INTEGER NOT NULL DEFAULT 0;
+	`, nil
+}
+
+func (revision4) down() (string, error) {
+	return `
+		CREATE TABLE node_check_revision3 (
+			id    INTEGER PRIMARY KEY UNIQUE,
+			count INTEGER NOT NULL,
+
+			FOREIGN KEY(id) REFERENCES node(id)
+		);
+		INSERT INTO node_check_revision3 (id, count) SELECT id, count FROM node_check;
+		DROP TABLE node_check;
+		ALTER TABLE node_check_revision3 RENAME TO node_check;
+
+		CREATE TABLE node_revision3 (
+			id         INTEGER PRIMARY KEY AUTOINCREMENT,
+			address    TEXT NOT NULL,
+			metadata   JSON,
+			ttl        INTEGER NOT NULL,
+			active     BOOL NOT NULL,
+			created_at DATETIME NOT NULL,
+			last_seen  DATETIME,
+			expires_at DATETIME
+		);
+		INSERT INTO node_revision3 (
+			id, address, metadata, ttl, active, created_at, last_seen, expires_at
+		) SELECT id, address, metadata, ttl, active, created_at, last_seen, expires_at FROM node;
+		DROP TABLE node;
+		ALTER TABLE node_revision3 RENAME TO node;
+		CREATE INDEX node_created_at ON node (created_at, id);
+		CREATE INDEX node_address ON node (address, id);
+	`, nil
+}
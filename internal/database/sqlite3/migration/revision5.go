@@ -0,0 +1,32 @@
+package migration
+
+type revision5 struct{}
+
+func (revision5) name() string {
+	return "Revision 5"
+}
+
+func (revision5) version() uint {
+	return 5
+}
+
+// up keep only the latest registration of each address before creating the unique index.
+func (revision5) up() (string, error) {
+	return `
+		DELETE FROM node_check
+		 WHERE id IN (
+			SELECT id FROM node WHERE id NOT IN (SELECT MAX(id) FROM node GROUP BY address)
+		 );
+		DELETE FROM node WHERE id NOT IN (SELECT MAX(id) FROM node GROUP BY address);
+
+		DROP INDEX node_address;
+		CREATE UNIQUE INDEX node_address ON node (address);
+	`, nil
+}
+
+func (revision5) down() (string, error) {
+	return `
+		DROP INDEX node_address;
+		CREATE INDEX node_address ON node (address, id);
+	`, nil
+}
@@ -0,0 +1,41 @@
+package migration
+
+type revision6 struct{}
+
+func (revision6) name() string {
+	return "Revision 6"
+}
+
+func (revision6) version() uint {
+	return 6
+}
+
+func (revision6) up() (string, error) {
+	return `
+		ALTER TABLE node ADD COLUMN check_config JSON;
+	`, nil
+}
+
+func (revision6) down() (string, error) {
+	return `
+		CREATE TABLE node_revision5 (
+			id             INTEGER PRIMARY KEY AUTOINCREMENT,
+			address        TEXT NOT NULL,
+			metadata       JSON,
+			ttl            INTEGER NOT NULL,
+			active         BOOL NOT NULL,
+			created_at     DATETIME NOT NULL,
+			last_seen      DATETIME,
+			expires_at     DATETIME,
+			reactivated_at DATETIME
+		);
+		INSERT INTO node_revision5 (
+			id, address, metadata, ttl, active, created_at, last_seen, expires_at, reactivated_at
+		) SELECT id, address, metadata, ttl, active, created_at, last_seen, expires_at, reactivated_at
+		    FROM node;
+		DROP TABLE node;
+		ALTER TABLE node_revision5 RENAME TO node;
+		CREATE INDEX node_created_at ON node (created_at, id);
+		CREATE UNIQUE INDEX node_address ON node (address);
+	`, nil
+}
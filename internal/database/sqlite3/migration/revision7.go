@@ -0,0 +1,36 @@
+package migration
+
+type revision7 struct{}
+
+func (revision7) name() string {
+	return "Revision 7"
+}
+
+func (revision7) version() uint {
+	return 7
+}
+
+func (revision7) up() (string, error) {
+	return `
+		CREATE TABLE node_check_history (
+			id         INTEGER PRIMARY KEY AUTOINCREMENT,
+			node_id    INTEGER NOT NULL,
+			type       TEXT NOT NULL,
+			checked_at DATETIME NOT NULL,
+			latency    INTEGER NOT NULL,
+			status     INTEGER NOT NULL,
+			error      TEXT,
+			healthy    BOOL NOT NULL,
+
+			FOREIGN KEY(node_id) REFERENCES node(id)
+		);
+		CREATE INDEX node_check_history_node_id ON node_check_history (node_id, id);
+		CREATE INDEX node_check_history_checked_at ON node_check_history (node_id, checked_at);
+	`, nil
+}
+
+func (revision7) down() (string, error) {
+	return `
+		DROP TABLE node_check_history;
+	`, nil
+}
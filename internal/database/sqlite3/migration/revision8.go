@@ -0,0 +1,60 @@
+package migration
+
+type revision8 struct{}
+
+func (revision8) name() string {
+	return "Revision 8"
+}
+
+func (revision8) version() uint {
+	return 8
+}
+
+func (revision8) up() (string, error) {
+	return `
+		ALTER TABLE node ADD COLUMN health TEXT NOT NULL DEFAULT 'healthy';
+		ALTER TABLE node ADD COLUMN health_changed_at DATETIME;
+		UPDATE node
+		   SET health = 'unhealthy'
+		 WHERE active = false AND id IN (SELECT id FROM node_check WHERE count > 0);
+		ALTER TABLE node_check ADD COLUMN outcomes TEXT NOT NULL DEFAULT '';
+	`, nil
+}
+
+func (revision8) down() (string, error) {
+	return `
+		CREATE TABLE node_check_revision7 (
+			id      INTEGER PRIMARY KEY UNIQUE,
+			count   INTEGER NOT NULL,
+			success INTEGER NOT NULL DEFAULT 0,
+
+			FOREIGN KEY(id) REFERENCES node(id)
+		);
+		INSERT INTO node_check_revision7 (id, count, success) SELECT id, count, success FROM node_check;
+		DROP TABLE node_check;
+		ALTER TABLE node_check_revision7 RENAME TO node_check;
+
+		CREATE TABLE node_revision7 (
+			id             INTEGER PRIMARY KEY AUTOINCREMENT,
+			address        TEXT NOT NULL,
+			metadata       JSON,
+			ttl            INTEGER NOT NULL,
+			active         BOOL NOT NULL,
+			created_at     DATETIME NOT NULL,
+			last_seen      DATETIME,
+			expires_at     DATETIME,
+			reactivated_at DATETIME,
+			check_config   JSON
+		);
+		INSERT INTO node_revision7 (
+			id, address, metadata, ttl, active, created_at, last_seen, expires_at, reactivated_at,
+			check_config
+		) SELECT id, address, metadata, ttl, active, created_at, last_seen, expires_at, reactivated_at,
+		         check_config
+		    FROM node;
+		DROP TABLE node;
+		ALTER TABLE node_revision7 RENAME TO node;
+		CREATE INDEX node_created_at ON node (created_at, id);
+		CREATE UNIQUE INDEX node_address ON node (address);
+	`, nil
+}
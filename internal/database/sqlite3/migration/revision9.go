@@ -0,0 +1,47 @@
+package migration
+
+type revision9 struct{}
+
+func (revision9) name() string {
+	return "Revision 9"
+}
+
+func (revision9) version() uint {
+	return 9
+}
+
+func (revision9) up() (string, error) {
+	return `
+		ALTER TABLE node ADD COLUMN registered_at DATETIME;
+		UPDATE node SET registered_at = created_at;
+	`, nil
+}
+
+func (revision9) down() (string, error) {
+	return `
+		CREATE TABLE node_revision8 (
+			id                INTEGER PRIMARY KEY AUTOINCREMENT,
+			address           TEXT NOT NULL,
+			metadata          JSON,
+			ttl               INTEGER NOT NULL,
+			active            BOOL NOT NULL,
+			created_at        DATETIME NOT NULL,
+			last_seen         DATETIME,
+			expires_at        DATETIME,
+			reactivated_at    DATETIME,
+			check_config      JSON,
+			health            TEXT NOT NULL DEFAULT 'healthy',
+			health_changed_at DATETIME
+		);
+		INSERT INTO node_revision8 (
+			id, address, metadata, ttl, active, created_at, last_seen, expires_at, reactivated_at,
+			check_config, health, health_changed_at
+		) SELECT id, address, metadata, ttl, active, created_at, last_seen, expires_at, reactivated_at,
+		         check_config, health, health_changed_at
+		    FROM node;
+		DROP TABLE node;
+		ALTER TABLE node_revision8 RENAME TO node;
+		CREATE INDEX node_created_at ON node (created_at, id);
+		CREATE UNIQUE INDEX node_address ON node (address);
+	`, nil
+}
@@ -5,21 +5,68 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 
 	"malta/internal/service"
 )
 
 const (
+	nodeColumns = `
+		id, address, metadata, ttl, check_config, active, created_at, last_seen, expires_at,
+		reactivated_at, health, health_changed_at, registered_at, capacity
+	`
 	queryInsert = `
-		INSERT INTO node (address, metadata, ttl, active, created_at) VALUES (?, ?, ?, ?, ?)
+		INSERT INTO node (
+			address, metadata, ttl, check_config, active, created_at, last_seen, expires_at,
+			reactivated_at, health, health_changed_at, registered_at, capacity
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (address) DO NOTHING
+	`
+	querySelectOneByAddress = "SELECT " + nodeColumns + " FROM node WHERE address = ?"
+	queryResetCheck         = "UPDATE node_check SET count = 0, success = 0, outcomes = '' WHERE id = ?"
+	querySelectExpired      = `
+		SELECT ` + nodeColumns + `
+		  FROM node
+		 WHERE active = true AND expires_at IS NOT NULL AND expires_at < ?
 	`
+	queryDelete             = "DELETE FROM node WHERE id = ?"
+	queryDeleteCheck        = "DELETE FROM node_check WHERE id = ?"
+	queryDeleteHistory      = "DELETE FROM node_check_history WHERE node_id = ?"
+	queryDeleteStatus       = "DELETE FROM node_status WHERE node_id = ?"
+	queryDeleteObservations = "DELETE FROM node_observation WHERE node_id = ?"
+	queryDeleteAllocations  = "DELETE FROM node_allocation WHERE node_id = ?"
 )
 
+type nodeCheck struct {
+	Type        string        `json:"type,omitempty"`
+	GRPCService string        `json:"grpcService,omitempty"`
+	GracePeriod int64         `json:"gracePeriod,omitempty"`
+	HTTP        nodeCheckHTTP `json:"http"`
+}
+
+type nodeCheckHTTP struct {
+	Path          string            `json:"path,omitempty"`
+	Method        string            `json:"method,omitempty"`
+	Headers       map[string]string `json:"headers,omitempty"`
+	Statuses      []string          `json:"statuses,omitempty"`
+	BodyRegex     string            `json:"bodyRegex,omitempty"`
+	BodyJSONPath  string            `json:"bodyJSONPath,omitempty"`
+	BodyJSONValue string            `json:"bodyJSONValue,omitempty"`
+}
+
+type nodeResources struct {
+	CPU    int64            `json:"cpu,omitempty"`
+	Memory int64            `json:"memory,omitempty"`
+	Disk   int64            `json:"disk,omitempty"`
+	Slots  int64            `json:"slots,omitempty"`
+	Custom map[string]int64 `json:"custom,omitempty"`
+}
+
 // Node has the business logic around the database layer.
 type Node struct {
 	Client *Client
 
-	stmtSelect    *sql.Stmt
 	stmtSelectOne *sql.Stmt
 	stmtUpdate    *sql.Stmt
 }
@@ -32,126 +79,146 @@ func (n *Node) Init() error {
 	return nil
 }
 
-// Select return a list of nodes.
-func (n *Node) Select(ctx context.Context) ([]service.Node, error) {
-	rows, err := n.stmtSelect.QueryContext(ctx)
+// Select return a list of nodes filtered by the query.
+func (n *Node) Select(ctx context.Context, query service.NodeQuery) ([]service.Node, error) {
+	statement, arguments, err := nodeSelectQuery(query)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute que query: %w", err)
+		return nil, fmt.Errorf("failed to generate the query: %w", err)
 	}
-	defer rows.Close()
-
-	var nodes []service.Node
-	for rows.Next() {
-		var (
-			node     service.Node
-			metadata []byte
-		)
-		err := rows.Scan(&node.ID, &node.Address, &metadata, &node.TTL, &node.Active, &node.CreatedAt)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse the rows: %w", err)
-		}
 
-		if len(metadata) > 0 {
-			if err := json.Unmarshal(metadata, &node.Metadata); err != nil {
-				return nil, fmt.Errorf("failed to unmarshal metadata: %w", err)
-			}
-		}
-		nodes = append(nodes, node)
+	rows, err := n.Client.instance.QueryContext(ctx, statement, arguments...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute que query: %w", wrapError(err))
 	}
+	return nodeScanRows(rows)
+}
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("failed to process the rows: %w", err)
+// SelectExpired return the active nodes with a lease expired before the given time.
+func (n *Node) SelectExpired(ctx context.Context, now time.Time) ([]service.Node, error) {
+	rows, err := n.Client.instance.QueryContext(ctx, querySelectExpired, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute que query: %w", wrapError(err))
 	}
-	return nodes, nil
+	return nodeScanRows(rows)
 }
 
 // SelectOne is used to get a single node.
 func (n *Node) SelectOne(ctx context.Context, id string) (service.Node, error) {
-	var (
-		node     service.Node
-		metadata []byte
-		row      = n.stmtSelectOne.QueryRowContext(ctx, id)
-	)
-	err := row.Scan(&node.ID, &node.Address, &metadata, &node.TTL, &node.Active, &node.CreatedAt)
-	if err != nil {
-		return service.Node{}, fmt.Errorf("failed to parse the rows: %w", err)
-	}
+	return n.selectOne(n.stmtSelectOne.QueryRowContext(ctx, id))
+}
 
-	if len(metadata) > 0 {
-		if err := json.Unmarshal(metadata, &node.Metadata); err != nil {
-			return service.Node{}, fmt.Errorf("failed to unmarshal metadata: %w", err)
-		}
-	}
-	return node, nil
+// SelectOneTx is used to get a single node inside a transaction.
+func (n *Node) SelectOneTx(tx *sql.Tx, id string) (service.Node, error) {
+	return n.selectOne(tx.Stmt(n.stmtSelectOne).QueryRow(id))
+}
+
+// SelectOneByAddressTx is used to get a single node by its address inside a transaction.
+func (n *Node) SelectOneByAddressTx(tx *sql.Tx, address string) (service.Node, error) {
+	return n.selectOne(tx.QueryRow(querySelectOneByAddress, address))
 }
 
-// Insert a node.
-func (n *Node) Insert(tx *sql.Tx, node service.Node) (service.Node, error) {
+// Insert a node. If a node with the same address already exists, nothing is inserted and the
+// boolean is false.
+func (n *Node) Insert(tx *sql.Tx, node service.Node) (service.Node, bool, error) {
 	arguments, err := nodeInsertArguments(node)
 	if err != nil {
-		return service.Node{}, fmt.Errorf("failed to generate the insert arguments: %w", err)
+		return service.Node{}, false, fmt.Errorf("failed to generate the insert arguments: %w", err)
 	}
 
 	result, err := tx.Exec(queryInsert, arguments...)
 	if err != nil {
-		return service.Node{}, fmt.Errorf("failed to insert the node: %w", err)
+		return service.Node{}, false, fmt.Errorf("failed to insert the node: %w", wrapError(err))
 	}
 	affectedRows, err := result.RowsAffected()
 	if err != nil {
-		return service.Node{}, fmt.Errorf("failed to check if the row was inserted: %w", err)
+		return service.Node{}, false, fmt.Errorf("failed to check if the row was inserted: %w", err)
 	}
-	if affectedRows != 1 {
-		return service.Node{}, fmt.Errorf("expected one row to be affected but '%d' was", affectedRows)
+	switch affectedRows {
+	case 0:
+		return node, false, nil
+	case 1:
+	default:
+		return service.Node{}, false, errAffectedRows(affectedRows)
 	}
 
 	id, err := result.LastInsertId()
 	if err != nil {
-		return service.Node{}, fmt.Errorf("failed to fetch the insert id: %w", err)
+		return service.Node{}, false, fmt.Errorf("failed to fetch the insert id: %w", err)
 	}
 	node.ID = (int)(id)
-	return node, nil
+	return node, true, nil
 }
 
 // Update a given node.
 func (n *Node) Update(ctx context.Context, node service.Node) error {
-	arguments, err := nodeInsertArguments(node)
-	if err != nil {
-		return fmt.Errorf("failed to generate the insert arguments: %w", err)
+	return n.update(ctx, n.stmtUpdate.ExecContext, node)
+}
+
+// UpdateTx update a given node inside a transaction.
+func (n *Node) UpdateTx(tx *sql.Tx, node service.Node) error {
+	return n.update(context.Background(), tx.Stmt(n.stmtUpdate).ExecContext, node)
+}
+
+// ResetCheck reset the check counters of a node and discard what the observers have seen so far.
+func (n *Node) ResetCheck(tx *sql.Tx, id int) error {
+	if _, err := tx.Exec(queryResetCheck, id); err != nil {
+		return fmt.Errorf("failed to reset the node check: %w", err)
+	}
+
+	if _, err := tx.Exec(queryDeleteObservations, id); err != nil {
+		return fmt.Errorf("failed to reset the node observations: %w", wrapError(err))
+	}
+	return nil
+}
+
+// Delete a node together with its check counters, history, status, observations and allocations.
+func (n *Node) Delete(tx *sql.Tx, id int) error {
+	if _, err := tx.Exec(queryDeleteCheck, id); err != nil {
+		return fmt.Errorf("failed to delete the node check: %w", wrapError(err))
+	}
+
+	if _, err := tx.Exec(queryDeleteHistory, id); err != nil {
+		return fmt.Errorf("failed to delete the node check history: %w", wrapError(err))
+	}
+
+	if _, err := tx.Exec(queryDeleteStatus, id); err != nil {
+		return fmt.Errorf("failed to delete the node status: %w", wrapError(err))
+	}
+
+	if _, err := tx.Exec(queryDeleteObservations, id); err != nil {
+		return fmt.Errorf("failed to delete the node observations: %w", wrapError(err))
 	}
-	arguments = append(arguments, node.ID)
 
-	result, err := n.stmtUpdate.ExecContext(ctx, arguments...)
+	if _, err := tx.Exec(queryDeleteAllocations, id); err != nil {
+		return fmt.Errorf("failed to delete the node allocations: %w", wrapError(err))
+	}
+
+	result, err := tx.Exec(queryDelete, id)
 	if err != nil {
-		return fmt.Errorf("failed to update: %w", err)
+		return fmt.Errorf("failed to delete the node: %w", wrapError(err))
 	}
 	affectedRows, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("failed to check if the row was updated: %w", err)
+		return fmt.Errorf("failed to check if the row was deleted: %w", err)
 	}
 	if affectedRows != 1 {
-		return fmt.Errorf("expected one row to be affected but '%d' was", affectedRows)
+		return errAffectedRows(affectedRows)
 	}
 	return nil
 }
 
 func (n *Node) open() (err error) {
-	querySelect := `SELECT id, address, metadata, ttl, active, created_at
-										FROM node
-									 WHERE active = true
-								ORDER BY created_at`
-	n.stmtSelect, err = n.Client.instance.Prepare(querySelect)
-	if err != nil {
-		return fmt.Errorf("failed to create the select prepared statement: %w", err)
-	}
-
-	querySelectOne := "SELECT id, address, metadata, ttl, active, created_at FROM node WHERE id = ?"
+	querySelectOne := "SELECT " + nodeColumns + " FROM node WHERE id = ?"
 	n.stmtSelectOne, err = n.Client.instance.Prepare(querySelectOne)
 	if err != nil {
 		return fmt.Errorf("failed to create the select one prepared statement: %w", err)
 	}
 
 	queryUpdate := `UPDATE node
-									   SET address = ?, metadata = ?, ttl = ?, active = ?, created_at = ?
+									   SET address = ?, metadata = ?, ttl = ?, check_config = ?, active = ?,
+									       created_at = ?,
+									       last_seen = ?, expires_at = ?, reactivated_at = ?, health = ?,
+									       health_changed_at = ?, registered_at = ?, capacity = ?
 									 WHERE id = ?`
 	n.stmtUpdate, err = n.Client.instance.Prepare(queryUpdate)
 	if err != nil {
@@ -162,10 +229,6 @@ func (n *Node) open() (err error) {
 }
 
 func (n *Node) close() (err error) {
-	if err := n.stmtSelect.Close(); err != nil {
-		return fmt.Errorf("failed to close the select prepared statement: %w", err)
-	}
-
 	if err := n.stmtSelectOne.Close(); err != nil {
 		return fmt.Errorf("failed to close the select one prepared statement: %w", err)
 	}
@@ -176,10 +239,305 @@ func (n *Node) close() (err error) {
 	return nil
 }
 
+func (n *Node) selectOne(row *sql.Row) (service.Node, error) {
+	node, err := nodeScan(row)
+	if err != nil {
+		return service.Node{}, fmt.Errorf("failed to parse the rows: %w", wrapError(err))
+	}
+	return node, nil
+}
+
+func (n *Node) update(
+	ctx context.Context, exec func(context.Context, ...interface{}) (sql.Result, error), node service.Node,
+) error {
+	arguments, err := nodeInsertArguments(node)
+	if err != nil {
+		return fmt.Errorf("failed to generate the insert arguments: %w", err)
+	}
+	arguments = append(arguments, node.ID)
+
+	result, err := exec(ctx, arguments...)
+	if err != nil {
+		return fmt.Errorf("failed to update: %w", wrapError(err))
+	}
+	affectedRows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check if the row was updated: %w", err)
+	}
+	if affectedRows != 1 {
+		return errAffectedRows(affectedRows)
+	}
+	return nil
+}
+
 func nodeInsertArguments(n service.Node) ([]interface{}, error) {
 	metadata, err := json.Marshal(n.Metadata)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal the node metadata: %w", err)
 	}
-	return []interface{}{n.Address, metadata, n.TTL.Nanoseconds(), n.Active, n.CreatedAt}, nil
+
+	check, err := json.Marshal(toNodeCheckRecord(n.Check))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal the node check: %w", err)
+	}
+
+	capacity, err := json.Marshal(toNodeResourcesRecord(n.Capacity))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal the node capacity: %w", err)
+	}
+	return []interface{}{
+		n.Address,
+		string(metadata),
+		n.TTL.Nanoseconds(),
+		string(check),
+		n.Active,
+		n.CreatedAt,
+		nullTime(n.LastSeen),
+		nullTime(n.ExpiresAt),
+		nullTime(n.ReactivatedAt),
+		nodeHealth(n.Health),
+		nullTime(n.HealthChangedAt),
+		nullTime(n.RegisteredAt),
+		string(capacity),
+	}, nil
+}
+
+func nodeSelectQuery(query service.NodeQuery) (string, []interface{}, error) {
+	var (
+		conditions []string
+		arguments  []interface{}
+	)
+	switch query.State {
+	case service.NodeQueryStateActive, "":
+		conditions = append(conditions, "active = true")
+	case service.NodeQueryStateInactive:
+		conditions = append(conditions, "active = false")
+	case service.NodeQueryStateAll:
+	default:
+		return "", nil, fmt.Errorf("unknown state '%s'", query.State)
+	}
+
+	if len(query.Health) > 0 {
+		placeholders := make([]string, len(query.Health))
+		for i, health := range query.Health {
+			placeholders[i] = "?"
+			arguments = append(arguments, string(health))
+		}
+		conditions = append(conditions, fmt.Sprintf("health IN (%s)", strings.Join(placeholders, ", ")))
+	}
+
+	for _, requirement := range query.Selector {
+		path := fmt.Sprintf(`$."%s"`, requirement.Key)
+		switch requirement.Operator {
+		case service.NodeSelectorOperatorEquals:
+			conditions = append(conditions, "json_extract(metadata, ?) = ?")
+			arguments = append(arguments, path, requirement.Value)
+		case service.NodeSelectorOperatorNotEquals:
+			conditions = append(
+				conditions, "(json_type(metadata, ?) IS NULL OR json_extract(metadata, ?) != ?)",
+			)
+			arguments = append(arguments, path, path, requirement.Value)
+		case service.NodeSelectorOperatorExists:
+			conditions = append(conditions, "json_type(metadata, ?) IS NOT NULL")
+			arguments = append(arguments, path)
+		case service.NodeSelectorOperatorNotExists:
+			conditions = append(conditions, "json_type(metadata, ?) IS NULL")
+			arguments = append(arguments, path)
+		}
+	}
+
+	column := "created_at"
+	switch query.Sort {
+	case service.NodeSortID:
+		column = "id"
+	case service.NodeSortAddress:
+		column = "address"
+	}
+
+	if query.After != nil {
+		value, err := nodeCursorValue(*query.After)
+		if err != nil {
+			return "", nil, err
+		}
+		if column == "id" {
+			conditions = append(conditions, "id > ?")
+			arguments = append(arguments, query.After.ID)
+		} else {
+			conditions = append(
+				conditions, fmt.Sprintf("(%s > ? OR (%s = ? AND id > ?))", column, column),
+			)
+			arguments = append(arguments, value, value, query.After.ID)
+		}
+	}
+
+	statement := fmt.Sprintf("SELECT %s FROM node", nodeColumns)
+	if len(conditions) > 0 {
+		statement += fmt.Sprintf(" WHERE %s", strings.Join(conditions, " AND "))
+	}
+	statement += fmt.Sprintf(" ORDER BY %s", column)
+	if column != "id" {
+		statement += ", id"
+	}
+	if query.Limit > 0 {
+		statement += " LIMIT ?"
+		arguments = append(arguments, query.Limit)
+	}
+	return statement, arguments, nil
+}
+
+func nodeCursorValue(cursor service.NodeCursor) (interface{}, error) {
+	switch cursor.Sort {
+	case service.NodeSortCreatedAt, "":
+		value, err := time.Parse(time.RFC3339Nano, cursor.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor value '%s': %w", cursor.Value, err)
+		}
+		return value.UTC(), nil
+	default:
+		return cursor.Value, nil
+	}
+}
+
+func nodeScan(row interface{ Scan(...interface{}) error }) (service.Node, error) {
+	var (
+		node            service.Node
+		metadata        []byte
+		check           []byte
+		lastSeen        sql.NullTime
+		expiresAt       sql.NullTime
+		reactivatedAt   sql.NullTime
+		health          string
+		healthChangedAt sql.NullTime
+		registeredAt    sql.NullTime
+		capacity        []byte
+	)
+	err := row.Scan(
+		&node.ID,
+		&node.Address,
+		&metadata,
+		&node.TTL,
+		&check,
+		&node.Active,
+		&node.CreatedAt,
+		&lastSeen,
+		&expiresAt,
+		&reactivatedAt,
+		&health,
+		&healthChangedAt,
+		&registeredAt,
+		&capacity,
+	)
+	if err != nil {
+		return service.Node{}, err
+	}
+	node.LastSeen = lastSeen.Time
+	node.ExpiresAt = expiresAt.Time
+	node.ReactivatedAt = reactivatedAt.Time
+	node.Health = service.NodeHealth(health)
+	node.HealthChangedAt = healthChangedAt.Time
+	node.RegisteredAt = registeredAt.Time
+
+	if len(metadata) > 0 {
+		if err := json.Unmarshal(metadata, &node.Metadata); err != nil {
+			return service.Node{}, fmt.Errorf("failed to unmarshal metadata: %w", err)
+		}
+	}
+
+	if len(check) > 0 {
+		var nc nodeCheck
+		if err := json.Unmarshal(check, &nc); err != nil {
+			return service.Node{}, fmt.Errorf("failed to unmarshal check: %w", err)
+		}
+		node.Check = fromNodeCheckRecord(nc)
+	}
+
+	var nr nodeResources
+	if err := json.Unmarshal(capacity, &nr); err != nil {
+		return service.Node{}, fmt.Errorf("failed to unmarshal capacity: %w", err)
+	}
+	node.Capacity = fromNodeResourcesRecord(nr)
+	return node, nil
+}
+
+func nodeScanRows(rows *sql.Rows) ([]service.Node, error) {
+	defer rows.Close()
+
+	var nodes []service.Node
+	for rows.Next() {
+		node, err := nodeScan(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the rows: %w", err)
+		}
+		nodes = append(nodes, node)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to process the rows: %w", err)
+	}
+	return nodes, nil
+}
+
+func toNodeCheckRecord(check service.NodeCheck) nodeCheck {
+	return nodeCheck{
+		Type:        string(check.Type),
+		GRPCService: check.GRPCService,
+		GracePeriod: check.GracePeriod.Nanoseconds(),
+		HTTP: nodeCheckHTTP{
+			Path:          check.HTTP.Path,
+			Method:        check.HTTP.Method,
+			Headers:       check.HTTP.Headers,
+			Statuses:      check.HTTP.Statuses,
+			BodyRegex:     check.HTTP.BodyRegex,
+			BodyJSONPath:  check.HTTP.BodyJSONPath,
+			BodyJSONValue: check.HTTP.BodyJSONValue,
+		},
+	}
+}
+
+func fromNodeCheckRecord(nc nodeCheck) service.NodeCheck {
+	return service.NodeCheck{
+		Type:        service.NodeCheckType(nc.Type),
+		GRPCService: nc.GRPCService,
+		GracePeriod: time.Duration(nc.GracePeriod),
+		HTTP: service.NodeCheckHTTP{
+			Path:          nc.HTTP.Path,
+			Method:        nc.HTTP.Method,
+			Headers:       nc.HTTP.Headers,
+			Statuses:      nc.HTTP.Statuses,
+			BodyRegex:     nc.HTTP.BodyRegex,
+			BodyJSONPath:  nc.HTTP.BodyJSONPath,
+			BodyJSONValue: nc.HTTP.BodyJSONValue,
+		},
+	}
+}
+
+func toNodeResourcesRecord(resources service.NodeResources) nodeResources {
+	return nodeResources{
+		CPU:    resources.CPU,
+		Memory: resources.Memory,
+		Disk:   resources.Disk,
+		Slots:  resources.Slots,
+		Custom: resources.Custom,
+	}
+}
+
+func fromNodeResourcesRecord(nr nodeResources) service.NodeResources {
+	return service.NodeResources{
+		CPU:    nr.CPU,
+		Memory: nr.Memory,
+		Disk:   nr.Disk,
+		Slots:  nr.Slots,
+		Custom: nr.Custom,
+	}
+}
+
+func nodeHealth(health service.NodeHealth) string {
+	if health == "" {
+		return string(service.NodeHealthHealthy)
+	}
+	return string(health)
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
 }
@@ -0,0 +1,177 @@
+package sqlite3
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"malta/internal/service"
+)
+
+const nodeAllocationColumns = "id, node_id, resources, created_at"
+
+// NodeAllocation keeps the shares of the capacity of the nodes taken by the tasks.
+type NodeAllocation struct {
+	Client *Client
+
+	stmtInsert    *sql.Stmt
+	stmtSelect    *sql.Stmt
+	stmtSelectAll *sql.Stmt
+	stmtDelete    *sql.Stmt
+}
+
+// Init internal state.
+func (a *NodeAllocation) Init() error {
+	if a.Client == nil {
+		return fmt.Errorf("missing client")
+	}
+	return nil
+}
+
+// Insert an allocation. It's a conflict if the node already has an allocation with the same id.
+func (a *NodeAllocation) Insert(tx *sql.Tx, allocation service.NodeAllocation) error {
+	resources, err := json.Marshal(toNodeResourcesRecord(allocation.Resources))
+	if err != nil {
+		return fmt.Errorf("failed to marshal the resources: %w", err)
+	}
+
+	_, err = tx.Stmt(a.stmtInsert).Exec(
+		allocation.ID, allocation.NodeID, string(resources), allocation.CreatedAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert the allocation: %w", wrapError(err))
+	}
+	return nil
+}
+
+// Select the allocations of a node from the oldest to the newest.
+func (a *NodeAllocation) Select(ctx context.Context, nodeID int) ([]service.NodeAllocation, error) {
+	rows, err := a.stmtSelect.QueryContext(ctx, nodeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute the query: %w", wrapError(err))
+	}
+	return nodeAllocationScanRows(rows)
+}
+
+// SelectTx select the allocations of a node inside a transaction.
+func (a *NodeAllocation) SelectTx(tx *sql.Tx, nodeID int) ([]service.NodeAllocation, error) {
+	rows, err := tx.Stmt(a.stmtSelect).Query(nodeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute the query: %w", wrapError(err))
+	}
+	return nodeAllocationScanRows(rows)
+}
+
+// SelectAll return the allocations of all the nodes.
+func (a *NodeAllocation) SelectAll(ctx context.Context) ([]service.NodeAllocation, error) {
+	rows, err := a.stmtSelectAll.QueryContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute the query: %w", wrapError(err))
+	}
+	return nodeAllocationScanRows(rows)
+}
+
+// Delete an allocation of a node.
+func (a *NodeAllocation) Delete(ctx context.Context, nodeID int, id string) error {
+	result, err := a.stmtDelete.ExecContext(ctx, nodeID, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete the allocation: %w", wrapError(err))
+	}
+	affectedRows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check if the row was deleted: %w", err)
+	}
+	if affectedRows != 1 {
+		return errAffectedRows(affectedRows)
+	}
+	return nil
+}
+
+func (a *NodeAllocation) open() (err error) {
+	queryInsert := `
+		INSERT INTO node_allocation (` + nodeAllocationColumns + `)
+		VALUES (?, ?, ?, ?)
+	`
+	a.stmtInsert, err = a.Client.instance.Prepare(queryInsert)
+	if err != nil {
+		return fmt.Errorf("failed to create the insert prepared statement: %w", err)
+	}
+
+	querySelect := `
+		SELECT ` + nodeAllocationColumns + `
+		  FROM node_allocation
+		 WHERE node_id = ?
+		 ORDER BY created_at, id
+	`
+	a.stmtSelect, err = a.Client.instance.Prepare(querySelect)
+	if err != nil {
+		return fmt.Errorf("failed to create the select prepared statement: %w", err)
+	}
+
+	querySelectAll := `
+		SELECT ` + nodeAllocationColumns + `
+		  FROM node_allocation
+		 ORDER BY node_id, created_at, id
+	`
+	a.stmtSelectAll, err = a.Client.instance.Prepare(querySelectAll)
+	if err != nil {
+		return fmt.Errorf("failed to create the select all prepared statement: %w", err)
+	}
+
+	queryDelete := "DELETE FROM node_allocation WHERE node_id = ? AND id = ?"
+	a.stmtDelete, err = a.Client.instance.Prepare(queryDelete)
+	if err != nil {
+		return fmt.Errorf("failed to create the delete prepared statement: %w", err)
+	}
+
+	return nil
+}
+
+func (a *NodeAllocation) close() error {
+	if err := a.stmtInsert.Close(); err != nil {
+		return fmt.Errorf("failed to close the insert prepared statement: %w", err)
+	}
+
+	if err := a.stmtSelect.Close(); err != nil {
+		return fmt.Errorf("failed to close the select prepared statement: %w", err)
+	}
+
+	if err := a.stmtSelectAll.Close(); err != nil {
+		return fmt.Errorf("failed to close the select all prepared statement: %w", err)
+	}
+
+	if err := a.stmtDelete.Close(); err != nil {
+		return fmt.Errorf("failed to close the delete prepared statement: %w", err)
+	}
+
+	return nil
+}
+
+func nodeAllocationScanRows(rows *sql.Rows) ([]service.NodeAllocation, error) {
+	defer rows.Close()
+
+	var allocations []service.NodeAllocation
+	for rows.Next() {
+		var (
+			allocation service.NodeAllocation
+			resources  []byte
+		)
+		err := rows.Scan(&allocation.ID, &allocation.NodeID, &resources, &allocation.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the rows: %w", err)
+		}
+
+		var nr nodeResources
+		if err := json.Unmarshal(resources, &nr); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal the resources: %w", err)
+		}
+		allocation.Resources = fromNodeResourcesRecord(nr)
+		allocations = append(allocations, allocation)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to process the rows: %w", err)
+	}
+	return allocations, nil
+}
@@ -4,15 +4,17 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+
+	"malta/internal/service"
 )
 
 // NodeCheck has the counters used to check if the node is health or not.
 type NodeCheck struct {
 	Client *Client
 
-	stmtSelect    *sql.Stmt
-	stmtIncrement *sql.Stmt
-	stmtUpdate    *sql.Stmt
+	stmtSelect *sql.Stmt
+	stmtRecord *sql.Stmt
+	stmtReset  *sql.Stmt
 }
 
 // Init internal state.
@@ -23,56 +25,82 @@ func (c *NodeCheck) Init() error {
 	return nil
 }
 
-// Increment the counter value to the given node.
-func (c *NodeCheck) Increment(ctx context.Context, id int) (int, error) {
-	result, err := c.stmtIncrement.ExecContext(ctx, id, 0)
+// Record the outcome of a check at the counters of the given node and observer. A failure
+// increments the failure counter and resets the consecutive successes. Only the last outcomes that
+// fit at the window are kept.
+func (c *NodeCheck) Record(
+	ctx context.Context, id int, observerID string, healthy bool, window int,
+) (service.NodeCheckCounter, error) {
+	failure, success, outcome := 1, 0, "0"
+	if healthy {
+		failure, success, outcome = 0, 1, "1"
+	}
+	if window < 1 {
+		window = 1
+	}
+
+	result, err := c.stmtRecord.ExecContext(ctx, id, observerID, failure, success, outcome, window)
 	if err != nil {
-		return 0, fmt.Errorf("failed to update: %w", err)
+		return service.NodeCheckCounter{}, fmt.Errorf("failed to update: %w", wrapError(err))
 	}
 
 	affectedRows, err := result.RowsAffected()
 	if err != nil {
-		return 0, fmt.Errorf("failed to check if the row was updated: %w", err)
+		return service.NodeCheckCounter{}, fmt.Errorf("failed to check if the row was updated: %w", err)
 	}
 	if affectedRows != 1 {
-		return 0, fmt.Errorf("expected one row to be affected but '%d' was", affectedRows)
+		return service.NodeCheckCounter{}, errAffectedRows(affectedRows)
 	}
 
-	var count int
-	if err := c.stmtSelect.QueryRow(id).Scan(&count); err != nil {
-		return 0, fmt.Errorf("failed to fetch the count: %w", err)
+	var (
+		counter  service.NodeCheckCounter
+		outcomes string
+	)
+	err = c.stmtSelect.QueryRowContext(ctx, id, observerID).
+		Scan(&counter.Failures, &counter.Successes, &outcomes)
+	if err != nil {
+		return service.NodeCheckCounter{}, fmt.Errorf("failed to fetch the counters: %w", wrapError(err))
+	}
+	counter.Outcomes = make([]bool, len(outcomes))
+	for i, value := range outcomes {
+		counter.Outcomes[i] = value == '1'
 	}
-	return count, nil
+	return counter, nil
 }
 
-// Update the node counter with the given value.
-func (c *NodeCheck) Update(ctx context.Context, id, value int) error {
-	if _, err := c.stmtUpdate.ExecContext(ctx, value, id); err != nil {
-		return fmt.Errorf("failed to update: %w", err)
+// Reset the counters of the given node and observer.
+func (c *NodeCheck) Reset(ctx context.Context, id int, observerID string) error {
+	if _, err := c.stmtReset.ExecContext(ctx, id, observerID); err != nil {
+		return fmt.Errorf("failed to update: %w", wrapError(err))
 	}
 	return nil
 }
 
 func (c *NodeCheck) open() (err error) {
-	querySelect := "SELECT count FROM node_check WHERE id = ?"
+	querySelect := "SELECT count, success, outcomes FROM node_check WHERE id = ? AND observer_id = ?"
 	c.stmtSelect, err = c.Client.instance.Prepare(querySelect)
 	if err != nil {
 		return fmt.Errorf("failed to create the select prepared statement: %w", err)
 	}
 
-	queryIncrement := `
-		INSERT INTO node_check(id, count) VALUES (?, ?)
-		ON CONFLICT (id) DO UPDATE SET count=count+1
+	queryRecord := `
+		INSERT INTO node_check(id, observer_id, count, success, outcomes) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (id, observer_id) DO UPDATE
+		SET count = count + excluded.count,
+		    success = CASE WHEN excluded.success = 1 THEN success + 1 ELSE 0 END,
+		    outcomes = substr(outcomes || excluded.outcomes, -?)
 	`
-	c.stmtIncrement, err = c.Client.instance.Prepare(queryIncrement)
+	c.stmtRecord, err = c.Client.instance.Prepare(queryRecord)
 	if err != nil {
-		return fmt.Errorf("failed to create the increment prepared statement: %w", err)
+		return fmt.Errorf("failed to create the record prepared statement: %w", err)
 	}
 
-	queryUpdate := "UPDATE node_check SET count = ? WHERE id = ?"
-	c.stmtUpdate, err = c.Client.instance.Prepare(queryUpdate)
+	queryReset := `
+		UPDATE node_check SET count = 0, success = 0, outcomes = '' WHERE id = ? AND observer_id = ?
+	`
+	c.stmtReset, err = c.Client.instance.Prepare(queryReset)
 	if err != nil {
-		return fmt.Errorf("failed to create the update prepared statement: %w", err)
+		return fmt.Errorf("failed to create the reset prepared statement: %w", err)
 	}
 
 	return nil
@@ -83,12 +111,12 @@ func (c *NodeCheck) close() (err error) {
 		return fmt.Errorf("failed to close the select prepared statement: %w", err)
 	}
 
-	if err := c.stmtIncrement.Close(); err != nil {
-		return fmt.Errorf("failed to close the increment prepared statement: %w", err)
+	if err := c.stmtRecord.Close(); err != nil {
+		return fmt.Errorf("failed to close the record prepared statement: %w", err)
 	}
 
-	if err := c.stmtUpdate.Close(); err != nil {
-		return fmt.Errorf("failed to close the update prepared statement: %w", err)
+	if err := c.stmtReset.Close(); err != nil {
+		return fmt.Errorf("failed to close the reset prepared statement: %w", err)
 	}
 
 	return nil
@@ -0,0 +1,190 @@
+package sqlite3
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"malta/internal/service"
+)
+
+// NodeCheckHistory keeps the results of the node checks. The history of each node is bounded and
+// the older results are discarded as new ones arrive.
+type NodeCheckHistory struct {
+	Client *Client
+
+	stmtInsert       *sql.Stmt
+	stmtCompact      *sql.Stmt
+	stmtSelect       *sql.Stmt
+	stmtSelectUptime *sql.Stmt
+}
+
+// Init internal state.
+func (h *NodeCheckHistory) Init() error {
+	if h.Client == nil {
+		return fmt.Errorf("missing client")
+	}
+	return nil
+}
+
+// Insert the result of a check and discard the older results of the node beyond the given size.
+func (h *NodeCheckHistory) Insert(ctx context.Context, result service.NodeCheckResult, size int) error {
+	var checkError sql.NullString
+	if result.Error != "" {
+		checkError = sql.NullString{String: result.Error, Valid: true}
+	}
+
+	_, err := h.stmtInsert.ExecContext(
+		ctx,
+		result.NodeID,
+		result.ObserverID,
+		string(result.Type),
+		result.CheckedAt.UTC(),
+		int64(result.Latency),
+		result.Status,
+		checkError,
+		result.Healthy,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert the check result: %w", wrapError(err))
+	}
+
+	if _, err := h.stmtCompact.ExecContext(ctx, result.NodeID, result.NodeID, size); err != nil {
+		return fmt.Errorf("failed to compact the check history: %w", wrapError(err))
+	}
+	return nil
+}
+
+// Select the results of the checks of a node from the newest to the oldest.
+func (h *NodeCheckHistory) Select(
+	ctx context.Context, query service.NodeCheckResultQuery,
+) ([]service.NodeCheckResult, error) {
+	rows, err := h.stmtSelect.QueryContext(
+		ctx, query.NodeID, query.From.UTC(), query.To.UTC(), query.Limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute the query: %w", wrapError(err))
+	}
+	defer rows.Close()
+
+	var results []service.NodeCheckResult
+	for rows.Next() {
+		var (
+			result     service.NodeCheckResult
+			checkType  string
+			latency    int64
+			checkError sql.NullString
+		)
+		err := rows.Scan(
+			&result.ID,
+			&result.NodeID,
+			&result.ObserverID,
+			&checkType,
+			&result.CheckedAt,
+			&latency,
+			&result.Status,
+			&checkError,
+			&result.Healthy,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the rows: %w", err)
+		}
+		result.Type = service.NodeCheckType(checkType)
+		result.Latency = time.Duration(latency)
+		result.Error = checkError.String
+		results = append(results, result)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to process the rows: %w", err)
+	}
+	return results, nil
+}
+
+// SelectUptime count the checks and the healthy ones of a node over a period.
+func (h *NodeCheckHistory) SelectUptime(
+	ctx context.Context, nodeID int, from, to time.Time,
+) (service.NodeUptime, error) {
+	uptime := service.NodeUptime{From: from, To: to}
+	var healthy sql.NullInt64
+	err := h.stmtSelectUptime.QueryRowContext(ctx, nodeID, from.UTC(), to.UTC()).
+		Scan(&uptime.Checks, &healthy)
+	if err != nil {
+		return service.NodeUptime{}, fmt.Errorf("failed to fetch the uptime: %w", wrapError(err))
+	}
+	uptime.Healthy = int(healthy.Int64)
+	return uptime, nil
+}
+
+func (h *NodeCheckHistory) open() (err error) {
+	queryInsert := `
+		INSERT INTO node_check_history (
+			node_id, observer_id, type, checked_at, latency, status, error, healthy
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	h.stmtInsert, err = h.Client.instance.Prepare(queryInsert)
+	if err != nil {
+		return fmt.Errorf("failed to create the insert prepared statement: %w", err)
+	}
+
+	queryCompact := `
+		DELETE FROM node_check_history
+		 WHERE node_id = ?
+		   AND id <= (
+		     SELECT id
+		       FROM node_check_history
+		      WHERE node_id = ?
+		      ORDER BY id DESC
+		      LIMIT 1 OFFSET ?
+		   )
+	`
+	h.stmtCompact, err = h.Client.instance.Prepare(queryCompact)
+	if err != nil {
+		return fmt.Errorf("failed to create the compact prepared statement: %w", err)
+	}
+
+	querySelect := `
+		SELECT id, node_id, observer_id, type, checked_at, latency, status, error, healthy
+		  FROM node_check_history
+		 WHERE node_id = ? AND checked_at >= ? AND checked_at <= ?
+		 ORDER BY checked_at DESC, id DESC
+		 LIMIT ?
+	`
+	h.stmtSelect, err = h.Client.instance.Prepare(querySelect)
+	if err != nil {
+		return fmt.Errorf("failed to create the select prepared statement: %w", err)
+	}
+
+	querySelectUptime := `
+		SELECT COUNT(*), SUM(healthy)
+		  FROM node_check_history
+		 WHERE node_id = ? AND checked_at >= ? AND checked_at <= ?
+	`
+	h.stmtSelectUptime, err = h.Client.instance.Prepare(querySelectUptime)
+	if err != nil {
+		return fmt.Errorf("failed to create the select uptime prepared statement: %w", err)
+	}
+
+	return nil
+}
+
+func (h *NodeCheckHistory) close() (err error) {
+	if err := h.stmtInsert.Close(); err != nil {
+		return fmt.Errorf("failed to close the insert prepared statement: %w", err)
+	}
+
+	if err := h.stmtCompact.Close(); err != nil {
+		return fmt.Errorf("failed to close the compact prepared statement: %w", err)
+	}
+
+	if err := h.stmtSelect.Close(); err != nil {
+		return fmt.Errorf("failed to close the select prepared statement: %w", err)
+	}
+
+	if err := h.stmtSelectUptime.Close(); err != nil {
+		return fmt.Errorf("failed to close the select uptime prepared statement: %w", err)
+	}
+
+	return nil
+}
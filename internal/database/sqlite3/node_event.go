@@ -0,0 +1,181 @@
+package sqlite3
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"malta/internal/service"
+)
+
+// NodeEvent is the append-only audit history of the nodes. The events are kept after the node is
+// deleted.
+type NodeEvent struct {
+	Client *Client
+
+	stmtInsert *sql.Stmt
+}
+
+// Init internal state.
+func (e *NodeEvent) Init() error {
+	if e.Client == nil {
+		return fmt.Errorf("missing client")
+	}
+	return nil
+}
+
+// Insert an event inside the transaction that changed the node.
+func (e *NodeEvent) Insert(tx *sql.Tx, event service.NodeAuditEvent) error {
+	before, err := nodeEventValues(event.Before)
+	if err != nil {
+		return fmt.Errorf("failed to marshal the before values: %w", err)
+	}
+	after, err := nodeEventValues(event.After)
+	if err != nil {
+		return fmt.Errorf("failed to marshal the after values: %w", err)
+	}
+
+	_, err = tx.Stmt(e.stmtInsert).Exec(
+		event.NodeID,
+		string(event.Type),
+		string(event.Actor.Kind),
+		event.Actor.ID,
+		before,
+		after,
+		event.CreatedAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert the node event: %w", wrapError(err))
+	}
+	return nil
+}
+
+// Select the events from the newest to the oldest.
+func (e *NodeEvent) Select(
+	ctx context.Context, query service.NodeAuditQuery,
+) ([]service.NodeAuditEvent, error) {
+	statement, arguments := nodeEventSelectQuery(query)
+	rows, err := e.Client.instance.QueryContext(ctx, statement, arguments...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute the query: %w", wrapError(err))
+	}
+	defer rows.Close()
+
+	var events []service.NodeAuditEvent
+	for rows.Next() {
+		var (
+			event                service.NodeAuditEvent
+			eventType, actorKind string
+			before, after        string
+		)
+		err := rows.Scan(
+			&event.ID,
+			&event.NodeID,
+			&eventType,
+			&actorKind,
+			&event.Actor.ID,
+			&before,
+			&after,
+			&event.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the rows: %w", err)
+		}
+		event.Type = service.NodeAuditEventType(eventType)
+		event.Actor.Kind = service.NodeAuditActorKind(actorKind)
+		if err := json.Unmarshal([]byte(before), &event.Before); err != nil {
+			return nil, fmt.Errorf("failed to parse the before values: %w", err)
+		}
+		if err := json.Unmarshal([]byte(after), &event.After); err != nil {
+			return nil, fmt.Errorf("failed to parse the after values: %w", err)
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to process the rows: %w", err)
+	}
+	return events, nil
+}
+
+func (e *NodeEvent) open() (err error) {
+	queryInsert := `
+		INSERT INTO node_event (node_id, type, actor_kind, actor_id, before, after, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	e.stmtInsert, err = e.Client.instance.Prepare(queryInsert)
+	if err != nil {
+		return fmt.Errorf("failed to create the insert prepared statement: %w", err)
+	}
+
+	return nil
+}
+
+func (e *NodeEvent) close() error {
+	if err := e.stmtInsert.Close(); err != nil {
+		return fmt.Errorf("failed to close the insert prepared statement: %w", err)
+	}
+
+	return nil
+}
+
+func nodeEventValues(values map[string]string) (string, error) {
+	if values == nil {
+		values = make(map[string]string)
+	}
+	payload, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	return string(payload), nil
+}
+
+func nodeEventSelectQuery(query service.NodeAuditQuery) (string, []interface{}) {
+	var (
+		conditions []string
+		arguments  []interface{}
+	)
+	if query.NodeID != 0 {
+		conditions = append(conditions, "node_id = ?")
+		arguments = append(arguments, query.NodeID)
+	}
+	if len(query.Types) > 0 {
+		placeholders := make([]string, len(query.Types))
+		for i, eventType := range query.Types {
+			placeholders[i] = "?"
+			arguments = append(arguments, string(eventType))
+		}
+		conditions = append(conditions, fmt.Sprintf("type IN (%s)", strings.Join(placeholders, ", ")))
+	}
+	if query.ActorKind != "" {
+		conditions = append(conditions, "actor_kind = ?")
+		arguments = append(arguments, string(query.ActorKind))
+	}
+	if !query.From.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		arguments = append(arguments, query.From.UTC())
+	}
+	if !query.To.IsZero() {
+		conditions = append(conditions, "created_at <= ?")
+		arguments = append(arguments, query.To.UTC())
+	}
+	if query.Before != 0 {
+		conditions = append(conditions, "id < ?")
+		arguments = append(arguments, query.Before)
+	}
+
+	statement := `
+		SELECT id, node_id, type, actor_kind, actor_id, before, after, created_at
+		  FROM node_event
+	`
+	if len(conditions) > 0 {
+		statement += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	statement += " ORDER BY id DESC"
+	if query.Limit > 0 {
+		statement += " LIMIT ?"
+		arguments = append(arguments, query.Limit)
+	}
+	return statement, arguments
+}
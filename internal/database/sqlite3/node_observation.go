@@ -0,0 +1,110 @@
+package sqlite3
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"malta/internal/service"
+)
+
+// NodeObservation keeps the last health each observer has seen of the nodes.
+type NodeObservation struct {
+	Client *Client
+
+	stmtSelect *sql.Stmt
+	stmtUpsert *sql.Stmt
+}
+
+// Init internal state.
+func (o *NodeObservation) Init() error {
+	if o.Client == nil {
+		return fmt.Errorf("missing client")
+	}
+	return nil
+}
+
+// Select the observations of a node made since the given time, ordered by the observer.
+func (o *NodeObservation) Select(
+	ctx context.Context, nodeID int, since time.Time,
+) ([]service.NodeObservation, error) {
+	rows, err := o.stmtSelect.QueryContext(ctx, nodeID, since.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute the query: %w", wrapError(err))
+	}
+	defer rows.Close()
+
+	var observations []service.NodeObservation
+	for rows.Next() {
+		var (
+			observation service.NodeObservation
+			health      string
+		)
+		err := rows.Scan(
+			&observation.NodeID, &observation.ObserverID, &health, &observation.ObservedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the rows: %w", err)
+		}
+		observation.Health = service.NodeHealth(health)
+		observations = append(observations, observation)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to process the rows: %w", err)
+	}
+	return observations, nil
+}
+
+// Upsert replace the observation of a node by an observer.
+func (o *NodeObservation) Upsert(ctx context.Context, observation service.NodeObservation) error {
+	_, err := o.stmtUpsert.ExecContext(
+		ctx,
+		observation.NodeID,
+		observation.ObserverID,
+		string(observation.Health),
+		observation.ObservedAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to upsert the observation: %w", wrapError(err))
+	}
+	return nil
+}
+
+func (o *NodeObservation) open() (err error) {
+	querySelect := `
+		SELECT node_id, observer_id, health, observed_at
+		  FROM node_observation
+		 WHERE node_id = ? AND observed_at >= ?
+		 ORDER BY observer_id
+	`
+	o.stmtSelect, err = o.Client.instance.Prepare(querySelect)
+	if err != nil {
+		return fmt.Errorf("failed to create the select prepared statement: %w", err)
+	}
+
+	queryUpsert := `
+		INSERT INTO node_observation (node_id, observer_id, health, observed_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (node_id, observer_id) DO UPDATE
+		SET health = excluded.health,
+		    observed_at = excluded.observed_at
+	`
+	o.stmtUpsert, err = o.Client.instance.Prepare(queryUpsert)
+	if err != nil {
+		return fmt.Errorf("failed to create the upsert prepared statement: %w", err)
+	}
+
+	return nil
+}
+
+func (o *NodeObservation) close() error {
+	if err := o.stmtSelect.Close(); err != nil {
+		return fmt.Errorf("failed to close the select prepared statement: %w", err)
+	}
+
+	if err := o.stmtUpsert.Close(); err != nil {
+		return fmt.Errorf("failed to close the upsert prepared statement: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,217 @@
+package sqlite3
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"malta/internal/service"
+)
+
+// nodeOutboxState is the state of the node written with an outbox event. The check isn't kept, it
+// may have credentials.
+type nodeOutboxState struct {
+	ID              int               `json:"id"`
+	Address         string            `json:"address"`
+	Metadata        map[string]string `json:"metadata,omitempty"`
+	TTL             int64             `json:"ttl,omitempty"`
+	Active          bool              `json:"active"`
+	CreatedAt       time.Time         `json:"createdAt"`
+	Capacity        nodeResources     `json:"capacity"`
+	LastSeen        time.Time         `json:"lastSeen"`
+	ExpiresAt       time.Time         `json:"expiresAt"`
+	ReactivatedAt   time.Time         `json:"reactivatedAt"`
+	Health          string            `json:"health"`
+	HealthChangedAt time.Time         `json:"healthChangedAt"`
+	RegisteredAt    time.Time         `json:"registeredAt"`
+}
+
+// NodeOutbox keeps the changes of the nodes until they're delivered to the subscribers.
+type NodeOutbox struct {
+	Client *Client
+
+	stmtInsert   *sql.Stmt
+	stmtPosition *sql.Stmt
+	stmtSelect   *sql.Stmt
+	stmtCompact  *sql.Stmt
+}
+
+// Init internal state.
+func (o *NodeOutbox) Init() error {
+	if o.Client == nil {
+		return fmt.Errorf("missing client")
+	}
+	return nil
+}
+
+// Insert an event inside the transaction that changed the node.
+func (o *NodeOutbox) Insert(tx *sql.Tx, event service.NodeOutboxEvent) error {
+	node, err := json.Marshal(toNodeOutboxStateRecord(event.Node))
+	if err != nil {
+		return fmt.Errorf("failed to marshal the node: %w", err)
+	}
+	_, err = tx.Stmt(o.stmtInsert).Exec(
+		event.NodeID, string(event.Type), string(event.WatchType), string(node), event.CreatedAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert the outbox event: %w", wrapError(err))
+	}
+	return nil
+}
+
+// Position return the id of the last event, or zero if the outbox is empty.
+func (o *NodeOutbox) Position(ctx context.Context) (int, error) {
+	var position int
+	if err := o.stmtPosition.QueryRowContext(ctx).Scan(&position); err != nil {
+		return 0, fmt.Errorf("failed to fetch the outbox position: %w", wrapError(err))
+	}
+	return position, nil
+}
+
+// Select the events after the given position in the order they were written.
+func (o *NodeOutbox) Select(
+	ctx context.Context, after int, limit int,
+) ([]service.NodeOutboxEvent, error) {
+	rows, err := o.stmtSelect.QueryContext(ctx, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute the query: %w", wrapError(err))
+	}
+	defer rows.Close()
+
+	var events []service.NodeOutboxEvent
+	for rows.Next() {
+		var (
+			event     service.NodeOutboxEvent
+			eventType string
+			watchType string
+			node      []byte
+		)
+		err := rows.Scan(&event.ID, &event.NodeID, &eventType, &watchType, &node, &event.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the rows: %w", err)
+		}
+		var state nodeOutboxState
+		if err := json.Unmarshal(node, &state); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal the node: %w", err)
+		}
+		event.Type = service.NodeEventType(eventType)
+		event.WatchType = service.NodeWatchEventType(watchType)
+		event.Node = fromNodeOutboxStateRecord(state)
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to process the rows: %w", err)
+	}
+	return events, nil
+}
+
+// Compact discard the events written before the given time and already seen by the webhooks.
+func (o *NodeOutbox) Compact(ctx context.Context, before time.Time) error {
+	if _, err := o.stmtCompact.ExecContext(ctx, before.UTC()); err != nil {
+		return fmt.Errorf("failed to compact the outbox: %w", wrapError(err))
+	}
+	return nil
+}
+
+func (o *NodeOutbox) open() (err error) {
+	queryInsert := `
+		INSERT INTO node_outbox (node_id, type, watch_type, node, created_at) VALUES (?, ?, ?, ?, ?)
+	`
+	o.stmtInsert, err = o.Client.instance.Prepare(queryInsert)
+	if err != nil {
+		return fmt.Errorf("failed to create the insert prepared statement: %w", err)
+	}
+
+	// The sequence is used instead of the max id, the ids are never reused even after a compaction.
+	queryPosition := `
+		SELECT COALESCE((SELECT seq FROM sqlite_sequence WHERE name = 'node_outbox'), 0)
+	`
+	o.stmtPosition, err = o.Client.instance.Prepare(queryPosition)
+	if err != nil {
+		return fmt.Errorf("failed to create the position prepared statement: %w", err)
+	}
+
+	querySelect := `
+		SELECT id, node_id, type, watch_type, node, created_at
+		  FROM node_outbox
+		 WHERE id > ?
+		 ORDER BY id
+		 LIMIT ?
+	`
+	o.stmtSelect, err = o.Client.instance.Prepare(querySelect)
+	if err != nil {
+		return fmt.Errorf("failed to create the select prepared statement: %w", err)
+	}
+
+	// The events not yet seen by the webhooks are kept, whatever their age. The webhook position is
+	// the only one persisted, the other subscribers start from the last event.
+	queryCompact := `
+		DELETE FROM node_outbox
+		 WHERE created_at < ?
+		   AND id <= (SELECT position FROM webhook_position WHERE id = 1)
+	`
+	o.stmtCompact, err = o.Client.instance.Prepare(queryCompact)
+	if err != nil {
+		return fmt.Errorf("failed to create the compact prepared statement: %w", err)
+	}
+
+	return nil
+}
+
+func (o *NodeOutbox) close() error {
+	if err := o.stmtInsert.Close(); err != nil {
+		return fmt.Errorf("failed to close the insert prepared statement: %w", err)
+	}
+
+	if err := o.stmtPosition.Close(); err != nil {
+		return fmt.Errorf("failed to close the position prepared statement: %w", err)
+	}
+
+	if err := o.stmtSelect.Close(); err != nil {
+		return fmt.Errorf("failed to close the select prepared statement: %w", err)
+	}
+
+	if err := o.stmtCompact.Close(); err != nil {
+		return fmt.Errorf("failed to close the compact prepared statement: %w", err)
+	}
+
+	return nil
+}
+
+func toNodeOutboxStateRecord(node service.Node) nodeOutboxState {
+	return nodeOutboxState{
+		ID:              node.ID,
+		Address:         node.Address,
+		Metadata:        node.Metadata,
+		TTL:             node.TTL.Nanoseconds(),
+		Active:          node.Active,
+		CreatedAt:       node.CreatedAt.UTC(),
+		Capacity:        toNodeResourcesRecord(node.Capacity),
+		LastSeen:        node.LastSeen.UTC(),
+		ExpiresAt:       node.ExpiresAt.UTC(),
+		ReactivatedAt:   node.ReactivatedAt.UTC(),
+		Health:          string(node.Health),
+		HealthChangedAt: node.HealthChangedAt.UTC(),
+		RegisteredAt:    node.RegisteredAt.UTC(),
+	}
+}
+
+func fromNodeOutboxStateRecord(state nodeOutboxState) service.Node {
+	return service.Node{
+		ID:              state.ID,
+		Address:         state.Address,
+		Metadata:        state.Metadata,
+		TTL:             time.Duration(state.TTL),
+		Active:          state.Active,
+		CreatedAt:       state.CreatedAt,
+		Capacity:        fromNodeResourcesRecord(state.Capacity),
+		LastSeen:        state.LastSeen,
+		ExpiresAt:       state.ExpiresAt,
+		ReactivatedAt:   state.ReactivatedAt,
+		Health:          service.NodeHealth(state.Health),
+		HealthChangedAt: state.HealthChangedAt,
+		RegisteredAt:    state.RegisteredAt,
+	}
+}
@@ -0,0 +1,85 @@
+//go:build sqlite_json
+// +build sqlite_json
+
+package sqlite3
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"malta/internal/service"
+)
+
+func TestNodeOutboxCompact(t *testing.T) {
+	dir, err := ioutil.TempDir("", "malta")
+	if err != nil {
+		t.Fatalf("failed to create the database directory: %s", err)
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+
+	var (
+		client   Client
+		outbox   = NodeOutbox{Client: &client}
+		delivery = WebhookDelivery{Client: &client}
+	)
+	client.Config = ClientConfig{
+		DatabaseFile:        filepath.Join(dir, "malta.sqlite3"),
+		ClientLifecycleHook: []ClientLifecycleHook{&outbox, &delivery},
+	}
+	if err := client.Start(); err != nil {
+		t.Fatalf("failed to start: %s", err)
+	}
+	defer client.Stop() // nolint: errcheck
+
+	ctx := context.Background()
+	createdAt := time.Now().Add(-2 * time.Hour)
+	tx, err := client.Begin(ctx, false, 0)
+	if err != nil {
+		t.Fatalf("failed to begin: %s", err)
+	}
+	for id := 1; id <= 4; id++ {
+		event := service.NodeOutboxEvent{
+			NodeID:    id,
+			Type:      service.NodeEventTypeCreated,
+			WatchType: service.NodeWatchEventTypeCreated,
+			Node:      service.Node{ID: id},
+			CreatedAt: createdAt,
+		}
+		if err := outbox.Insert(tx, event); err != nil {
+			t.Fatalf("failed to insert: %s", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("failed to commit: %s", err)
+	}
+
+	// Only the events past the retention and already seen by the webhooks are discarded.
+	if err := delivery.Advance(ctx, 2); err != nil {
+		t.Fatalf("failed to advance: %s", err)
+	}
+	if err := outbox.Compact(ctx, time.Now().Add(-time.Hour)); err != nil {
+		t.Fatalf("failed to compact: %s", err)
+	}
+	events, err := outbox.Select(ctx, 0, 10)
+	if err != nil {
+		t.Fatalf("failed to select: %s", err)
+	}
+	if len(events) != 2 || events[0].ID != 3 || events[1].ID != 4 {
+		t.Fatalf("expected the events 3 and 4 to be kept, got %+v", events)
+	}
+
+	// The events seen by the webhooks are kept during the retention.
+	if err := delivery.Advance(ctx, 4); err != nil {
+		t.Fatalf("failed to advance: %s", err)
+	}
+	if err := outbox.Compact(ctx, createdAt.Add(-time.Minute)); err != nil {
+		t.Fatalf("failed to compact: %s", err)
+	}
+	if events, err = outbox.Select(ctx, 0, 10); err != nil || len(events) != 2 {
+		t.Fatalf("expected the events to be kept during the retention, got %+v (%v)", events, err)
+	}
+}
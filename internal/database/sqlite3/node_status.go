@@ -0,0 +1,137 @@
+package sqlite3
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"malta/internal/service"
+)
+
+// NodeStatus keeps the last status reported by each node.
+type NodeStatus struct {
+	Client *Client
+
+	stmtSelectOne *sql.Stmt
+	stmtUpsert    *sql.Stmt
+}
+
+type nodeStatusComponent struct {
+	Status string `json:"status"`
+	Output string `json:"output,omitempty"`
+}
+
+// Init internal state.
+func (s *NodeStatus) Init() error {
+	if s.Client == nil {
+		return fmt.Errorf("missing client")
+	}
+	return nil
+}
+
+// SelectOne return the last status reported by the node.
+func (s *NodeStatus) SelectOne(ctx context.Context, nodeID int) (service.NodeStatus, error) {
+	var (
+		status     service.NodeStatus
+		value      string
+		components []byte
+		gauges     []byte
+	)
+	err := s.stmtSelectOne.QueryRowContext(ctx, nodeID).Scan(
+		&status.NodeID, &value, &components, &gauges, &status.ReportedAt,
+	)
+	if err != nil {
+		return service.NodeStatus{}, fmt.Errorf("failed to fetch the status: %w", wrapError(err))
+	}
+	status.Status = service.NodeStatusValue(value)
+
+	var rawComponents map[string]nodeStatusComponent
+	if err := json.Unmarshal(components, &rawComponents); err != nil {
+		return service.NodeStatus{}, fmt.Errorf("failed to unmarshal the components: %w", err)
+	}
+	status.Components = make(map[string]service.NodeStatusComponent, len(rawComponents))
+	for name, component := range rawComponents {
+		status.Components[name] = service.NodeStatusComponent{
+			Status: service.NodeStatusValue(component.Status),
+			Output: component.Output,
+		}
+	}
+
+	if err := json.Unmarshal(gauges, &status.Gauges); err != nil {
+		return service.NodeStatus{}, fmt.Errorf("failed to unmarshal the gauges: %w", err)
+	}
+	return status, nil
+}
+
+// Upsert replace the status of the node.
+func (s *NodeStatus) Upsert(ctx context.Context, status service.NodeStatus) error {
+	rawComponents := make(map[string]nodeStatusComponent, len(status.Components))
+	for name, component := range status.Components {
+		rawComponents[name] = nodeStatusComponent{
+			Status: string(component.Status),
+			Output: component.Output,
+		}
+	}
+	components, err := json.Marshal(rawComponents)
+	if err != nil {
+		return fmt.Errorf("failed to marshal the components: %w", err)
+	}
+
+	gauges := status.Gauges
+	if gauges == nil {
+		gauges = make(map[string]float64)
+	}
+	rawGauges, err := json.Marshal(gauges)
+	if err != nil {
+		return fmt.Errorf("failed to marshal the gauges: %w", err)
+	}
+
+	_, err = s.stmtUpsert.ExecContext(
+		ctx, status.NodeID, string(status.Status), components, rawGauges, status.ReportedAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to upsert the status: %w", wrapError(err))
+	}
+	return nil
+}
+
+func (s *NodeStatus) open() (err error) {
+	querySelectOne := `
+		SELECT node_id, status, components, gauges, reported_at
+		  FROM node_status
+		 WHERE node_id = ?
+	`
+	s.stmtSelectOne, err = s.Client.instance.Prepare(querySelectOne)
+	if err != nil {
+		return fmt.Errorf("failed to create the select one prepared statement: %w", err)
+	}
+
+	queryUpsert := `
+		INSERT INTO node_status (node_id, status, components, gauges, reported_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (node_id) DO UPDATE
+		SET status = excluded.status,
+		    components = excluded.components,
+		    gauges = excluded.gauges,
+		    reported_at = excluded.reported_at
+	`
+	s.stmtUpsert, err = s.Client.instance.Prepare(queryUpsert)
+	if err != nil {
+		return fmt.Errorf("failed to create the upsert prepared statement: %w", err)
+	}
+
+	return nil
+}
+
+func (s *NodeStatus) close() error {
+	if err := s.stmtSelectOne.Close(); err != nil {
+		return fmt.Errorf("failed to close the select one prepared statement: %w", err)
+	}
+
+	if err := s.stmtUpsert.Close(); err != nil {
+		return fmt.Errorf("failed to close the upsert prepared statement: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,167 @@
+package sqlite3
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"malta/internal/service"
+)
+
+const (
+	webhookColumns             = "id, url, events, secret, created_at"
+	queryDeleteWebhookDelivery = "DELETE FROM webhook_delivery WHERE webhook_id = ?"
+	queryDeleteWebhook         = "DELETE FROM webhook WHERE id = ?"
+)
+
+// Webhook keeps the subscriptions to the node changes.
+type Webhook struct {
+	Client *Client
+
+	stmtSelect    *sql.Stmt
+	stmtSelectOne *sql.Stmt
+	stmtInsert    *sql.Stmt
+}
+
+// Init internal state.
+func (w *Webhook) Init() error {
+	if w.Client == nil {
+		return fmt.Errorf("missing client")
+	}
+	return nil
+}
+
+// Select all the webhooks.
+func (w *Webhook) Select(ctx context.Context) ([]service.Webhook, error) {
+	rows, err := w.stmtSelect.QueryContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute the query: %w", wrapError(err))
+	}
+	defer rows.Close()
+
+	var webhooks []service.Webhook
+	for rows.Next() {
+		webhook, err := webhookScan(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to process the rows: %w", err)
+	}
+	return webhooks, nil
+}
+
+// SelectOne return a webhook.
+func (w *Webhook) SelectOne(ctx context.Context, id int) (service.Webhook, error) {
+	webhook, err := webhookScan(w.stmtSelectOne.QueryRowContext(ctx, id))
+	if err != nil {
+		return service.Webhook{}, err
+	}
+	return webhook, nil
+}
+
+// Insert a webhook.
+func (w *Webhook) Insert(ctx context.Context, webhook service.Webhook) (service.Webhook, error) {
+	events := make([]string, 0, len(webhook.Events))
+	for _, event := range webhook.Events {
+		events = append(events, string(event))
+	}
+	rawEvents, err := json.Marshal(events)
+	if err != nil {
+		return service.Webhook{}, fmt.Errorf("failed to marshal the events: %w", err)
+	}
+
+	result, err := w.stmtInsert.ExecContext(
+		ctx, webhook.URL, rawEvents, webhook.Secret, webhook.CreatedAt.UTC(),
+	)
+	if err != nil {
+		return service.Webhook{}, fmt.Errorf("failed to insert the webhook: %w", wrapError(err))
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return service.Webhook{}, fmt.Errorf("failed to fetch the webhook id: %w", err)
+	}
+	webhook.ID = int(id)
+	return webhook, nil
+}
+
+// Delete a webhook together with its deliveries.
+func (w *Webhook) Delete(tx *sql.Tx, id int) error {
+	if _, err := tx.Exec(queryDeleteWebhookDelivery, id); err != nil {
+		return fmt.Errorf("failed to delete the webhook deliveries: %w", wrapError(err))
+	}
+
+	result, err := tx.Exec(queryDeleteWebhook, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete the webhook: %w", wrapError(err))
+	}
+	affectedRows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check if the row was deleted: %w", err)
+	}
+	if affectedRows != 1 {
+		return errAffectedRows(affectedRows)
+	}
+	return nil
+}
+
+func (w *Webhook) open() (err error) {
+	querySelect := "SELECT " + webhookColumns + " FROM webhook ORDER BY id"
+	w.stmtSelect, err = w.Client.instance.Prepare(querySelect)
+	if err != nil {
+		return fmt.Errorf("failed to create the select prepared statement: %w", err)
+	}
+
+	querySelectOne := "SELECT " + webhookColumns + " FROM webhook WHERE id = ?"
+	w.stmtSelectOne, err = w.Client.instance.Prepare(querySelectOne)
+	if err != nil {
+		return fmt.Errorf("failed to create the select one prepared statement: %w", err)
+	}
+
+	queryInsert := "INSERT INTO webhook (url, events, secret, created_at) VALUES (?, ?, ?, ?)"
+	w.stmtInsert, err = w.Client.instance.Prepare(queryInsert)
+	if err != nil {
+		return fmt.Errorf("failed to create the insert prepared statement: %w", err)
+	}
+
+	return nil
+}
+
+func (w *Webhook) close() error {
+	if err := w.stmtSelect.Close(); err != nil {
+		return fmt.Errorf("failed to close the select prepared statement: %w", err)
+	}
+
+	if err := w.stmtSelectOne.Close(); err != nil {
+		return fmt.Errorf("failed to close the select one prepared statement: %w", err)
+	}
+
+	if err := w.stmtInsert.Close(); err != nil {
+		return fmt.Errorf("failed to close the insert prepared statement: %w", err)
+	}
+
+	return nil
+}
+
+func webhookScan(row interface{ Scan(...interface{}) error }) (service.Webhook, error) {
+	var (
+		webhook service.Webhook
+		events  []byte
+	)
+	err := row.Scan(&webhook.ID, &webhook.URL, &events, &webhook.Secret, &webhook.CreatedAt)
+	if err != nil {
+		return service.Webhook{}, fmt.Errorf("failed to scan the webhook: %w", wrapError(err))
+	}
+
+	var rawEvents []string
+	if err := json.Unmarshal(events, &rawEvents); err != nil {
+		return service.Webhook{}, fmt.Errorf("failed to unmarshal the events: %w", err)
+	}
+	for _, event := range rawEvents {
+		webhook.Events = append(webhook.Events, service.NodeWatchEventType(event))
+	}
+	return webhook, nil
+}
@@ -0,0 +1,317 @@
+package sqlite3
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"malta/internal/service"
+)
+
+const webhookDeliveryColumns = `
+	id, webhook_id, event, node_id, key, payload, status, attempts, next_attempt_at, last_status,
+	last_error, created_at, updated_at
+`
+
+// WebhookDelivery keeps the deliveries of the node changes to the webhooks. It's both the queue of
+// the pending deliveries and the log of the finished ones.
+type WebhookDelivery struct {
+	Client *Client
+
+	stmtInsert    *sql.Stmt
+	stmtSelect    *sql.Stmt
+	stmtSelectDue *sql.Stmt
+	stmtClaim     *sql.Stmt
+	stmtUpdate    *sql.Stmt
+	stmtCompact   *sql.Stmt
+	stmtPosition  *sql.Stmt
+	stmtAdvance   *sql.Stmt
+}
+
+// Init internal state.
+func (d *WebhookDelivery) Init() error {
+	if d.Client == nil {
+		return fmt.Errorf("missing client")
+	}
+	return nil
+}
+
+// Insert a delivery. It's false if the same change was already queued to the webhook.
+func (d *WebhookDelivery) Insert(ctx context.Context, delivery service.WebhookDelivery) (bool, error) {
+	result, err := d.stmtInsert.ExecContext(
+		ctx,
+		delivery.WebhookID,
+		string(delivery.Event),
+		delivery.NodeID,
+		delivery.Key,
+		delivery.Payload,
+		string(delivery.Status),
+		delivery.NextAttemptAt.UTC(),
+		delivery.CreatedAt.UTC(),
+		delivery.UpdatedAt.UTC(),
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to insert the delivery: %w", wrapError(err))
+	}
+	affectedRows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to check if the row was inserted: %w", err)
+	}
+	return affectedRows == 1, nil
+}
+
+// Select the deliveries of a webhook from the newest to the oldest.
+func (d *WebhookDelivery) Select(
+	ctx context.Context, webhookID int, limit int,
+) ([]service.WebhookDelivery, error) {
+	return d.query(ctx, d.stmtSelect, webhookID, limit)
+}
+
+// SelectDue select the pending deliveries that should be attempted.
+func (d *WebhookDelivery) SelectDue(
+	ctx context.Context, now time.Time, limit int,
+) ([]service.WebhookDelivery, error) {
+	return d.query(ctx, d.stmtSelectDue, now.UTC(), limit)
+}
+
+// Claim a due delivery until the given time, this way only one server attempts it. It's false if
+// the delivery was claimed by someone else.
+func (d *WebhookDelivery) Claim(ctx context.Context, id int, now, until time.Time) (bool, error) {
+	result, err := d.stmtClaim.ExecContext(ctx, until.UTC(), id, now.UTC())
+	if err != nil {
+		return false, fmt.Errorf("failed to claim the delivery: %w", wrapError(err))
+	}
+	affectedRows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to check if the row was updated: %w", err)
+	}
+	return affectedRows == 1, nil
+}
+
+// Update the state of a delivery after an attempt.
+func (d *WebhookDelivery) Update(ctx context.Context, delivery service.WebhookDelivery) error {
+	var lastError sql.NullString
+	if delivery.LastError != "" {
+		lastError = sql.NullString{String: delivery.LastError, Valid: true}
+	}
+
+	result, err := d.stmtUpdate.ExecContext(
+		ctx,
+		string(delivery.Status),
+		delivery.Attempts,
+		delivery.NextAttemptAt.UTC(),
+		delivery.LastStatus,
+		lastError,
+		delivery.UpdatedAt.UTC(),
+		delivery.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update the delivery: %w", wrapError(err))
+	}
+	affectedRows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check if the row was updated: %w", err)
+	}
+	if affectedRows != 1 {
+		return errAffectedRows(affectedRows)
+	}
+	return nil
+}
+
+// Compact discard the finished deliveries of a webhook beyond the given size.
+func (d *WebhookDelivery) Compact(ctx context.Context, webhookID int, size int) error {
+	if _, err := d.stmtCompact.ExecContext(ctx, webhookID, webhookID, size); err != nil {
+		return fmt.Errorf("failed to compact the deliveries: %w", wrapError(err))
+	}
+	return nil
+}
+
+func (d *WebhookDelivery) query(
+	ctx context.Context, stmt *sql.Stmt, args ...interface{},
+) ([]service.WebhookDelivery, error) {
+	rows, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute the query: %w", wrapError(err))
+	}
+	defer rows.Close()
+
+	var deliveries []service.WebhookDelivery
+	for rows.Next() {
+		var (
+			delivery  service.WebhookDelivery
+			event     string
+			status    string
+			lastError sql.NullString
+		)
+		err := rows.Scan(
+			&delivery.ID,
+			&delivery.WebhookID,
+			&event,
+			&delivery.NodeID,
+			&delivery.Key,
+			&delivery.Payload,
+			&status,
+			&delivery.Attempts,
+			&delivery.NextAttemptAt,
+			&delivery.LastStatus,
+			&lastError,
+			&delivery.CreatedAt,
+			&delivery.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the rows: %w", err)
+		}
+		delivery.Event = service.NodeWatchEventType(event)
+		delivery.Status = service.WebhookDeliveryStatus(status)
+		delivery.LastError = lastError.String
+		deliveries = append(deliveries, delivery)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to process the rows: %w", err)
+	}
+	return deliveries, nil
+}
+
+// Position return the id of the last outbox event queued to the webhooks.
+func (d *WebhookDelivery) Position(ctx context.Context) (int, error) {
+	var position int
+	if err := d.stmtPosition.QueryRowContext(ctx).Scan(&position); err != nil {
+		return 0, fmt.Errorf("failed to fetch the position: %w", wrapError(err))
+	}
+	return position, nil
+}
+
+// Advance the position to the given outbox event. The position never moves backwards, so the servers
+// sharing the database can advance it concurrently.
+func (d *WebhookDelivery) Advance(ctx context.Context, position int) error {
+	if _, err := d.stmtAdvance.ExecContext(ctx, position, position); err != nil {
+		return fmt.Errorf("failed to advance the position: %w", wrapError(err))
+	}
+	return nil
+}
+
+func (d *WebhookDelivery) open() (err error) {
+	queryInsert := `
+		INSERT INTO webhook_delivery (
+			webhook_id, event, node_id, key, payload, status, next_attempt_at, created_at, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (webhook_id, key) DO NOTHING
+	`
+	d.stmtInsert, err = d.Client.instance.Prepare(queryInsert)
+	if err != nil {
+		return fmt.Errorf("failed to create the insert prepared statement: %w", err)
+	}
+
+	querySelect := `
+		SELECT ` + webhookDeliveryColumns + `
+		  FROM webhook_delivery
+		 WHERE webhook_id = ?
+		 ORDER BY id DESC
+		 LIMIT ?
+	`
+	d.stmtSelect, err = d.Client.instance.Prepare(querySelect)
+	if err != nil {
+		return fmt.Errorf("failed to create the select prepared statement: %w", err)
+	}
+
+	querySelectDue := `
+		SELECT ` + webhookDeliveryColumns + `
+		  FROM webhook_delivery
+		 WHERE status = 'pending' AND next_attempt_at <= ?
+		 ORDER BY next_attempt_at, id
+		 LIMIT ?
+	`
+	d.stmtSelectDue, err = d.Client.instance.Prepare(querySelectDue)
+	if err != nil {
+		return fmt.Errorf("failed to create the select due prepared statement: %w", err)
+	}
+
+	queryClaim := `
+		UPDATE webhook_delivery
+		   SET next_attempt_at = ?
+		 WHERE id = ? AND status = 'pending' AND next_attempt_at <= ?
+	`
+	d.stmtClaim, err = d.Client.instance.Prepare(queryClaim)
+	if err != nil {
+		return fmt.Errorf("failed to create the claim prepared statement: %w", err)
+	}
+
+	queryUpdate := `
+		UPDATE webhook_delivery
+		   SET status = ?, attempts = ?, next_attempt_at = ?, last_status = ?, last_error = ?,
+		       updated_at = ?
+		 WHERE id = ?
+	`
+	d.stmtUpdate, err = d.Client.instance.Prepare(queryUpdate)
+	if err != nil {
+		return fmt.Errorf("failed to create the update prepared statement: %w", err)
+	}
+
+	queryCompact := `
+		DELETE FROM webhook_delivery
+		 WHERE webhook_id = ?
+		   AND status != 'pending'
+		   AND id <= (
+		     SELECT id
+		       FROM webhook_delivery
+		      WHERE webhook_id = ?
+		      ORDER BY id DESC
+		      LIMIT 1 OFFSET ?
+		   )
+	`
+	d.stmtCompact, err = d.Client.instance.Prepare(queryCompact)
+	if err != nil {
+		return fmt.Errorf("failed to create the compact prepared statement: %w", err)
+	}
+
+	queryPosition := "SELECT position FROM webhook_position WHERE id = 1"
+	d.stmtPosition, err = d.Client.instance.Prepare(queryPosition)
+	if err != nil {
+		return fmt.Errorf("failed to create the position prepared statement: %w", err)
+	}
+
+	queryAdvance := "UPDATE webhook_position SET position = ? WHERE id = 1 AND position < ?"
+	d.stmtAdvance, err = d.Client.instance.Prepare(queryAdvance)
+	if err != nil {
+		return fmt.Errorf("failed to create the advance prepared statement: %w", err)
+	}
+
+	return nil
+}
+
+func (d *WebhookDelivery) close() error {
+	if err := d.stmtInsert.Close(); err != nil {
+		return fmt.Errorf("failed to close the insert prepared statement: %w", err)
+	}
+
+	if err := d.stmtSelect.Close(); err != nil {
+		return fmt.Errorf("failed to close the select prepared statement: %w", err)
+	}
+
+	if err := d.stmtSelectDue.Close(); err != nil {
+		return fmt.Errorf("failed to close the select due prepared statement: %w", err)
+	}
+
+	if err := d.stmtClaim.Close(); err != nil {
+		return fmt.Errorf("failed to close the claim prepared statement: %w", err)
+	}
+
+	if err := d.stmtUpdate.Close(); err != nil {
+		return fmt.Errorf("failed to close the update prepared statement: %w", err)
+	}
+
+	if err := d.stmtCompact.Close(); err != nil {
+		return fmt.Errorf("failed to close the compact prepared statement: %w", err)
+	}
+
+	if err := d.stmtPosition.Close(); err != nil {
+		return fmt.Errorf("failed to close the position prepared statement: %w", err)
+	}
+
+	if err := d.stmtAdvance.Close(); err != nil {
+		return fmt.Errorf("failed to close the advance prepared statement: %w", err)
+	}
+
+	return nil
+}
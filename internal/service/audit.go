@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"time"
+)
+
+// NodeAuditEventType is the kind of state change recorded at the audit history of a node.
+type NodeAuditEventType string
+
+// State changes recorded at the audit history. An update is a change of the address, check or
+// metadata made through the API.
+const (
+	NodeAuditEventTypeRegistered    NodeAuditEventType = "registered"
+	NodeAuditEventTypeUpdated       NodeAuditEventType = "updated"
+	NodeAuditEventTypeHealthChanged NodeAuditEventType = "health-changed"
+	NodeAuditEventTypeActivated     NodeAuditEventType = "activated"
+	NodeAuditEventTypeDeactivated   NodeAuditEventType = "deactivated"
+	NodeAuditEventTypeDeleted       NodeAuditEventType = "deleted"
+)
+
+// Valid check if the event type is known.
+func (t NodeAuditEventType) Valid() bool {
+	switch t {
+	case NodeAuditEventTypeRegistered, NodeAuditEventTypeUpdated, NodeAuditEventTypeHealthChanged,
+		NodeAuditEventTypeActivated, NodeAuditEventTypeDeactivated, NodeAuditEventTypeDeleted:
+		return true
+	default:
+		return false
+	}
+}
+
+// NodeAuditActorKind is who made a change.
+type NodeAuditActorKind string
+
+// Actors that change the nodes.
+const (
+	NodeAuditActorKindAPI    NodeAuditActorKind = "api"
+	NodeAuditActorKindHealth NodeAuditActorKind = "health"
+	NodeAuditActorKindReaper NodeAuditActorKind = "reaper"
+)
+
+// Valid check if the actor kind is known.
+func (k NodeAuditActorKind) Valid() bool {
+	switch k {
+	case NodeAuditActorKindAPI, NodeAuditActorKindHealth, NodeAuditActorKindReaper:
+		return true
+	default:
+		return false
+	}
+}
+
+// NodeAuditActor identifies who made a change. ID is the remote address of an API caller and the
+// observer of the health checker.
+type NodeAuditActor struct {
+	Kind NodeAuditActorKind
+	ID   string
+}
+
+// NodeAuditEvent is a state change of a node. Before and After only have the fields that changed,
+// flattened into keys like 'health', 'metadata.zone' or 'check.http.path'. A field missing at one
+// side was empty.
+type NodeAuditEvent struct {
+	ID        int
+	NodeID    int
+	Type      NodeAuditEventType
+	Actor     NodeAuditActor
+	Before    map[string]string
+	After     map[string]string
+	CreatedAt time.Time
+}
+
+type nodeAuditActorKey struct{}
+
+// WithNodeAuditActor return a context that records the changes made with it as done by the actor.
+func WithNodeAuditActor(ctx context.Context, actor NodeAuditActor) context.Context {
+	return context.WithValue(ctx, nodeAuditActorKey{}, actor)
+}
+
+// NodeAuditActorFrom return the actor of the context, the boolean is false if it has none.
+func NodeAuditActorFrom(ctx context.Context) (NodeAuditActor, bool) {
+	actor, ok := ctx.Value(nodeAuditActorKey{}).(NodeAuditActor)
+	return actor, ok
+}
@@ -0,0 +1,150 @@
+package service
+
+import "time"
+
+// NodeResources is an amount of the resources of a node.
+type NodeResources struct {
+	// CPU in millicores, 1000 is a full core.
+	CPU int64
+
+	// Memory and Disk in bytes.
+	Memory int64
+	Disk   int64
+
+	// Slots is the number of tasks the node can run at the same time.
+	Slots int64
+
+	// Custom has arbitrary countable resources like GPUs or licenses.
+	Custom map[string]int64
+}
+
+// Add return the sum of both resources.
+func (r NodeResources) Add(other NodeResources) NodeResources {
+	result := NodeResources{
+		CPU:    r.CPU + other.CPU,
+		Memory: r.Memory + other.Memory,
+		Disk:   r.Disk + other.Disk,
+		Slots:  r.Slots + other.Slots,
+		Custom: make(map[string]int64, len(r.Custom)),
+	}
+	for name, value := range r.Custom {
+		result.Custom[name] = value
+	}
+	for name, value := range other.Custom {
+		result.Custom[name] += value
+	}
+	return result
+}
+
+// Sub return the resources left after the other is taken. The values are negative when the other
+// is greater.
+func (r NodeResources) Sub(other NodeResources) NodeResources {
+	negative := NodeResources{
+		CPU:    -other.CPU,
+		Memory: -other.Memory,
+		Disk:   -other.Disk,
+		Slots:  -other.Slots,
+		Custom: make(map[string]int64, len(other.Custom)),
+	}
+	for name, value := range other.Custom {
+		negative.Custom[name] = -value
+	}
+	return r.Add(negative)
+}
+
+// Exceeded return the name of the resources that are greater than the limit. A custom resource the
+// limit doesn't have is zero at the limit.
+func (r NodeResources) Exceeded(limit NodeResources) []string {
+	var names []string
+	if r.CPU > limit.CPU {
+		names = append(names, "cpu")
+	}
+	if r.Memory > limit.Memory {
+		names = append(names, "memory")
+	}
+	if r.Disk > limit.Disk {
+		names = append(names, "disk")
+	}
+	if r.Slots > limit.Slots {
+		names = append(names, "slots")
+	}
+	for name, value := range r.Custom {
+		if value > limit.Custom[name] {
+			names = append(names, "resources."+name)
+		}
+	}
+	return names
+}
+
+// Validate check if the resources aren't negative and the custom resources have a name.
+func (r NodeResources) Validate(field string) error {
+	fields := make(map[string]string)
+	check := func(name string, value int64) {
+		if value < 0 {
+			fields[field+"."+name] = "can't be negative"
+		}
+	}
+	check("cpu", r.CPU)
+	check("memory", r.Memory)
+	check("disk", r.Disk)
+	check("slots", r.Slots)
+	for name, value := range r.Custom {
+		if name == "" {
+			fields[field+".resources"] = "empty resource name"
+			continue
+		}
+		check("resources."+name, value)
+	}
+	if len(fields) > 0 {
+		return ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+// IsZero check if there is no resource at all.
+func (r NodeResources) IsZero() bool {
+	if r.CPU != 0 || r.Memory != 0 || r.Disk != 0 || r.Slots != 0 {
+		return false
+	}
+	for _, value := range r.Custom {
+		if value != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// NodeAllocation is a share of the capacity of a node taken by a task.
+type NodeAllocation struct {
+	// ID is unique per node, usually the id of the task.
+	ID        string
+	NodeID    int
+	Resources NodeResources
+	CreatedAt time.Time
+}
+
+// NodeCapacity has the capacity of a node and how much of it is allocated.
+type NodeCapacity struct {
+	NodeID      int
+	Address     string
+	Allocatable NodeResources
+	Allocated   NodeResources
+}
+
+// Available return the capacity that is not allocated. It's negative if the capacity of the node
+// was lowered below what is allocated.
+func (c NodeCapacity) Available() NodeResources {
+	return c.Allocatable.Sub(c.Allocated)
+}
+
+// ClusterCapacity has the capacity of the active nodes of the cluster.
+type ClusterCapacity struct {
+	Allocatable NodeResources
+	Allocated   NodeResources
+	Nodes       []NodeCapacity
+}
+
+// Available return the capacity of the cluster that is not allocated.
+func (c ClusterCapacity) Available() NodeResources {
+	return c.Allocatable.Sub(c.Allocated)
+}
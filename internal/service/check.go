@@ -0,0 +1,117 @@
+package service
+
+import "time"
+
+// NodeCheckType is the protocol used to check the health of a node.
+type NodeCheckType string
+
+// Protocols available to check the health of the nodes.
+const (
+	NodeCheckTypeHTTP NodeCheckType = "http"
+	NodeCheckTypeTCP  NodeCheckType = "tcp"
+	NodeCheckTypeExec NodeCheckType = "exec"
+	NodeCheckTypeGRPC NodeCheckType = "grpc"
+
+	// NodeCheckTypeStatus doesn't probe the node, the status reported by the node is used instead.
+	NodeCheckTypeStatus NodeCheckType = "status"
+)
+
+// Valid check if the type is known.
+func (t NodeCheckType) Valid() bool {
+	switch t {
+	case NodeCheckTypeHTTP, NodeCheckTypeTCP, NodeCheckTypeExec, NodeCheckTypeGRPC,
+		NodeCheckTypeStatus:
+		return true
+	default:
+		return false
+	}
+}
+
+// NodeCheck describes how the health of a node is checked.
+type NodeCheck struct {
+	// Type of the check, the default is HTTP.
+	Type NodeCheckType
+
+	// Service name sent at the gRPC health protocol, if empty the server health is checked.
+	GRPCService string
+
+	// GracePeriod after the registration where the failed checks are not counted. It overrides the
+	// default grace period if not zero.
+	GracePeriod time.Duration
+
+	// HTTP overrides the default HTTP check options.
+	HTTP NodeCheckHTTP
+}
+
+// NodeCheckHTTP has the options of the HTTP check. Empty fields fallback to the defaults.
+type NodeCheckHTTP struct {
+	Path    string
+	Method  string
+	Headers map[string]string
+
+	// Statuses accepted as healthy, each one is either a status code like '204' or a range like
+	// '200-299'.
+	Statuses []string
+
+	// BodyRegex should match the response body.
+	BodyRegex string
+
+	// BodyJSONPath is a path like '$.status' or '$.checks[0].state' to a value at the response body.
+	// If BodyJSONValue is empty the value just needs to exist, otherwise they should be equal.
+	BodyJSONPath  string
+	BodyJSONValue string
+}
+
+// NodeCheckCounter has the counters used to move a node between the health states.
+type NodeCheckCounter struct {
+	// Failures since the node was last healthy.
+	Failures int
+
+	// Consecutive successful checks.
+	Successes int
+
+	// Outcomes of the most recent checks from the oldest to the newest, true means healthy.
+	Outcomes []bool
+}
+
+// NodeCheckResult is the outcome of a single check of a node.
+type NodeCheckResult struct {
+	ID         int
+	NodeID     int
+	ObserverID string
+	Type       NodeCheckType
+	CheckedAt  time.Time
+	Latency    time.Duration
+
+	// Status reported by the checker, like the HTTP status or the command exit code.
+	Status int
+
+	// Error is empty when the node is healthy.
+	Error   string
+	Healthy bool
+}
+
+// NodeObservation is the health of a node as seen by one of the observers. Each malta server
+// sharing the database is an observer with its own view of the nodes.
+type NodeObservation struct {
+	NodeID     int
+	ObserverID string
+	Health     NodeHealth
+	ObservedAt time.Time
+}
+
+// NodeUptime is the quantity of healthy checks of a node over a period.
+type NodeUptime struct {
+	From    time.Time
+	To      time.Time
+	Checks  int
+	Healthy int
+}
+
+// Percentage of healthy checks, it's zero if the node was not checked during the period.
+func (u NodeUptime) Percentage() float64 {
+	if u.Checks == 0 {
+		return 0
+	}
+	return float64(u.Healthy) * 100 / float64(u.Checks)
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrorKind is used to classify the errors.
+type ErrorKind uint8
+
+// Kinds of errors returned by the services.
+const (
+	ErrorKindUnknown ErrorKind = iota
+	ErrorKindNotFound
+	ErrorKindValidation
+	ErrorKindConflict
+	ErrorKindUnavailable
+)
+
+// Error has a kind that describes the reason of the failure.
+type Error struct {
+	Kind ErrorKind
+	Err  error
+}
+
+// NewError create an error of the given kind.
+func NewError(kind ErrorKind, format string, args ...interface{}) error {
+	return Error{Kind: kind, Err: fmt.Errorf(format, args...)}
+}
+
+func (e Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap return the underlying error.
+func (e Error) Unwrap() error {
+	return e.Err
+}
+
+// ErrorKindOf return the kind of the first classified error in the chain.
+func ErrorKindOf(err error) ErrorKind {
+	var verr ValidationError
+	if errors.As(err, &verr) {
+		return ErrorKindValidation
+	}
+
+	var serr Error
+	if errors.As(err, &serr) {
+		return serr.Kind
+	}
+	return ErrorKindUnknown
+}
+
+// ValidationError is returned when the input has invalid fields.
+type ValidationError struct {
+	// Fields has the name of each invalid field and the reason.
+	Fields map[string]string
+}
+
+func (e ValidationError) Error() string {
+	fields := make([]string, 0, len(e.Fields))
+	for field, reason := range e.Fields {
+		fields = append(fields, fmt.Sprintf("%s: %s", field, reason))
+	}
+	sort.Strings(fields)
+	return fmt.Sprintf("invalid fields (%s)", strings.Join(fields, ", "))
+}
+
+// FieldErrors return the invalid fields.
+func (e ValidationError) FieldErrors() map[string]string {
+	return e.Fields
+}
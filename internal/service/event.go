@@ -0,0 +1,80 @@
+package service
+
+import "time"
+
+// NodeEventType is the kind of change of a node.
+type NodeEventType string
+
+// Changes a node can go through.
+const (
+	NodeEventTypeCreated NodeEventType = "created"
+	NodeEventTypeUpdated NodeEventType = "updated"
+	NodeEventTypeDeleted NodeEventType = "deleted"
+)
+
+// NodeEvent describes a change of a node. Node is the state after the change, or the last known
+// state if the node was deleted, and Previous is the state before the change. Revision is the id of
+// the outbox event of the change, it's zero if the change was found by reloading the nodes.
+type NodeEvent struct {
+	Type     NodeEventType
+	Node     Node
+	Previous Node
+	Revision uint64
+}
+
+// NodeOutboxEvent is a change of a node written to the outbox in the same transaction as the
+// change. Node is the state after the change without the check, or the last state if the node was
+// deleted, and WatchType is the change seen by the watchers, it's empty if only the lease was
+// renewed. The subscribers that need the latest state should load it, this way an event can be
+// delivered more than once.
+type NodeOutboxEvent struct {
+	ID        int
+	NodeID    int
+	Type      NodeEventType
+	WatchType NodeWatchEventType
+	Node      Node
+	CreatedAt time.Time
+}
+
+// NodeWatchEventType is the kind of change delivered to the watchers of the nodes.
+type NodeWatchEventType string
+
+// Changes delivered to the watchers. A deactivated event is an update that disabled the node.
+const (
+	NodeWatchEventTypeCreated     NodeWatchEventType = "created"
+	NodeWatchEventTypeUpdated     NodeWatchEventType = "updated"
+	NodeWatchEventTypeDeactivated NodeWatchEventType = "deactivated"
+	NodeWatchEventTypeDeleted     NodeWatchEventType = "deleted"
+)
+
+// Valid check if the watch event type is known.
+func (t NodeWatchEventType) Valid() bool {
+	switch t {
+	case NodeWatchEventTypeCreated, NodeWatchEventTypeUpdated, NodeWatchEventTypeDeactivated,
+		NodeWatchEventTypeDeleted:
+		return true
+	default:
+		return false
+	}
+}
+
+// NodeWatchEvent is a change of a node identified by a revision. The revisions always increase, so
+// a watcher can resume from the last revision it has seen.
+type NodeWatchEvent struct {
+	Revision uint64
+	Type     NodeWatchEventType
+	Node     Node
+}
+
+// NodeWatch is a subscription to the changes of the nodes. If the watch couldn't be resumed,
+// Snapshot has the nodes at the Revision and Backlog is empty. Otherwise Backlog has the events
+// missed since the requested revision. The new events are then delivered at Events, which is
+// closed if the watch is too slow to keep up or the watcher stops.
+type NodeWatch struct {
+	Revision uint64
+	Snapshot []Node
+	Resumed  bool
+	Backlog  []NodeWatchEvent
+	Events   <-chan NodeWatchEvent
+	Close    func()
+}
@@ -8,6 +8,63 @@ type Node struct {
 	Address   string
 	Metadata  map[string]string
 	TTL       time.Duration
+	Check     NodeCheck
 	Active    bool
 	CreatedAt time.Time
+
+	// Capacity is what the node can allocate to the tasks.
+	Capacity NodeResources
+
+	// LastSeen is the last time the node registered or renewed its lease.
+	LastSeen time.Time
+
+	// ExpiresAt is when the node lease expires. It's zero if the node doesn't have a lease.
+	ExpiresAt time.Time
+
+	// ReactivatedAt is the last time the node was enabled after recovering from failures.
+	ReactivatedAt time.Time
+
+	// Health is the state of the node at the health checks.
+	Health NodeHealth
+
+	// HealthChangedAt is the last time the health state changed.
+	HealthChangedAt time.Time
+
+	// RegisteredAt is the last time the node was registered, the grace period starts from it.
+	RegisteredAt time.Time
+}
+
+// NodeHealth is the state of a node at the health checks.
+type NodeHealth string
+
+// Health states of the nodes. A healthy node that fails a check becomes suspect and, once it reaches
+// the failure threshold, unhealthy and inactive. An unhealthy node that passes a check is recovering
+// until it reaches the success threshold and is healthy and active again. A pending node is inactive
+// until the first successful check.
+const (
+	NodeHealthPending    NodeHealth = "pending"
+	NodeHealthHealthy    NodeHealth = "healthy"
+	NodeHealthSuspect    NodeHealth = "suspect"
+	NodeHealthUnhealthy  NodeHealth = "unhealthy"
+	NodeHealthRecovering NodeHealth = "recovering"
+)
+
+// Valid check if the health state is known.
+func (h NodeHealth) Valid() bool {
+	switch h {
+	case NodeHealthPending, NodeHealthHealthy, NodeHealthSuspect, NodeHealthUnhealthy,
+		NodeHealthRecovering:
+		return true
+	default:
+		return false
+	}
+}
+
+// NodePatch holds a partial update of a node. Metadata keys with a nil value are removed from the
+// node.
+type NodePatch struct {
+	Address  *string
+	Metadata map[string]*string
+	Check    *NodeCheck
+	Capacity *NodeResources
 }
@@ -0,0 +1,120 @@
+package node
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"malta/internal/service"
+)
+
+// auditRedactedValue replace the values that can't be kept at the audit history.
+const auditRedactedValue = "[redacted]"
+
+// newAuditEvent build an event of the audit history. The actor comes from the context and falls back
+// to the given kind.
+func newAuditEvent(
+	ctx context.Context,
+	eventType service.NodeAuditEventType,
+	kind service.NodeAuditActorKind,
+	nodeID int,
+	before, after map[string]string,
+) service.NodeAuditEvent {
+	actor, ok := service.NodeAuditActorFrom(ctx)
+	if !ok {
+		actor = service.NodeAuditActor{Kind: kind}
+	}
+	return service.NodeAuditEvent{
+		NodeID:    nodeID,
+		Type:      eventType,
+		Actor:     actor,
+		Before:    before,
+		After:     after,
+		CreatedAt: time.Now(),
+	}
+}
+
+// auditEventType describe the change between two states of a node.
+func auditEventType(before, after service.Node) service.NodeAuditEventType {
+	switch {
+	case !before.Active && after.Active:
+		return service.NodeAuditEventTypeActivated
+	case before.Active && !after.Active:
+		return service.NodeAuditEventTypeDeactivated
+	case before.Health != after.Health:
+		return service.NodeAuditEventTypeHealthChanged
+	default:
+		return service.NodeAuditEventTypeUpdated
+	}
+}
+
+// auditDiff return the fields that changed between two states of a node.
+func auditDiff(beforeState, afterState map[string]string) (map[string]string, map[string]string) {
+	beforeValues, afterValues := make(map[string]string), make(map[string]string)
+	for key, value := range beforeState {
+		if afterValue, ok := afterState[key]; !ok || afterValue != value {
+			beforeValues[key] = value
+		}
+	}
+	for key, value := range afterState {
+		if beforeValue, ok := beforeState[key]; !ok || beforeValue != value {
+			afterValues[key] = value
+		}
+	}
+	return beforeValues, afterValues
+}
+
+// auditState flatten the fields of a node kept at the audit history. The lease and the timestamps
+// are left out, they change at every heartbeat. The state should be taken before the node is
+// changed, the metadata is updated in place.
+func auditState(node service.Node) map[string]string {
+	state := map[string]string{
+		"address": node.Address,
+		"active":  strconv.FormatBool(node.Active),
+	}
+	set := func(key, value string) {
+		if value != "" {
+			state[key] = value
+		}
+	}
+	if node.TTL > 0 {
+		set("ttl", node.TTL.String())
+	}
+	set("health", string(node.Health))
+	for key, value := range node.Metadata {
+		state["metadata."+key] = value
+	}
+
+	check := node.Check
+	set("check.type", string(check.Type))
+	set("check.grpcService", check.GRPCService)
+	if check.GracePeriod > 0 {
+		set("check.gracePeriod", check.GracePeriod.String())
+	}
+	set("check.http.path", check.HTTP.Path)
+	set("check.http.method", check.HTTP.Method)
+	set("check.http.statuses", strings.Join(check.HTTP.Statuses, ","))
+	set("check.http.bodyRegex", check.HTTP.BodyRegex)
+	set("check.http.bodyJSONPath", check.HTTP.BodyJSONPath)
+	set("check.http.bodyJSONValue", check.HTTP.BodyJSONValue)
+	// The header values usually have credentials, only the names are kept at the history.
+	for key := range check.HTTP.Headers {
+		state["check.http.headers."+key] = auditRedactedValue
+	}
+
+	setInt := func(key string, value int64) {
+		if value != 0 {
+			state[key] = strconv.FormatInt(value, 10)
+		}
+	}
+	capacity := node.Capacity
+	setInt("capacity.cpu", capacity.CPU)
+	setInt("capacity.memory", capacity.Memory)
+	setInt("capacity.disk", capacity.Disk)
+	setInt("capacity.slots", capacity.Slots)
+	for name, value := range capacity.Custom {
+		setInt("capacity.resources."+name, value)
+	}
+	return state
+}
@@ -0,0 +1,65 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+
+	"malta/internal/service"
+)
+
+// Checker is used to check the health of a node. A nil error means the node is healthy. The status
+// is the one reported by the protocol, like the HTTP status or the command exit code, and zero if
+// the protocol has none.
+type Checker interface {
+	Check(ctx context.Context, node service.Node) (status int, err error)
+}
+
+// PreparedChecker is a Checker that parses the check of each node once. The prepared Checker is kept
+// with the node schedule and used until the node check changes.
+type PreparedChecker interface {
+	Checker
+	Prepare(node service.Node) (Checker, error)
+}
+
+// failedChecker is used when the check of a node can't be prepared, every check fails with the
+// error.
+type failedChecker struct {
+	err error
+}
+
+func (c failedChecker) Check(context.Context, service.Node) (int, error) {
+	return 0, c.err
+}
+
+// nodeCheckType is the type of the node check, the default is http.
+func nodeCheckType(node service.Node) service.NodeCheckType {
+	if node.Check.Type == "" {
+		return service.NodeCheckTypeHTTP
+	}
+	return node.Check.Type
+}
+
+// nodeHost extract the host and port from the node address. The address can be either an URL or a
+// 'host:port' pair.
+func nodeHost(address string) (string, error) {
+	if u, err := url.Parse(address); err == nil && u.Host != "" {
+		if u.Port() != "" {
+			return u.Host, nil
+		}
+		switch u.Scheme {
+		case "http":
+			return net.JoinHostPort(u.Hostname(), "80"), nil
+		case "https":
+			return net.JoinHostPort(u.Hostname(), "443"), nil
+		default:
+			return "", fmt.Errorf("missing port at address '%s'", address)
+		}
+	}
+
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return "", fmt.Errorf("invalid address '%s': %w", address, err)
+	}
+	return address, nil
+}
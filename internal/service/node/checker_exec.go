@@ -0,0 +1,41 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+
+	"malta/internal/service"
+)
+
+// ExecChecker check the health of the nodes by running a command, an exit code zero means the node
+// is healthy. The node id and address are available to the command at the 'MALTA_NODE_ID' and
+// 'MALTA_NODE_ADDRESS' environment variables.
+type ExecChecker struct {
+	Command []string
+}
+
+// Check the node.
+func (c *ExecChecker) Check(ctx context.Context, node service.Node) (int, error) {
+	if len(c.Command) == 0 {
+		return 0, fmt.Errorf("missing command")
+	}
+
+	cmd := exec.CommandContext(ctx, c.Command[0], c.Command[1:]...) // nolint: gosec
+	cmd.Env = append(
+		os.Environ(),
+		"MALTA_NODE_ID="+strconv.Itoa(node.ID),
+		"MALTA_NODE_ADDRESS="+node.Address,
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode(), fmt.Errorf("command failed with output '%s': %w", output, err)
+		}
+		return 0, fmt.Errorf("command failed with output '%s': %w", output, err)
+	}
+	return 0, nil
+}
@@ -0,0 +1,58 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health/grpc_health_v1"
+
+	"malta/internal/service"
+)
+
+const defaultGRPCDialTimeout = 5 * time.Second
+
+// GRPCChecker check the health of the nodes with the gRPC health checking protocol.
+type GRPCChecker struct {
+	// DialTimeout is the max time to wait for the connection, the default is 5 seconds.
+	DialTimeout time.Duration
+	DialOptions []grpc.DialOption
+}
+
+// Check the node.
+func (c *GRPCChecker) Check(ctx context.Context, node service.Node) (int, error) {
+	host, err := nodeHost(node.Address)
+	if err != nil {
+		return 0, err
+	}
+
+	timeout := c.DialTimeout
+	if timeout == 0 {
+		timeout = defaultGRPCDialTimeout
+	}
+	dialCtx, dialCtxCancel := context.WithTimeout(ctx, timeout)
+	defer dialCtxCancel()
+
+	options := c.DialOptions
+	if len(options) == 0 {
+		options = []grpc.DialOption{grpc.WithInsecure()}
+	}
+	options = append(options, grpc.WithBlock(), grpc.FailOnNonTempDialError(true))
+	conn, err := grpc.DialContext(dialCtx, host, options...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close() // nolint: errcheck
+
+	resp, err := grpc_health_v1.NewHealthClient(conn).Check(
+		ctx, &grpc_health_v1.HealthCheckRequest{Service: node.Check.GRPCService},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check the health: %w", err)
+	}
+	if resp.Status != grpc_health_v1.HealthCheckResponse_SERVING {
+		return int(resp.Status), fmt.Errorf("invalid serving status '%s'", resp.Status)
+	}
+	return int(resp.Status), nil
+}
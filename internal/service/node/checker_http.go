@@ -0,0 +1,401 @@
+package node
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"malta/internal/service"
+)
+
+const (
+	defaultHTTPCheckPath        = "/health"
+	defaultHTTPCheckMaxBodySize = 64 << 10
+
+	defaultHTTPClientConnectTimeout      = 5 * time.Second
+	defaultHTTPClientTLSHandshakeTimeout = 5 * time.Second
+	defaultHTTPClientKeepAlive           = 30 * time.Second
+	defaultHTTPClientIdleTimeout         = 90 * time.Second
+	defaultHTTPClientMaxIdle             = 100
+	defaultHTTPClientMaxIdlePerHost      = 2
+)
+
+// HTTPClientConfig used to build the client of the HTTP checker.
+type HTTPClientConfig struct {
+	// Timeout to establish the connection, the default is 5 seconds.
+	ConnectTimeout time.Duration
+
+	// Timeout of the TLS handshake, the default is 5 seconds.
+	TLSHandshakeTimeout time.Duration
+
+	// Interval between keep-alive probes of the connections, the default is 30 seconds.
+	KeepAlive time.Duration
+
+	// Max quantity of idle connections, the default is 100.
+	MaxIdleConnections int
+
+	// Max quantity of idle connections per node, the default is 2.
+	MaxIdleConnectionsPerHost int
+
+	// Time an idle connection is kept at the pool, the default is 90 seconds.
+	IdleConnectionTimeout time.Duration
+
+	// Proxy address. The proxy is taken from the environment variables if empty.
+	Proxy string
+
+	TLS HTTPClientTLSConfig
+}
+
+// HTTPClientTLSConfig used to configure the TLS of the HTTP checker client.
+type HTTPClientTLSConfig struct {
+	// CAFile has the certificate authorities used to verify the nodes. The system ones are used
+	// if empty.
+	CAFile string
+
+	// CertFile and KeyFile have the client certificate used on mutual TLS.
+	CertFile string
+	KeyFile  string
+
+	// ServerName used to verify the certificates of the nodes instead of the node host.
+	ServerName string
+
+	InsecureSkipVerify bool
+}
+
+// HTTPChecker check the health of the nodes with a HTTP request. The options are the defaults and
+// each node can override them.
+type HTTPChecker struct {
+	// Client used at the checks. It's built from the ClientConfig if nil.
+	Client       *http.Client
+	ClientConfig HTTPClientConfig
+	Options      service.NodeCheckHTTP
+
+	// MaxBodySize is the max quantity of bytes read from the response body, the default is 64KiB.
+	MaxBodySize int64
+}
+
+// httpCheck is the check of a node with the options merged and the body assertions parsed.
+type httpCheck struct {
+	checker  *HTTPChecker
+	options  service.NodeCheckHTTP
+	statuses statusRanges
+	regexp   *regexp.Regexp
+	jsonPath []jsonPathSegment
+}
+
+// Init the internal state.
+func (c *HTTPChecker) Init() error {
+	if c.Client != nil {
+		return nil
+	}
+	client, err := c.ClientConfig.client()
+	if err != nil {
+		return err
+	}
+	c.Client = client
+	return nil
+}
+
+// Check the node. The check is prepared at every call, the health checks use Prepare instead.
+func (c *HTTPChecker) Check(ctx context.Context, node service.Node) (int, error) {
+	check, err := c.Prepare(node)
+	if err != nil {
+		return 0, err
+	}
+	return check.Check(ctx, node)
+}
+
+// Prepare merge the node options with the defaults and parse the body assertions.
+func (c *HTTPChecker) Prepare(node service.Node) (Checker, error) {
+	check := &httpCheck{checker: c, options: mergeHTTPCheckOptions(c.Options, node.Check.HTTP)}
+	var err error
+	if check.statuses, err = parseStatusRanges(check.options.Statuses); err != nil {
+		return nil, err
+	}
+	if check.options.BodyRegex != "" {
+		if check.regexp, err = regexp.Compile(check.options.BodyRegex); err != nil {
+			return nil, fmt.Errorf("invalid body regex: %w", err)
+		}
+	}
+	if check.options.BodyJSONPath != "" {
+		if check.jsonPath, err = parseJSONPath(check.options.BodyJSONPath); err != nil {
+			return nil, fmt.Errorf("invalid body json path: %w", err)
+		}
+	}
+	return check, nil
+}
+
+// Check the node with the prepared options.
+func (c *httpCheck) Check(ctx context.Context, node service.Node) (int, error) {
+	options := c.options
+	address := strings.TrimSuffix(node.Address, "/") + options.Path
+	req, err := http.NewRequest(options.Method, address, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create http request: %w", err)
+	}
+	req = req.WithContext(ctx)
+	for key, value := range options.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := c.checker.Client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to execute the request: %w", err)
+	}
+	defer c.checker.closeBody(resp.Body)
+
+	if !c.statuses.match(resp.StatusCode) {
+		return resp.StatusCode, fmt.Errorf("invalid status code '%d'", resp.StatusCode)
+	}
+
+	if options.BodyRegex == "" && options.BodyJSONPath == "" {
+		return resp.StatusCode, nil
+	}
+	body, err := c.checker.readBody(resp.Body)
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	return resp.StatusCode, c.checkBody(body)
+}
+
+func (c HTTPClientConfig) client() (*http.Client, error) {
+	proxy := http.ProxyFromEnvironment
+	if c.Proxy != "" {
+		proxyURL, err := url.Parse(c.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy '%s': %w", c.Proxy, err)
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+
+	tlsConfig, err := c.TLS.config()
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   durationOrDefault(c.ConnectTimeout, defaultHTTPClientConnectTimeout),
+		KeepAlive: durationOrDefault(c.KeepAlive, defaultHTTPClientKeepAlive),
+	}
+	transport := &http.Transport{
+		Proxy:               proxy,
+		DialContext:         dialer.DialContext,
+		TLSClientConfig:     tlsConfig,
+		TLSHandshakeTimeout: durationOrDefault(c.TLSHandshakeTimeout, defaultHTTPClientTLSHandshakeTimeout),
+		MaxIdleConns:        defaultHTTPClientMaxIdle,
+		MaxIdleConnsPerHost: defaultHTTPClientMaxIdlePerHost,
+		IdleConnTimeout:     durationOrDefault(c.IdleConnectionTimeout, defaultHTTPClientIdleTimeout),
+	}
+	if c.MaxIdleConnections > 0 {
+		transport.MaxIdleConns = c.MaxIdleConnections
+	}
+	if c.MaxIdleConnectionsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = c.MaxIdleConnectionsPerHost
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+func (c HTTPClientTLSConfig) config() (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify, // nolint: gosec
+	}
+
+	if c.CAFile != "" {
+		payload, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the certificate authority file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(payload) {
+			return nil, fmt.Errorf("no certificate found at '%s'", c.CAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+func durationOrDefault(value, defaultValue time.Duration) time.Duration {
+	if value > 0 {
+		return value
+	}
+	return defaultValue
+}
+
+func (c *HTTPChecker) maxBodySize() int64 {
+	if c.MaxBodySize <= 0 {
+		return defaultHTTPCheckMaxBodySize
+	}
+	return c.MaxBodySize
+}
+
+func (c *HTTPChecker) readBody(r io.Reader) ([]byte, error) {
+	size := c.maxBodySize()
+	body, err := ioutil.ReadAll(io.LimitReader(r, size+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the response body: %w", err)
+	}
+	if int64(len(body)) > size {
+		return nil, fmt.Errorf("response body bigger than '%d' bytes", size)
+	}
+	return body, nil
+}
+
+// ValidateHTTPCheck check if the HTTP check options are valid.
+func ValidateHTTPCheck(options service.NodeCheckHTTP) error {
+	if _, err := parseStatusRanges(options.Statuses); err != nil {
+		return err
+	}
+	if options.Path != "" && !strings.HasPrefix(options.Path, "/") {
+		return fmt.Errorf("path should start with '/'")
+	}
+	switch options.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodOptions:
+	default:
+		return fmt.Errorf("unknown method '%s'", options.Method)
+	}
+	if options.BodyRegex != "" {
+		if _, err := regexp.Compile(options.BodyRegex); err != nil {
+			return fmt.Errorf("invalid body regex: %w", err)
+		}
+	}
+	if options.BodyJSONPath != "" {
+		if _, err := parseJSONPath(options.BodyJSONPath); err != nil {
+			return fmt.Errorf("invalid body json path: %w", err)
+		}
+	}
+	return nil
+}
+
+// closeBody drain what is left of the response body before closing it, so the connection is reused
+// by the next checks.
+func (c *HTTPChecker) closeBody(body io.ReadCloser) {
+	io.Copy(ioutil.Discard, io.LimitReader(body, c.maxBodySize())) // nolint: errcheck
+	body.Close()                                                   // nolint: errcheck
+}
+
+func (c *httpCheck) checkBody(body []byte) error {
+	options := c.options
+	if c.regexp != nil && !c.regexp.Match(body) {
+		return fmt.Errorf("response body doesn't match '%s'", options.BodyRegex)
+	}
+	if c.jsonPath == nil {
+		return nil
+	}
+
+	var document interface{}
+	if err := json.Unmarshal(body, &document); err != nil {
+		return fmt.Errorf("failed to unmarshal the response body: %w", err)
+	}
+	value, ok := evalJSONPath(document, c.jsonPath)
+	if !ok {
+		return fmt.Errorf("'%s' not found at the response body", options.BodyJSONPath)
+	}
+	if options.BodyJSONValue == "" {
+		return nil
+	}
+	if actual := fmt.Sprint(value); actual != options.BodyJSONValue {
+		return fmt.Errorf(
+			"expected '%s' at '%s' but got '%s'", options.BodyJSONValue, options.BodyJSONPath, actual,
+		)
+	}
+	return nil
+}
+
+func mergeHTTPCheckOptions(defaults, node service.NodeCheckHTTP) service.NodeCheckHTTP {
+	options := defaults
+	if node.Path != "" {
+		options.Path = node.Path
+	}
+	if node.Method != "" {
+		options.Method = node.Method
+	}
+	if len(node.Statuses) > 0 {
+		options.Statuses = node.Statuses
+	}
+	if node.BodyRegex != "" {
+		options.BodyRegex = node.BodyRegex
+	}
+	if node.BodyJSONPath != "" {
+		options.BodyJSONPath = node.BodyJSONPath
+		options.BodyJSONValue = node.BodyJSONValue
+	}
+	if len(node.Headers) > 0 {
+		headers := make(map[string]string, len(defaults.Headers)+len(node.Headers))
+		for key, value := range defaults.Headers {
+			headers[key] = value
+		}
+		for key, value := range node.Headers {
+			headers[key] = value
+		}
+		options.Headers = headers
+	}
+
+	if options.Path == "" {
+		options.Path = defaultHTTPCheckPath
+	}
+	if options.Method == "" {
+		options.Method = http.MethodGet
+	}
+	return options
+}
+
+type statusRange struct {
+	min, max int
+}
+
+type statusRanges []statusRange
+
+func (s statusRanges) match(status int) bool {
+	if len(s) == 0 {
+		return status == http.StatusOK
+	}
+	for _, r := range s {
+		if status >= r.min && status <= r.max {
+			return true
+		}
+	}
+	return false
+}
+
+func parseStatusRanges(values []string) (statusRanges, error) {
+	ranges := make(statusRanges, 0, len(values))
+	for _, value := range values {
+		fragments := strings.SplitN(value, "-", 2)
+		min, err := strconv.Atoi(strings.TrimSpace(fragments[0]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid status '%s'", value)
+		}
+		max := min
+		if len(fragments) == 2 {
+			if max, err = strconv.Atoi(strings.TrimSpace(fragments[1])); err != nil {
+				return nil, fmt.Errorf("invalid status '%s'", value)
+			}
+		}
+		if min < 100 || max > 599 || min > max {
+			return nil, fmt.Errorf("invalid status range '%s'", value)
+		}
+		ranges = append(ranges, statusRange{min: min, max: max})
+	}
+	return ranges, nil
+}
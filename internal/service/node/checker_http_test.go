@@ -0,0 +1,106 @@
+package node
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"malta/internal/service"
+)
+
+func TestHTTPCheckerPrepare(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"ok","checks":[{"state":"up"}]}`)) // nolint: errcheck
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		options service.NodeCheckHTTP
+		healthy bool
+	}{
+		{name: "status", healthy: true},
+		{name: "unexpected status", options: service.NodeCheckHTTP{Statuses: []string{"204"}}},
+		{name: "regex", options: service.NodeCheckHTTP{BodyRegex: `"status":"ok"`}, healthy: true},
+		{name: "regex mismatch", options: service.NodeCheckHTTP{BodyRegex: `"status":"down"`}},
+		{
+			name:    "json path",
+			options: service.NodeCheckHTTP{BodyJSONPath: "$.checks[0].state", BodyJSONValue: "up"},
+			healthy: true,
+		},
+		{
+			name:    "json path mismatch",
+			options: service.NodeCheckHTTP{BodyJSONPath: "$.checks[0].state", BodyJSONValue: "down"},
+		},
+		{name: "missing json path", options: service.NodeCheckHTTP{BodyJSONPath: "$.missing"}},
+	}
+
+	checker := HTTPChecker{Client: server.Client()}
+	if err := checker.Init(); err != nil {
+		t.Fatalf("failed to initialize: %s", err)
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			node := service.Node{Address: server.URL, Check: service.NodeCheck{HTTP: tt.options}}
+			check, err := checker.Prepare(node)
+			if err != nil {
+				t.Fatalf("failed to prepare: %s", err)
+			}
+			_, err = check.Check(context.Background(), node)
+			if healthy := err == nil; healthy != tt.healthy {
+				t.Errorf("expected healthy '%t', got the error '%v'", tt.healthy, err)
+			}
+		})
+	}
+}
+
+func TestHTTPCheckerPrepareInvalid(t *testing.T) {
+	checker := HTTPChecker{Client: http.DefaultClient}
+	for _, options := range []service.NodeCheckHTTP{
+		{BodyRegex: "("},
+		{BodyJSONPath: "status"},
+		{Statuses: []string{"abc"}},
+	} {
+		node := service.Node{Address: "http://node", Check: service.NodeCheck{HTTP: options}}
+		if _, err := checker.Prepare(node); err == nil {
+			t.Errorf("expected an error preparing '%+v'", options)
+		}
+	}
+}
+
+// TestHTTPCheckerConnectionReuse check the failed checks leave the connection ready to be reused,
+// even when the body isn't read.
+func TestHTTPCheckerConnectionReuse(t *testing.T) {
+	var connections int64
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(strings.Repeat("unavailable", 50000))) // nolint: errcheck
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(handler))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt64(&connections, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	checker := HTTPChecker{Client: server.Client(), MaxBodySize: 1 << 20}
+	if err := checker.Init(); err != nil {
+		t.Fatalf("failed to initialize: %s", err)
+	}
+	node := service.Node{Address: server.URL}
+	for i := 0; i < 5; i++ {
+		if _, err := checker.Check(context.Background(), node); err == nil {
+			t.Fatal("expected the check to fail")
+		}
+	}
+	if value := atomic.LoadInt64(&connections); value != 1 {
+		t.Errorf("expected a single connection, got %d", value)
+	}
+}
@@ -0,0 +1,68 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"malta/internal/service"
+)
+
+const defaultStatusTimeout = time.Minute
+
+// StatusCheckerRepository is used to fetch the last status reported by the nodes.
+type StatusCheckerRepository interface {
+	SelectOne(ctx context.Context, nodeID int) (service.NodeStatus, error)
+}
+
+// StatusChecker check the health of the nodes by the status they report instead of probing them. A
+// node is unhealthy if it never reported, if its last report is older than the timeout or if it
+// reported a failure.
+type StatusChecker struct {
+	Repository StatusCheckerRepository
+
+	// Timeout after which a report is stale, the default is one minute.
+	Timeout time.Duration
+}
+
+// Check the node.
+func (c *StatusChecker) Check(ctx context.Context, node service.Node) (int, error) {
+	if c.Repository == nil {
+		return 0, fmt.Errorf("missing repository")
+	}
+
+	status, err := c.Repository.SelectOne(ctx, node.ID)
+	if err != nil {
+		if service.ErrorKindOf(err) == service.ErrorKindNotFound {
+			return 0, fmt.Errorf("no status reported")
+		}
+		return 0, fmt.Errorf("failed to fetch the status: %w", err)
+	}
+
+	timeout := durationOrDefault(c.Timeout, defaultStatusTimeout)
+	if age := time.Since(status.ReportedAt); age > timeout {
+		return 0, fmt.Errorf("status reported %s ago is stale", age.Truncate(time.Second))
+	}
+	return 0, statusError(status)
+}
+
+// statusError describe the failing components of a status, it's nil if the status isn't failing.
+func statusError(status service.NodeStatus) error {
+	if status.Status != service.NodeStatusFail {
+		return nil
+	}
+
+	var failing []string
+	for name, component := range status.Components {
+		if component.Status == service.NodeStatusFail {
+			failing = append(failing, name)
+		}
+	}
+	if len(failing) == 0 {
+		return fmt.Errorf("status reported as failing")
+	}
+	sort.Strings(failing)
+	return fmt.Errorf("status reported as failing at '%s'", strings.Join(failing, "', '"))
+}
@@ -0,0 +1,31 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"malta/internal/service"
+)
+
+// TCPChecker check the health of the nodes by opening a TCP connection.
+type TCPChecker struct {
+	Dialer net.Dialer
+}
+
+// Check the node.
+func (c *TCPChecker) Check(ctx context.Context, node service.Node) (int, error) {
+	host, err := nodeHost(node.Address)
+	if err != nil {
+		return 0, err
+	}
+
+	conn, err := c.Dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect: %w", err)
+	}
+	if err := conn.Close(); err != nil {
+		return 0, fmt.Errorf("failed to close the connection: %w", err)
+	}
+	return 0, nil
+}
@@ -2,44 +2,173 @@ package node
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
 	"fmt"
+	"net"
 	"net/url"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"malta/internal/database"
 	"malta/internal/service"
 )
 
+const (
+	defaultPageSize      = 100
+	maxPageSize          = 1000
+	defaultHistoryPeriod = 24 * time.Hour
+)
+
 // ClientRepository implements the node logic at the database layer.
 type ClientRepository interface {
-	Select(ctx context.Context) ([]service.Node, error)
+	Select(ctx context.Context, query service.NodeQuery) ([]service.Node, error)
 	SelectOne(ctx context.Context, id string) (service.Node, error)
-	Insert(tx *sql.Tx, rawNode service.Node) (service.Node, error)
+	SelectOneTx(tx *sql.Tx, id string) (service.Node, error)
+}
+
+// ClientHistoryRepository is used to read the results of the node checks.
+type ClientHistoryRepository interface {
+	Select(ctx context.Context, query service.NodeCheckResultQuery) ([]service.NodeCheckResult, error)
+	SelectUptime(ctx context.Context, nodeID int, from, to time.Time) (service.NodeUptime, error)
+}
+
+// ClientStatusRepository keeps the last status reported by the nodes.
+type ClientStatusRepository interface {
+	SelectOne(ctx context.Context, nodeID int) (service.NodeStatus, error)
+	Upsert(ctx context.Context, status service.NodeStatus) error
+}
+
+// ClientObservationRepository is used to read the health each observer has seen of the nodes.
+type ClientObservationRepository interface {
+	Select(ctx context.Context, nodeID int, since time.Time) ([]service.NodeObservation, error)
+}
+
+// ClientAuditRepository keeps the audit history of the nodes.
+type ClientAuditRepository interface {
+	Select(ctx context.Context, query service.NodeAuditQuery) ([]service.NodeAuditEvent, error)
+}
+
+// ClientAllocationRepository keeps the shares of the capacity of the nodes taken by the tasks.
+type ClientAllocationRepository interface {
+	Insert(tx *sql.Tx, allocation service.NodeAllocation) error
+	Select(ctx context.Context, nodeID int) ([]service.NodeAllocation, error)
+	SelectTx(tx *sql.Tx, nodeID int) ([]service.NodeAllocation, error)
+	SelectAll(ctx context.Context) ([]service.NodeAllocation, error)
+	Delete(ctx context.Context, nodeID int, id string) error
+}
+
+// ClientManager makes the changes of the nodes.
+type ClientManager interface {
+	Register(
+		ctx context.Context, node service.Node, fn func(node *service.Node),
+	) (service.Node, bool, error)
+	Update(
+		ctx context.Context,
+		id int,
+		kind service.NodeAuditActorKind,
+		fn func(node *service.Node) (bool, error),
+	) (service.Node, error)
+	Delete(ctx context.Context, id int) error
 }
 
-// ClientNotification implements the node logic to notify whenever a node is created.
-type ClientNotification interface {
-	Add(node service.Node)
+// ClientHealth receives the statuses reported by the nodes.
+type ClientHealth interface {
+	Report(status service.NodeStatus)
 }
 
 // ClientConfig used to initialize the client internal state.
 type ClientConfig struct {
+	// TTL is used when the node doesn't request one.
 	TTL time.Duration
+
+	// Bounds of the TTL a node can request. They're unbounded if zero.
+	MinTTL time.Duration
+	MaxTTL time.Duration
+
+	// Pending registers the nodes inactive until the first successful health check.
+	Pending bool
 }
 
 // Client implements the node business logic.
 type Client struct {
-	Config             ClientConfig
-	Repository         ClientRepository
-	Notification       ClientNotification
-	Transaction        database.Transaction
-	TransactionHandler func(*sql.Tx, error) error
+	Config                ClientConfig
+	Repository            ClientRepository
+	HistoryRepository     ClientHistoryRepository
+	StatusRepository      ClientStatusRepository
+	ObservationRepository ClientObservationRepository
+	AuditRepository       ClientAuditRepository
+	AllocationRepository  ClientAllocationRepository
+	Manager               ClientManager
+	Health                ClientHealth
+	Transaction           database.Transaction
+	TransactionHandler    func(*sql.Tx, error) error
+
+	// Checkers available to check the nodes, the checks of the other types are rejected.
+	Checkers map[service.NodeCheckType]Checker
 }
 
-// Index list the nodes.
-func (c *Client) Index(ctx context.Context) ([]service.Node, error) {
-	return c.Repository.Select(ctx)
+// Index list the nodes. If there are more nodes than the query limit, a cursor to the next page is
+// returned.
+func (c *Client) Index(
+	ctx context.Context, query service.NodeQuery,
+) ([]service.Node, *service.NodeCursor, error) {
+	if query.State == "" {
+		query.State = service.NodeQueryStateActive
+	}
+	if !query.State.Valid() {
+		return nil, nil, service.ValidationError{
+			Fields: map[string]string{"state": fmt.Sprintf("unknown state '%s'", query.State)},
+		}
+	}
+
+	for _, health := range query.Health {
+		if !health.Valid() {
+			return nil, nil, service.ValidationError{
+				Fields: map[string]string{"health": fmt.Sprintf("unknown health '%s'", health)},
+			}
+		}
+	}
+
+	if query.Sort == "" {
+		query.Sort = service.NodeSortCreatedAt
+	}
+	if !query.Sort.Valid() {
+		return nil, nil, service.ValidationError{
+			Fields: map[string]string{"sort": fmt.Sprintf("unknown sort '%s'", query.Sort)},
+		}
+	}
+	if query.After != nil && query.After.Sort != query.Sort {
+		return nil, nil, service.ValidationError{
+			Fields: map[string]string{"cursor": "the cursor was generated with a different sort"},
+		}
+	}
+
+	switch {
+	case query.Limit == 0:
+		query.Limit = defaultPageSize
+	case query.Limit < 0 || query.Limit > maxPageSize:
+		return nil, nil, service.ValidationError{
+			Fields: map[string]string{"limit": fmt.Sprintf("should be between 1 and %d", maxPageSize)},
+		}
+	}
+
+	limit := query.Limit
+	query.Limit++
+	nodes, err := c.Repository.Select(ctx, query)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch the nodes: %w", err)
+	}
+	if len(nodes) <= limit {
+		return nodes, nil, nil
+	}
+
+	nodes = nodes[:limit]
+	cursor := query.Sort.Cursor(nodes[limit-1])
+	return nodes, &cursor, nil
 }
 
 // FindOne fetch a given node.
@@ -47,34 +176,572 @@ func (c *Client) FindOne(ctx context.Context, id string) (service.Node, error) {
 	return c.Repository.SelectOne(ctx, id)
 }
 
-// Create a node.
-func (c *Client) Create(ctx context.Context, node service.Node) (_ service.Node, err error) {
-	if _, err := url.Parse(node.Address); err != nil {
-		return service.Node{}, fmt.Errorf("invalid address: %w", err)
+// Checks list the results of the checks of a node from the newest to the oldest together with the
+// uptime over the same period. The default period is the last 24 hours.
+func (c *Client) Checks(
+	ctx context.Context, id string, query service.NodeCheckResultQuery,
+) ([]service.NodeCheckResult, service.NodeUptime, error) {
+	if query.To.IsZero() {
+		query.To = time.Now().UTC()
+	}
+	if query.From.IsZero() {
+		query.From = query.To.Add(-defaultHistoryPeriod)
+	}
+	if query.From.After(query.To) {
+		return nil, service.NodeUptime{}, service.ValidationError{
+			Fields: map[string]string{"from": "should be before 'to'"},
+		}
+	}
+
+	switch {
+	case query.Limit == 0:
+		query.Limit = defaultPageSize
+	case query.Limit < 0 || query.Limit > maxPageSize:
+		return nil, service.NodeUptime{}, service.ValidationError{
+			Fields: map[string]string{"limit": fmt.Sprintf("should be between 1 and %d", maxPageSize)},
+		}
 	}
 
-	tx, err := c.Transaction.Begin(ctx, false, sql.LevelDefault)
+	node, err := c.FindOne(ctx, id)
+	if err != nil {
+		return nil, service.NodeUptime{}, fmt.Errorf("failed to fetch the node: %w", err)
+	}
+	query.NodeID = node.ID
+
+	results, err := c.HistoryRepository.Select(ctx, query)
+	if err != nil {
+		return nil, service.NodeUptime{}, fmt.Errorf("failed to fetch the checks: %w", err)
+	}
+	uptime, err := c.HistoryRepository.SelectUptime(ctx, node.ID, query.From, query.To)
+	if err != nil {
+		return nil, service.NodeUptime{}, fmt.Errorf("failed to fetch the uptime: %w", err)
+	}
+	return results, uptime, nil
+}
+
+// Observations list the last health each observer has seen of a node, including the observers that
+// are gone.
+func (c *Client) Observations(ctx context.Context, id string) ([]service.NodeObservation, error) {
+	node, err := c.FindOne(ctx, id)
 	if err != nil {
-		return service.Node{}, fmt.Errorf("failed to create the transaction: %w", err)
+		return nil, fmt.Errorf("failed to fetch the node: %w", err)
 	}
-	defer func() {
-		err = c.TransactionHandler(tx, err)
-		if err != nil {
-			return
+
+	observations, err := c.ObservationRepository.Select(ctx, node.ID, time.Time{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the node observations: %w", err)
+	}
+	return observations, nil
+}
+
+// Events list the audit history of the nodes from the newest to the oldest. If there are more
+// events than the query limit, the id to continue the listing from is returned, otherwise it's zero.
+func (c *Client) Events(
+	ctx context.Context, query service.NodeAuditQuery,
+) ([]service.NodeAuditEvent, int, error) {
+	for _, eventType := range query.Types {
+		if !eventType.Valid() {
+			return nil, 0, service.ValidationError{
+				Fields: map[string]string{"type": fmt.Sprintf("unknown type '%s'", eventType)},
+			}
+		}
+	}
+	if query.ActorKind != "" && !query.ActorKind.Valid() {
+		return nil, 0, service.ValidationError{
+			Fields: map[string]string{"actor": fmt.Sprintf("unknown actor '%s'", query.ActorKind)},
 		}
-		c.Notification.Add(node)
-	}()
+	}
+	if !query.From.IsZero() && !query.To.IsZero() && query.From.After(query.To) {
+		return nil, 0, service.ValidationError{
+			Fields: map[string]string{"from": "should be before 'to'"},
+		}
+	}
+
+	switch {
+	case query.Limit == 0:
+		query.Limit = defaultPageSize
+	case query.Limit < 0 || query.Limit > maxPageSize:
+		return nil, 0, service.ValidationError{
+			Fields: map[string]string{"limit": fmt.Sprintf("should be between 1 and %d", maxPageSize)},
+		}
+	}
+
+	limit := query.Limit
+	query.Limit++
+	events, err := c.AuditRepository.Select(ctx, query)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch the node events: %w", err)
+	}
+	if len(events) <= limit {
+		return events, 0, nil
+	}
+	events = events[:limit]
+	return events, events[limit-1].ID, nil
+}
+
+// NodeEvents list the audit history of a node. The history is kept after the node is deleted.
+func (c *Client) NodeEvents(
+	ctx context.Context, id string, query service.NodeAuditQuery,
+) ([]service.NodeAuditEvent, int, error) {
+	nodeID, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, 0, service.NewError(service.ErrorKindNotFound, "node '%s' not found", id)
+	}
+	query.NodeID = nodeID
+	return c.Events(ctx, query)
+}
+
+// Status return the last status reported by a node.
+func (c *Client) Status(ctx context.Context, id string) (service.NodeStatus, error) {
+	node, err := c.FindOne(ctx, id)
+	if err != nil {
+		return service.NodeStatus{}, fmt.Errorf("failed to fetch the node: %w", err)
+	}
+
+	status, err := c.StatusRepository.SelectOne(ctx, node.ID)
+	if err != nil {
+		if service.ErrorKindOf(err) == service.ErrorKindNotFound {
+			return service.NodeStatus{}, service.NewError(
+				service.ErrorKindNotFound, "node '%d' didn't report a status", node.ID,
+			)
+		}
+		return service.NodeStatus{}, fmt.Errorf("failed to fetch the node status: %w", err)
+	}
+	return status, nil
+}
+
+// ReportStatus replace the status of a node. The status is fed right away to the health checks of
+// this server as the outcome of a check, whatever the check type of the node, and the nodes with the
+// status check type are also checked with the last status at every interval by all the servers.
+func (c *Client) ReportStatus(
+	ctx context.Context, id string, status service.NodeStatus,
+) (service.NodeStatus, error) {
+	if err := validateStatus(status); err != nil {
+		return service.NodeStatus{}, err
+	}
+
+	node, err := c.FindOne(ctx, id)
+	if err != nil {
+		return service.NodeStatus{}, fmt.Errorf("failed to fetch the node: %w", err)
+	}
+
+	status.NodeID = node.ID
+	status.ReportedAt = time.Now().UTC()
+	if err := c.StatusRepository.Upsert(ctx, status); err != nil {
+		return service.NodeStatus{}, fmt.Errorf("failed to store the node status: %w", err)
+	}
+	c.Health.Report(status)
+	return status, nil
+}
+
+// Create a node. If a node with the same address already exists, it's updated in place and
+// returned instead, the boolean is true only when a new node was created.
+func (c *Client) Create(ctx context.Context, node service.Node) (service.Node, bool, error) {
+	if err := validateAddress(node.Address); err != nil {
+		return service.Node{}, false, err
+	}
+
+	ttl, err := c.ttl(node.TTL)
+	if err != nil {
+		return service.Node{}, false, err
+	}
+	if err := c.validateCheck(node.Check); err != nil {
+		return service.Node{}, false, err
+	}
+	if err := node.Capacity.Validate("capacity"); err != nil {
+		return service.Node{}, false, err
+	}
 
 	if node.Metadata == nil {
 		node.Metadata = make(map[string]string)
 	}
 	node.CreatedAt = time.Now().UTC()
-	node.TTL = c.Config.TTL
-	node.Active = true
+	node.TTL = ttl
+	node.Active = !c.Config.Pending
+	node.Health = service.NodeHealthHealthy
+	if c.Config.Pending {
+		node.Health = service.NodeHealthPending
+	}
+	node.HealthChangedAt = node.CreatedAt
+	node.RegisteredAt = node.CreatedAt
+	renewLease(&node, node.CreatedAt)
 
-	node, err = c.Repository.Insert(tx, node)
+	return c.Manager.Register(ctx, node, func(existing *service.Node) {
+		// An inactive node waits for the first successful check again, an active one stays active.
+		health := service.NodeHealthHealthy
+		switch {
+		case existing.Active:
+		case c.Config.Pending:
+			health = service.NodeHealthPending
+		default:
+			existing.Active = true
+			existing.ReactivatedAt = node.CreatedAt
+		}
+		if existing.Health != health {
+			existing.Health = health
+			existing.HealthChangedAt = node.CreatedAt
+		}
+		existing.Metadata = node.Metadata
+		existing.TTL = node.TTL
+		existing.Check = node.Check
+		existing.Capacity = node.Capacity
+		existing.RegisteredAt = node.CreatedAt
+		renewLease(existing, node.CreatedAt)
+	})
+}
+
+// Update a node. The metadata from the patch is merged into the node metadata.
+func (c *Client) Update(
+	ctx context.Context, id string, patch service.NodePatch,
+) (service.Node, error) {
+	if patch.Address != nil {
+		if err := validateAddress(*patch.Address); err != nil {
+			return service.Node{}, err
+		}
+	}
+	if patch.Check != nil {
+		if err := c.validateCheck(*patch.Check); err != nil {
+			return service.Node{}, err
+		}
+	}
+	if patch.Capacity != nil {
+		if err := patch.Capacity.Validate("capacity"); err != nil {
+			return service.Node{}, err
+		}
+	}
+
+	nodeID, err := strconv.Atoi(id)
+	if err != nil {
+		return service.Node{}, service.NewError(service.ErrorKindNotFound, "node '%s' not found", id)
+	}
+	return c.Manager.Update(
+		ctx, nodeID, service.NodeAuditActorKindAPI, func(node *service.Node) (bool, error) {
+			if patch.Address != nil {
+				node.Address = *patch.Address
+			}
+			if patch.Check != nil {
+				node.Check = *patch.Check
+			}
+			if patch.Capacity != nil {
+				node.Capacity = *patch.Capacity
+			}
+			// The metadata is copied to keep the current state intact.
+			metadata := make(map[string]string, len(node.Metadata))
+			for key, value := range node.Metadata {
+				metadata[key] = value
+			}
+			for key, value := range patch.Metadata {
+				if value == nil {
+					delete(metadata, key)
+					continue
+				}
+				metadata[key] = *value
+			}
+			node.Metadata = metadata
+			return true, nil
+		},
+	)
+}
+
+// Heartbeat renew the lease of a node. Pending nodes can renew the lease while they wait for the
+// first successful check, and the nodes deactivated by an expired lease are activated again. The
+// nodes disabled by the health checks are only enabled by the checks.
+func (c *Client) Heartbeat(ctx context.Context, id string) (service.Node, error) {
+	nodeID, err := strconv.Atoi(id)
+	if err != nil {
+		return service.Node{}, service.NewError(service.ErrorKindNotFound, "node '%s' not found", id)
+	}
+	return c.Manager.Update(
+		ctx, nodeID, service.NodeAuditActorKindAPI, func(node *service.Node) (bool, error) {
+			now := time.Now().UTC()
+			switch {
+			case node.Active, node.Health == service.NodeHealthPending:
+			case node.Health == service.NodeHealthUnhealthy, node.Health == service.NodeHealthRecovering:
+				return false, service.NewError(
+					service.ErrorKindConflict, "node '%d' is disabled by the health checks", node.ID,
+				)
+			default:
+				node.Active = true
+				node.ReactivatedAt = now
+			}
+			renewLease(node, now)
+			return true, nil
+		},
+	)
+}
+
+// Delete a node.
+func (c *Client) Delete(ctx context.Context, id string) error {
+	nodeID, err := strconv.Atoi(id)
+	if err != nil {
+		return service.ValidationError{Fields: map[string]string{"id": "invalid id"}}
+	}
+	return c.Manager.Delete(ctx, nodeID)
+}
+
+// Allocations list the allocations of a node from the oldest to the newest together with the
+// capacity of the node.
+func (c *Client) Allocations(
+	ctx context.Context, id string,
+) ([]service.NodeAllocation, service.NodeCapacity, error) {
+	node, err := c.FindOne(ctx, id)
+	if err != nil {
+		return nil, service.NodeCapacity{}, fmt.Errorf("failed to fetch the node: %w", err)
+	}
+
+	allocations, err := c.AllocationRepository.Select(ctx, node.ID)
+	if err != nil {
+		return nil, service.NodeCapacity{}, fmt.Errorf("failed to fetch the allocations: %w", err)
+	}
+	return allocations, nodeCapacity(node, allocations), nil
+}
+
+// Allocate take a share of the capacity of a node. A random id is generated if none is given. It's a
+// conflict if the node is inactive, doesn't have enough capacity available or already has an
+// allocation with the same id.
+func (c *Client) Allocate(
+	ctx context.Context, id string, allocation service.NodeAllocation,
+) (_ service.NodeAllocation, err error) {
+	if err := validateAllocation(allocation); err != nil {
+		return service.NodeAllocation{}, err
+	}
+	if allocation.ID == "" {
+		buf := make([]byte, 16)
+		if _, err := rand.Read(buf); err != nil {
+			return service.NodeAllocation{}, fmt.Errorf("failed to generate the allocation id: %w", err)
+		}
+		allocation.ID = hex.EncodeToString(buf)
+	}
+
+	nodeID, err := strconv.Atoi(id)
 	if err != nil {
-		return service.Node{}, fmt.Errorf("failed to insert a new node: %w", err)
+		return service.NodeAllocation{}, service.NewError(
+			service.ErrorKindNotFound, "node '%s' not found", id,
+		)
+	}
+	allocation.NodeID = nodeID
+	allocation.CreatedAt = time.Now().UTC()
+
+	tx, err := c.Transaction.Begin(ctx, false, sql.LevelDefault)
+	if err != nil {
+		return service.NodeAllocation{}, fmt.Errorf("failed to create the transaction: %w", err)
+	}
+	defer func() { err = c.TransactionHandler(tx, err) }()
+
+	// The insert is the first statement of the transaction to hold the write lock before the capacity
+	// is checked, this way concurrent allocations on the same node can't overcommit it.
+	if err := c.AllocationRepository.Insert(tx, allocation); err != nil {
+		if service.ErrorKindOf(err) == service.ErrorKindConflict {
+			return service.NodeAllocation{}, service.NewError(
+				service.ErrorKindConflict, "allocation '%s' already exists at node '%d'",
+				allocation.ID, nodeID,
+			)
+		}
+		return service.NodeAllocation{}, fmt.Errorf("failed to insert the allocation: %w", err)
+	}
+
+	node, err := c.Repository.SelectOneTx(tx, id)
+	if err != nil {
+		if service.ErrorKindOf(err) == service.ErrorKindNotFound {
+			return service.NodeAllocation{}, service.NewError(
+				service.ErrorKindNotFound, "node '%s' not found", id,
+			)
+		}
+		return service.NodeAllocation{}, fmt.Errorf("failed to fetch the node: %w", err)
+	}
+	if !node.Active {
+		return service.NodeAllocation{}, service.NewError(
+			service.ErrorKindConflict, "node '%d' is inactive", node.ID,
+		)
+	}
+
+	allocations, err := c.AllocationRepository.SelectTx(tx, node.ID)
+	if err != nil {
+		return service.NodeAllocation{}, fmt.Errorf("failed to fetch the allocations: %w", err)
+	}
+	capacity := nodeCapacity(node, allocations)
+	if exceeded := capacity.Allocated.Exceeded(capacity.Allocatable); len(exceeded) > 0 {
+		sort.Strings(exceeded)
+		return service.NodeAllocation{}, service.NewError(
+			service.ErrorKindConflict, "node '%d' doesn't have enough %s available",
+			node.ID, strings.Join(exceeded, ", "),
+		)
+	}
+	return allocation, nil
+}
+
+// Release an allocation, its share of the capacity becomes available to the other tasks.
+func (c *Client) Release(ctx context.Context, id string, allocationID string) error {
+	nodeID, err := strconv.Atoi(id)
+	if err != nil {
+		return service.NewError(service.ErrorKindNotFound, "node '%s' not found", id)
+	}
+
+	if err := c.AllocationRepository.Delete(ctx, nodeID, allocationID); err != nil {
+		if service.ErrorKindOf(err) == service.ErrorKindNotFound {
+			return service.NewError(
+				service.ErrorKindNotFound, "allocation '%s' not found at node '%d'", allocationID, nodeID,
+			)
+		}
+		return fmt.Errorf("failed to delete the allocation: %w", err)
+	}
+	return nil
+}
+
+// Capacity return the capacity of the active nodes and how much of it is allocated. The allocations
+// of the inactive nodes are not accounted.
+func (c *Client) Capacity(ctx context.Context) (service.ClusterCapacity, error) {
+	nodes, err := c.Repository.Select(ctx, service.NodeQuery{
+		State: service.NodeQueryStateActive,
+		Sort:  service.NodeSortID,
+	})
+	if err != nil {
+		return service.ClusterCapacity{}, fmt.Errorf("failed to fetch the nodes: %w", err)
+	}
+
+	allocations, err := c.AllocationRepository.SelectAll(ctx)
+	if err != nil {
+		return service.ClusterCapacity{}, fmt.Errorf("failed to fetch the allocations: %w", err)
+	}
+	allocationsByNode := make(map[int][]service.NodeAllocation)
+	for _, allocation := range allocations {
+		allocationsByNode[allocation.NodeID] = append(allocationsByNode[allocation.NodeID], allocation)
+	}
+
+	capacity := service.ClusterCapacity{Nodes: make([]service.NodeCapacity, 0, len(nodes))}
+	for _, node := range nodes {
+		nc := nodeCapacity(node, allocationsByNode[node.ID])
+		capacity.Allocatable = capacity.Allocatable.Add(nc.Allocatable)
+		capacity.Allocated = capacity.Allocated.Add(nc.Allocated)
+		capacity.Nodes = append(capacity.Nodes, nc)
+	}
+	return capacity, nil
+}
+
+func validateAddress(address string) error {
+	if address == "" {
+		return service.ValidationError{Fields: map[string]string{"address": "can't be empty"}}
+	}
+	if strings.ContainsAny(address, " \t\r\n") {
+		return service.ValidationError{Fields: map[string]string{"address": "invalid address"}}
+	}
+
+	// The address is either an URL, used by the http checks, or a host and port.
+	if u, err := url.ParseRequestURI(address); err == nil && u.Scheme != "" && u.Hostname() != "" {
+		return nil
+	}
+	if host, port, err := net.SplitHostPort(address); err == nil && host != "" {
+		if _, err := strconv.ParseUint(port, 10, 16); err == nil {
+			return nil
+		}
+	}
+	return service.ValidationError{
+		Fields: map[string]string{"address": "expected an URL or a host and port"},
+	}
+}
+
+func (c *Client) validateCheck(check service.NodeCheck) error {
+	if check.Type != "" && !check.Type.Valid() {
+		return service.ValidationError{
+			Fields: map[string]string{"check.type": fmt.Sprintf("unknown type '%s'", check.Type)},
+		}
+	}
+	checkType := check.Type
+	if checkType == "" {
+		checkType = service.NodeCheckTypeHTTP
+	}
+	if _, ok := c.Checkers[checkType]; !ok {
+		return service.ValidationError{
+			Fields: map[string]string{
+				"check.type": fmt.Sprintf("checker '%s' is not available", checkType),
+			},
+		}
+	}
+	if check.GracePeriod < 0 {
+		return service.ValidationError{
+			Fields: map[string]string{"check.gracePeriod": "can't be negative"},
+		}
+	}
+	if err := ValidateHTTPCheck(check.HTTP); err != nil {
+		return service.ValidationError{Fields: map[string]string{"check.http": err.Error()}}
+	}
+	return nil
+}
+
+func validateAllocation(allocation service.NodeAllocation) error {
+	if strings.Contains(allocation.ID, "/") {
+		return service.ValidationError{Fields: map[string]string{"id": "can't have '/'"}}
+	}
+	if err := allocation.Resources.Validate("resources"); err != nil {
+		return err
+	}
+	if allocation.Resources.IsZero() {
+		return service.ValidationError{Fields: map[string]string{"resources": "can't be empty"}}
+	}
+	return nil
+}
+
+func nodeCapacity(node service.Node, allocations []service.NodeAllocation) service.NodeCapacity {
+	capacity := service.NodeCapacity{
+		NodeID:      node.ID,
+		Address:     node.Address,
+		Allocatable: node.Capacity,
+	}
+	for _, allocation := range allocations {
+		capacity.Allocated = capacity.Allocated.Add(allocation.Resources)
+	}
+	return capacity
+}
+
+func validateStatus(status service.NodeStatus) error {
+	fields := make(map[string]string)
+	if !status.Status.Valid() {
+		fields["status"] = fmt.Sprintf("unknown status '%s'", status.Status)
+	}
+	for name, component := range status.Components {
+		if name == "" {
+			fields["components"] = "empty component name"
+			continue
+		}
+		if !component.Status.Valid() {
+			fields["components."+name+".status"] = fmt.Sprintf("unknown status '%s'", component.Status)
+		}
+	}
+	if len(fields) > 0 {
+		return service.ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+func (c *Client) ttl(requested time.Duration) (time.Duration, error) {
+	if requested == 0 {
+		ttl := c.Config.TTL
+		if c.Config.MinTTL > 0 && ttl < c.Config.MinTTL {
+			ttl = c.Config.MinTTL
+		}
+		if c.Config.MaxTTL > 0 && ttl > c.Config.MaxTTL {
+			ttl = c.Config.MaxTTL
+		}
+		return ttl, nil
+	}
+
+	var reason string
+	switch {
+	case requested < 0:
+		reason = "can't be negative"
+	case c.Config.MinTTL > 0 && requested < c.Config.MinTTL:
+		reason = fmt.Sprintf("can't be lower than '%s'", c.Config.MinTTL)
+	case c.Config.MaxTTL > 0 && requested > c.Config.MaxTTL:
+		reason = fmt.Sprintf("can't be greater than '%s'", c.Config.MaxTTL)
+	default:
+		return requested, nil
+	}
+	return 0, service.ValidationError{Fields: map[string]string{"ttl": reason}}
+}
+
+func renewLease(node *service.Node, now time.Time) {
+	node.LastSeen = now
+	if node.TTL > 0 {
+		node.ExpiresAt = now.Add(node.TTL)
 	}
-	return node, nil
 }
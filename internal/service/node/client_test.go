@@ -0,0 +1,41 @@
+package node
+
+import "testing"
+
+func TestValidateAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		valid   bool
+	}{
+		{address: "http://node", valid: true},
+		{address: "https://node:8443/health", valid: true},
+		{address: "http://10.0.0.1:8080", valid: true},
+		{address: "http://[::1]:8080", valid: true},
+		{address: "node:8080", valid: true},
+		{address: "10.0.0.1:8080", valid: true},
+		{address: "[::1]:8080", valid: true},
+		{address: ""},
+		{address: "foo bar"},
+		{address: "foo bar:80"},
+		{address: "::::"},
+		{address: "node"},
+		{address: "node:"},
+		{address: ":8080"},
+		{address: "node:http"},
+		{address: "node:70000"},
+		{address: "/health"},
+		{address: "http://"},
+		{address: "http:///health"},
+		{address: "http://node name"},
+	}
+
+	for _, tt := range tests {
+		err := validateAddress(tt.address)
+		if tt.valid && err != nil {
+			t.Errorf("expected '%s' to be valid, got '%s'", tt.address, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("expected '%s' to be invalid", tt.address)
+		}
+	}
+}
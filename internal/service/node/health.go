@@ -1,195 +1,523 @@
 package node
 
 import (
+	"container/heap"
 	"context"
 	"fmt"
-	"net/http"
+	"math/rand"
+	"reflect"
 	"sync"
 	"time"
 
 	"github.com/rs/zerolog"
-	"golang.org/x/sync/errgroup"
 
 	"malta/internal/service"
 )
 
-// HealthConfigRepository load all the nodes.
-type HealthConfigRepository interface {
-	Select(ctx context.Context) ([]service.Node, error)
-	Update(ctx context.Context, node service.Node) error
+const (
+	defaultHealthTimeout = 10 * time.Second
+	defaultHealthJitter  = 0.1
+	defaultHistorySize   = 1000
+)
+
+// HealthConfigManager is the source of the nodes and the authority over their state.
+type HealthConfigManager interface {
+	List() []service.Node
+	Change(ctx context.Context, id int, fn func(node *service.Node) bool) (service.Node, error)
+	Subscribe(fn func(service.NodeEvent)) (unsubscribe func())
 }
 
 // HealthConfigCheckRepository is used to count the checks on the nodes.
 type HealthConfigCheckRepository interface {
-	Increment(ctx context.Context, id int) (int, error)
-	Update(ctx context.Context, id, value int) error
+	Record(
+		ctx context.Context, id int, observerID string, healthy bool, window int,
+	) (service.NodeCheckCounter, error)
+	Reset(ctx context.Context, id int, observerID string) error
+}
+
+// HealthConfigObservationRepository is used to share the health each observer has seen.
+type HealthConfigObservationRepository interface {
+	Select(ctx context.Context, nodeID int, since time.Time) ([]service.NodeObservation, error)
+	Upsert(ctx context.Context, observation service.NodeObservation) error
+}
+
+// HealthConfigHistoryRepository is used to keep the results of the checks.
+type HealthConfigHistoryRepository interface {
+	Insert(ctx context.Context, result service.NodeCheckResult, size int) error
 }
 
 // HealthConfig used to setup the health internal state.
 type HealthConfig struct {
-	// Interval used to check the nodes health.
+	// Interval used to check the nodes health. The checks are disabled if the interval isn't
+	// positive.
 	Interval time.Duration
 
-	// Used to fetch the nodes.
-	Repository HealthConfigRepository
+	// Used to fetch the nodes, follow their changes and update their health state.
+	Manager HealthConfigManager
 
 	// Used to count the checks on the nodes.
 	CheckRepository HealthConfigCheckRepository
 
+	// Used to share the observations with the other observers.
+	ObservationRepository HealthConfigObservationRepository
+
+	// ObserverID identifies this server among the ones sharing the database. Each observer has its
+	// own counters and health state machine for every node.
+	ObserverID string
+
+	// Quorum is the quantity of observers that should see a node as unhealthy before it's disabled,
+	// the default is 1. The quorum is fixed, so it should be at most the quantity of observers still
+	// running when some of them are down, otherwise no node is disabled. A warning is logged when
+	// a node is unhealthy to an observer but there aren't enough fresh observations to reach it.
+	Quorum int
+
+	// ObservationTimeout after which the observation of an observer is ignored, like when the
+	// observer is gone. The default is three times the longest check interval.
+	ObservationTimeout time.Duration
+
+	// Used to keep the results of the checks. The history is disabled if nil.
+	HistoryRepository HealthConfigHistoryRepository
+
+	// Quantity of check results kept per node, the older ones are discarded. The default is 1000.
+	HistorySize int
+
 	// Concurrency used to check the nodes.
 	Concurrency int
 
-	// Max quantity of failures allowed before disabling a node.
+	// Max quantity of failures allowed before disabling a node. The failures are only forgotten once
+	// the node is healthy again.
 	MaxFailures int
 
-	HTTPClient *http.Client
-	Logger     zerolog.Logger
+	// Quantity of consecutive successful checks needed for a suspect node to be healthy again, the
+	// default is 1.
+	SuccessThreshold int
+
+	// FailureWindow is the quantity of recent checks used to calculate the failure ratio, a node is
+	// disabled once the ratio of failed checks at a full window reaches the FailureRatio. The window
+	// is disabled if any of them is zero.
+	FailureWindow int
+	FailureRatio  float64
+
+	// Interval used to check the nodes disabled by failures. The recovery is disabled if the
+	// interval is zero.
+	RecoveryInterval time.Duration
+
+	// Quantity of consecutive successful checks needed to enable a disabled node.
+	RecoverySuccesses int
+
+	// Fraction of the interval randomly added or removed from each check schedule to spread the
+	// checks, the default is 0.1.
+	Jitter float64
+
+	// Timeout of each check, the default is 10 seconds.
+	Timeout time.Duration
+
+	// GracePeriod after the registration of a node where the failed checks are not counted. The node
+	// check can override it.
+	GracePeriod time.Duration
+
+	// Checkers available to check the nodes.
+	Checkers map[service.NodeCheckType]Checker
+
+	Logger zerolog.Logger
 }
 
-// Health is used to track the health of the nodes.
+// Health is used to track the health of the nodes. Each node has its own schedule and a single
+// goroutine owns the state of all of them, the checks are executed by short lived workers.
 type Health struct {
 	Config HealthConfig
 
-	add       chan service.Node
-	ctx       context.Context
-	ctxCancel func()
-	nodes     map[int]service.Node
-	wg        sync.WaitGroup
+	ctx         context.Context
+	ctxCancel   func()
+	unsubscribe func()
+	wg          sync.WaitGroup
+
+	// The node changes and the reported statuses are queued and the process is signaled through
+	// notify.
+	mutex   sync.Mutex
+	events  []service.NodeEvent
+	reports []service.NodeStatus
+	notify  chan struct{}
+
+	// State owned by the process goroutine.
+	results chan *healthEntry
+	entries map[int]*healthEntry
+	queue   healthQueue
+	running int
+	random  *rand.Rand
 }
 
 // Start the process.
 func (h *Health) Start() error {
-	h.add = make(chan service.Node)
-	h.nodes = make(map[int]service.Node)
-
-	if err := h.updateNodes(); err != nil {
-		return fmt.Errorf("failed to update the nodes")
+	if h.disabled() {
+		return nil
+	}
+	h.notify = make(chan struct{}, 1)
+	h.results = make(chan *healthEntry)
+	h.entries = make(map[int]*healthEntry)
+	h.random = rand.New(rand.NewSource(time.Now().UnixNano())) // nolint: gosec
+
+	// The subscription happens before the listing to not miss any change, applying a change twice
+	// is harmless.
+	h.unsubscribe = h.Config.Manager.Subscribe(h.enqueueEvent)
+	now := time.Now()
+	for _, node := range h.Config.Manager.List() {
+		h.apply(now, node)
 	}
+	h.ctx, h.ctxCancel = context.WithCancel(context.Background())
 	h.wg.Add(1)
 	go h.process()
 	return nil
 }
 
-// Stop the process.
+// Stop the process and wait for the running checks.
 func (h *Health) Stop() {
+	if h.ctxCancel == nil {
+		return
+	}
+	h.unsubscribe()
 	h.ctxCancel()
 	h.wg.Wait()
 }
 
-// Add the node to be checked.
-func (h *Health) Add(node service.Node) {
-	go func() { h.add <- node }()
+func (h *Health) enqueueEvent(event service.NodeEvent) {
+	h.mutex.Lock()
+	h.events = append(h.events, event)
+	h.mutex.Unlock()
+
+	select {
+	case h.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Report feed a status reported by a node to its health state as the outcome of a check, a failing
+// status is a failed check and any other status a successful one. The node is checked right away
+// with the status by this observer, instead of waiting for the next check, unless the node isn't
+// being checked. The nodes with the status check are still checked at the interval, this way the
+// ones that stop reporting are caught.
+func (h *Health) Report(status service.NodeStatus) {
+	if h.disabled() {
+		return
+	}
+	h.mutex.Lock()
+	h.reports = append(h.reports, status)
+	h.mutex.Unlock()
+
+	select {
+	case h.notify <- struct{}{}:
+	default:
+	}
 }
 
-func (h *Health) updateNodes() error {
-	nodes, err := h.Config.Repository.Select(context.Background())
-	if err != nil {
-		return fmt.Errorf("failed to fetch nodes: %w", err)
+func (h *Health) disabled() bool {
+	return h.Config.Interval <= 0
+}
+
+func (h *Health) concurrency() int {
+	if h.Config.Concurrency > 0 {
+		return h.Config.Concurrency
 	}
+	return 1
+}
 
-	for _, node := range nodes {
-		h.nodes[node.ID] = node
+func (h *Health) timeout() time.Duration {
+	if h.Config.Timeout > 0 {
+		return h.Config.Timeout
 	}
-	return nil
+	return defaultHealthTimeout
+}
+
+func (h *Health) historySize() int {
+	if h.Config.HistorySize > 0 {
+		return h.Config.HistorySize
+	}
+	return defaultHistorySize
+}
+
+func (h *Health) jitter() float64 {
+	if h.Config.Jitter > 0 {
+		return h.Config.Jitter
+	}
+	return defaultHealthJitter
+}
+
+func (h *Health) recoveryEnabled() bool {
+	return h.Config.RecoveryInterval > 0
 }
 
 func (h *Health) process() {
 	defer h.wg.Done()
-	h.ctx, h.ctxCancel = context.WithCancel(context.Background())
 
-	var removeList []int
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
 	for {
+		h.dispatch(time.Now())
+		h.resetTimer(timer)
+
 		select {
-		case node := <-h.add:
-			h.Config.Logger.Debug().Int("nodeID", node.ID).Msg("received node creation notification")
-			h.nodes[node.ID] = node
-			continue
 		case <-h.ctx.Done():
 			return
-		case <-time.After(h.Config.Interval):
-		}
-		h.Config.Logger.Debug().Msg("New health check cycle")
-
-		g, gctx := errgroup.WithContext(h.ctx)
-		ratelimit := make(chan struct{}, h.Config.Concurrency)
-		for i, node := range h.nodes {
-			ratelimit <- struct{}{}
-			var (
-				i    = i
-				node = node
-			)
-			g.Go(func() error {
-				healthy := h.check(gctx, ratelimit, node)
-				constraint, err := h.checkConstraint(gctx, healthy, node)
-				if err != nil {
-					h.Config.Logger.Error().Err(err).Msg("failed to check the constraints")
-					return nil
-				}
-				if constraint {
-					removeList = append(removeList, i)
-				}
-				return nil
-			})
+		case <-h.notify:
+			h.processEvents()
+		case entry := <-h.results:
+			h.processResult(time.Now(), entry)
+		case <-timer.C:
 		}
-		g.Wait() // nolinter: errcheck
+	}
+}
 
-		for _, id := range removeList {
-			delete(h.nodes, id)
+func (h *Health) processEvents() {
+	h.mutex.Lock()
+	events, reports := h.events, h.reports
+	h.events, h.reports = nil, nil
+	h.mutex.Unlock()
+
+	now := time.Now()
+	for _, event := range events {
+		h.Config.Logger.Debug().
+			Int("nodeID", event.Node.ID).
+			Str("type", string(event.Type)).
+			Msg("received node change")
+		if event.Type == service.NodeEventTypeDeleted {
+			h.delete(event.Node.ID)
+			continue
 		}
+		h.apply(now, event.Node)
+	}
+	for _, status := range reports {
+		h.applyReport(now, status)
 	}
 }
 
-func (h *Health) check(ctx context.Context, rl <-chan struct{}, node service.Node) bool {
-	defer func() { <-rl }()
+// apply the state of a node to the checks. The active nodes are checked at the interval and the
+// ones disabled by failures at the recovery interval, the other nodes are not checked.
+func (h *Health) apply(now time.Time, node service.Node) {
+	switch {
+	case node.Active, node.Health == service.NodeHealthPending:
+		h.upsert(now, node, false)
+	case h.recoveryEnabled() &&
+		(node.Health == service.NodeHealthUnhealthy || node.Health == service.NodeHealthRecovering):
+		h.upsert(now, node, true)
+	default:
+		h.delete(node.ID)
+	}
+}
 
-	address := fmt.Sprintf("%s/health", node.Address)
-	h.Config.Logger.Debug().Str("endpoint", address).Msg("Executing health check")
-	req, err := http.NewRequest(http.MethodGet, address, nil)
-	if err != nil {
-		h.Config.Logger.Error().Err(err).Msg("failed to create http request")
-		return false
+// applyReport check the node right away with the reported status. A status reported while the node
+// is being checked is used once the check finishes, and only the last one is kept.
+func (h *Health) applyReport(now time.Time, status service.NodeStatus) {
+	entry, ok := h.entries[status.NodeID]
+	if !ok {
+		return
 	}
-	req = req.WithContext(ctx)
+	entry.report = &status
+	if entry.running {
+		return
+	}
+	h.unschedule(entry)
+	entry.next = now
+	heap.Push(&h.queue, entry)
+}
 
-	resp, err := h.Config.HTTPClient.Do(req)
-	if err != nil {
-		h.Config.Logger.Error().Err(err).Msgf("failed to check the health of node '%d'", node.ID)
-		return false
+// processResult schedule the next check of the entry, unless it was removed while being checked.
+func (h *Health) processResult(now time.Time, entry *healthEntry) {
+	h.running--
+	entry.running = false
+	if h.entries[entry.node.ID] != entry {
+		return
+	}
+	if entry.report != nil {
+		entry.next = now
+		heap.Push(&h.queue, entry)
+		return
+	}
+	h.schedule(now, entry, false)
+}
+
+// upsert add or update a node. A new node has the first check at a random point of the interval to
+// spread the checks.
+func (h *Health) upsert(now time.Time, node service.Node, recovering bool) {
+	entry, ok := h.entries[node.ID]
+	if !ok {
+		entry = &healthEntry{index: -1}
+		h.entries[node.ID] = entry
+	}
+	previous := entry.recovering
+	if !ok || !reflect.DeepEqual(entry.node.Check, node.Check) {
+		entry.checker = h.prepare(node)
 	}
-	defer resp.Body.Close() // nolint: errcheck
+	entry.node = node
+	entry.recovering = recovering
+
+	switch {
+	case entry.running:
+	case !ok:
+		h.schedule(now, entry, true)
+	case previous != recovering:
+		h.unschedule(entry)
+		h.schedule(now, entry, false)
+	}
+}
 
-	if resp.StatusCode != http.StatusOK {
-		h.Config.Logger.Error().Msgf(
-			"invalid status code '%d' from node '%d'", resp.StatusCode, node.ID,
-		)
-		return false
+func (h *Health) delete(id int) {
+	entry, ok := h.entries[id]
+	if !ok {
+		return
 	}
+	delete(h.entries, id)
+	h.unschedule(entry)
+}
 
-	return true
+func (h *Health) schedule(now time.Time, entry *healthEntry, initial bool) {
+	interval := h.Config.Interval
+	if entry.recovering {
+		interval = h.Config.RecoveryInterval
+	}
+
+	// A non positive interval checks right away, the random delay can't be drawn from it.
+	var delay time.Duration
+	switch {
+	case interval <= 0:
+	case initial:
+		delay = time.Duration(h.random.Int63n(int64(interval)))
+	default:
+		delta := (h.random.Float64()*2 - 1) * h.jitter() * float64(interval)
+		delay = interval + time.Duration(delta)
+	}
+	entry.next = now.Add(delay)
+	heap.Push(&h.queue, entry)
 }
 
-func (h *Health) checkConstraint(
-	ctx context.Context, healty bool, node service.Node,
-) (bool, error) {
-	if healty {
-		if err := h.Config.CheckRepository.Update(ctx, node.ID, 0); err != nil {
-			return false, fmt.Errorf("failed to update the check counter: %w", err)
+func (h *Health) unschedule(entry *healthEntry) {
+	if entry.index >= 0 {
+		heap.Remove(&h.queue, entry.index)
+	}
+}
+
+// dispatch start the checks that are due, limited by the concurrency.
+func (h *Health) dispatch(now time.Time) {
+	for len(h.queue) > 0 && h.running < h.concurrency() {
+		if h.queue[0].next.After(now) {
+			return
 		}
-		return false, nil
+		entry := heap.Pop(&h.queue).(*healthEntry)
+		report := entry.report
+		entry.report = nil
+		entry.running = true
+		h.running++
+		h.wg.Add(1)
+		go h.run(entry, entry.node, entry.checker, report)
 	}
+}
 
-	value, err := h.Config.CheckRepository.Increment(ctx, node.ID)
+// resetTimer arm the timer to the next check. The timer stays stopped when there is nothing to
+// check or the concurrency is exhausted, a result will trigger the next dispatch.
+func (h *Health) resetTimer(timer *time.Timer) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+	if len(h.queue) == 0 || h.running >= h.concurrency() {
+		return
+	}
+	timer.Reset(time.Until(h.queue[0].next))
+}
+
+func (h *Health) run(
+	entry *healthEntry, node service.Node, checker Checker, report *service.NodeStatus,
+) {
+	defer h.wg.Done()
+
+	var healthy bool
+	if report != nil {
+		healthy = h.checkReport(h.ctx, node, *report)
+	} else {
+		healthy = h.check(h.ctx, node, checker)
+	}
+	if err := h.transition(h.ctx, healthy, node); err != nil {
+		h.Config.Logger.Error().Err(err).Msg("failed to update the node health")
+	}
+
+	select {
+	case h.results <- entry:
+	case <-h.ctx.Done():
+	}
+}
+
+// prepare the checker of the node. A check that can't be prepared fails with the error, this way
+// the failure is at the node history.
+func (h *Health) prepare(node service.Node) Checker {
+	checkType := nodeCheckType(node)
+	checker, ok := h.Config.Checkers[checkType]
+	if !ok {
+		return failedChecker{err: fmt.Errorf("checker '%s' not available", checkType)}
+	}
+	preparer, ok := checker.(PreparedChecker)
+	if !ok {
+		return checker
+	}
+	prepared, err := preparer.Prepare(node)
+	if err != nil {
+		return failedChecker{err: fmt.Errorf("failed to prepare the check: %w", err)}
+	}
+	return prepared
+}
+
+func (h *Health) check(ctx context.Context, node service.Node, checker Checker) bool {
+	checkType := nodeCheckType(node)
+	checkCtx, checkCtxCancel := context.WithTimeout(ctx, h.timeout())
+	defer checkCtxCancel()
+
+	h.Config.Logger.Debug().
+		Str("address", node.Address).
+		Str("checker", string(checkType)).
+		Msg("Executing health check")
+	start := time.Now()
+	status, err := checker.Check(checkCtx, node)
+	result := service.NodeCheckResult{
+		NodeID:     node.ID,
+		ObserverID: h.Config.ObserverID,
+		Type:       checkType,
+		CheckedAt:  start.UTC(),
+		Latency:    time.Since(start),
+		Status:     status,
+		Healthy:    err == nil,
+	}
 	if err != nil {
-		return false, fmt.Errorf("failed to increment the check counter: %w", err)
+		result.Error = err.Error()
+		h.Config.Logger.Error().Err(err).Msgf("failed to check the health of node '%d'", node.ID)
 	}
+	h.record(ctx, result)
+	return result.Healthy
+}
 
-	if value < h.Config.MaxFailures {
-		return false, nil
+// checkReport use a status reported by the node as the outcome of a check.
+func (h *Health) checkReport(ctx context.Context, node service.Node, status service.NodeStatus) bool {
+	err := statusError(status)
+	result := service.NodeCheckResult{
+		NodeID:     node.ID,
+		ObserverID: h.Config.ObserverID,
+		Type:       service.NodeCheckTypeStatus,
+		CheckedAt:  status.ReportedAt.UTC(),
+		Healthy:    err == nil,
+	}
+	if err != nil {
+		result.Error = err.Error()
+		h.Config.Logger.Error().Err(err).Msgf("node '%d' reported a failing status", node.ID)
 	}
+	h.record(ctx, result)
+	return result.Healthy
+}
 
-	node.Active = false
-	if err := h.Config.Repository.Update(ctx, node); err != nil {
-		return false, fmt.Errorf("failed to update the node: %w", err)
+func (h *Health) record(ctx context.Context, result service.NodeCheckResult) {
+	if h.Config.HistoryRepository == nil {
+		return
+	}
+	if err := h.Config.HistoryRepository.Insert(ctx, result, h.historySize()); err != nil {
+		h.Config.Logger.Error().Err(err).Msgf("failed to record the check of node '%d'", result.NodeID)
 	}
-	return true, nil
 }
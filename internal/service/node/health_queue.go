@@ -0,0 +1,53 @@
+package node
+
+import (
+	"time"
+
+	"malta/internal/service"
+)
+
+// healthEntry is the check schedule of a node.
+type healthEntry struct {
+	node       service.Node
+	recovering bool
+	running    bool
+	next       time.Time
+
+	// Checker prepared for the node check, it's prepared again only when the check changes.
+	checker Checker
+
+	// Status reported by the node, it's used instead of the next check.
+	report *service.NodeStatus
+
+	// Position at the queue, -1 when the entry is not queued.
+	index int
+}
+
+// healthQueue is a min-heap of entries ordered by the next check.
+type healthQueue []*healthEntry
+
+func (q healthQueue) Len() int { return len(q) }
+
+func (q healthQueue) Less(i, j int) bool { return q[i].next.Before(q[j].next) }
+
+func (q healthQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *healthQueue) Push(x interface{}) {
+	entry := x.(*healthEntry)
+	entry.index = len(*q)
+	*q = append(*q, entry)
+}
+
+func (q *healthQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	entry := old[n-1]
+	old[n-1] = nil
+	entry.index = -1
+	*q = old[:n-1]
+	return entry
+}
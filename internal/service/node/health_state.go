@@ -0,0 +1,323 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"malta/internal/service"
+)
+
+// transition record the outcome of a check and move the node to its next health state. The outcome
+// is ignored if the node was enabled or disabled while being checked, and the failures are ignored
+// during the grace period.
+//
+// Each observer moves its own view of the node through the state machine and shares it as an
+// observation, the node state is then derived from the fresh observations of all the observers.
+func (h *Health) transition(ctx context.Context, healthy bool, node service.Node) error {
+	id := node.ID
+	now := time.Now().UTC()
+	if !healthy && h.inGracePeriod(node, now) {
+		h.Config.Logger.Debug().Int("nodeID", id).Msg("check failure ignored during the grace period")
+		return nil
+	}
+
+	active := node.Active
+	counter, err := h.Config.CheckRepository.Record(
+		ctx, id, h.Config.ObserverID, healthy, h.Config.FailureWindow,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record the check: %w", err)
+	}
+
+	observations, err := h.observe(ctx, node, healthy, counter, now)
+	if err != nil {
+		return err
+	}
+	observed := observations[len(observations)-1].Health
+	if unhealthy(observed) && len(observations) < h.quorum() {
+		h.Config.Logger.Warn().
+			Int("nodeID", id).
+			Int("observers", len(observations)).
+			Int("quorum", h.quorum()).
+			Msg("node unhealthy but the quorum can't be reached with the fresh observations")
+	}
+
+	actor := service.NodeAuditActor{Kind: service.NodeAuditActorKindHealth, ID: h.Config.ObserverID}
+	ctx = service.WithNodeAuditActor(ctx, actor)
+
+	var current, next service.NodeHealth
+	_, err = h.Config.Manager.Change(ctx, id, func(node *service.Node) bool {
+		if node.Active != active {
+			return false
+		}
+		current = node.Health
+		if current == "" {
+			current = service.NodeHealthHealthy
+		}
+		next = h.quorumHealth(current, observed, observations)
+		if next == current {
+			return healthy && h.renewLease(node, now)
+		}
+
+		node.Health = next
+		node.HealthChangedAt = now
+		switch next {
+		case service.NodeHealthUnhealthy:
+			node.Active = false
+		case service.NodeHealthHealthy:
+			if current == service.NodeHealthPending {
+				node.Active = true
+				renewLease(node, now)
+			} else if !node.Active {
+				node.Active = true
+				node.ReactivatedAt = now
+				renewLease(node, now)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("failed to change the node: %w", err)
+	}
+	if current == next {
+		return nil
+	}
+
+	h.Config.Logger.Info().
+		Int("nodeID", id).
+		Str("from", string(current)).
+		Str("to", string(next)).
+		Msg("node health changed")
+	return nil
+}
+
+// renewLease extend the lease of an active node after a successful check, the check proves the node
+// is alive as much as a heartbeat. The lease is extended at least until the next check is done, and
+// only when it would expire before that, this way the node isn't written at every check. It returns
+// if the node changed.
+func (h *Health) renewLease(node *service.Node, now time.Time) bool {
+	if !node.Active || node.TTL <= 0 {
+		return false
+	}
+	next := time.Duration(float64(h.Config.Interval)*(1+h.jitter())) + h.timeout()
+	if !node.ExpiresAt.IsZero() && node.ExpiresAt.Sub(now) > next {
+		return false
+	}
+
+	lease := node.TTL
+	if lease < next {
+		lease = next
+	}
+	node.LastSeen = now
+	node.ExpiresAt = now.Add(lease)
+	return true
+}
+
+// observe move the observer view of the node to its next health state and share it. The fresh
+// observations of all the observers are returned, the one of this observer is the last.
+func (h *Health) observe(
+	ctx context.Context,
+	node service.Node,
+	healthy bool,
+	counter service.NodeCheckCounter,
+	now time.Time,
+) ([]service.NodeObservation, error) {
+	var observations []service.NodeObservation
+	if h.Config.ObservationRepository != nil {
+		var err error
+		observations, err = h.Config.ObservationRepository.Select(
+			ctx, node.ID, now.Add(-h.observationTimeout()),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch the observations: %w", err)
+		}
+	}
+
+	// Without a fresh observation the observer starts from the node state.
+	current := node.Health
+	if current == "" {
+		current = service.NodeHealthHealthy
+	}
+	others := observations[:0]
+	for _, observation := range observations {
+		if observation.ObserverID == h.Config.ObserverID {
+			current = observation.Health
+			continue
+		}
+		others = append(others, observation)
+	}
+
+	observation := service.NodeObservation{
+		NodeID:     node.ID,
+		ObserverID: h.Config.ObserverID,
+		Health:     h.nextHealth(current, healthy, counter),
+		ObservedAt: now,
+	}
+	if observation.Health == service.NodeHealthHealthy && current != service.NodeHealthHealthy {
+		if err := h.Config.CheckRepository.Reset(ctx, node.ID, h.Config.ObserverID); err != nil {
+			return nil, fmt.Errorf("failed to reset the check counters: %w", err)
+		}
+	}
+	if h.Config.ObservationRepository != nil {
+		if err := h.Config.ObservationRepository.Upsert(ctx, observation); err != nil {
+			return nil, fmt.Errorf("failed to share the observation: %w", err)
+		}
+	}
+	return append(others, observation), nil
+}
+
+// quorumHealth derive the node health from the observations. The node is only disabled once the
+// quorum of observers see it as unhealthy, and it's enabled again by the first observer that sees it
+// healthy while the quorum isn't reached.
+func (h *Health) quorumHealth(
+	current, observed service.NodeHealth, observations []service.NodeObservation,
+) service.NodeHealth {
+	var votes int
+	var suspect, recovering bool
+	for _, observation := range observations {
+		switch observation.Health {
+		case service.NodeHealthUnhealthy:
+			votes++
+		case service.NodeHealthRecovering:
+			votes++
+			recovering = true
+		case service.NodeHealthSuspect:
+			suspect = true
+		}
+	}
+	quorum := votes >= h.quorum()
+
+	switch current {
+	case service.NodeHealthPending:
+		switch {
+		case quorum:
+			return service.NodeHealthUnhealthy
+		case observed == service.NodeHealthHealthy:
+			return service.NodeHealthHealthy
+		default:
+			return service.NodeHealthPending
+		}
+	case service.NodeHealthUnhealthy, service.NodeHealthRecovering:
+		switch {
+		case observed == service.NodeHealthHealthy && !quorum:
+			return service.NodeHealthHealthy
+		case recovering:
+			return service.NodeHealthRecovering
+		default:
+			return service.NodeHealthUnhealthy
+		}
+	default:
+		switch {
+		case quorum:
+			return service.NodeHealthUnhealthy
+		case votes > 0 || suspect:
+			return service.NodeHealthSuspect
+		default:
+			return service.NodeHealthHealthy
+		}
+	}
+}
+
+// nextHealth is the health state machine. The failures of a suspect node are only forgotten after
+// the success threshold, this way a node failing intermittently still reaches the failure threshold.
+func (h *Health) nextHealth(
+	current service.NodeHealth, healthy bool, counter service.NodeCheckCounter,
+) service.NodeHealth {
+	switch current {
+	case service.NodeHealthPending:
+		if healthy {
+			return service.NodeHealthHealthy
+		}
+		if h.failing(counter) {
+			return service.NodeHealthUnhealthy
+		}
+		return service.NodeHealthPending
+	case service.NodeHealthSuspect:
+		if h.failing(counter) {
+			return service.NodeHealthUnhealthy
+		}
+		if healthy && counter.Successes >= h.successThreshold() {
+			return service.NodeHealthHealthy
+		}
+		return service.NodeHealthSuspect
+	case service.NodeHealthUnhealthy, service.NodeHealthRecovering:
+		if !healthy {
+			return service.NodeHealthUnhealthy
+		}
+		if counter.Successes >= h.Config.RecoverySuccesses {
+			return service.NodeHealthHealthy
+		}
+		return service.NodeHealthRecovering
+	default:
+		if healthy {
+			return service.NodeHealthHealthy
+		}
+		if h.failing(counter) {
+			return service.NodeHealthUnhealthy
+		}
+		return service.NodeHealthSuspect
+	}
+}
+
+// failing check if the node reached the failure threshold or the failure ratio of the window.
+func (h *Health) failing(counter service.NodeCheckCounter) bool {
+	if counter.Failures >= h.Config.MaxFailures {
+		return true
+	}
+
+	window := h.Config.FailureWindow
+	if window <= 0 || h.Config.FailureRatio <= 0 || len(counter.Outcomes) < window {
+		return false
+	}
+	var failures int
+	for _, healthy := range counter.Outcomes[len(counter.Outcomes)-window:] {
+		if !healthy {
+			failures++
+		}
+	}
+	return float64(failures)/float64(window) >= h.Config.FailureRatio
+}
+
+// inGracePeriod check if the node is still at the grace period after its registration. The grace
+// period of the node check takes precedence over the default one.
+func (h *Health) inGracePeriod(node service.Node, now time.Time) bool {
+	grace := h.Config.GracePeriod
+	if node.Check.GracePeriod > 0 {
+		grace = node.Check.GracePeriod
+	}
+	registeredAt := node.RegisteredAt
+	if registeredAt.IsZero() {
+		registeredAt = node.CreatedAt
+	}
+	return grace > 0 && now.Before(registeredAt.Add(grace))
+}
+
+func unhealthy(health service.NodeHealth) bool {
+	return health == service.NodeHealthUnhealthy || health == service.NodeHealthRecovering
+}
+
+func (h *Health) quorum() int {
+	if h.Config.Quorum > 0 {
+		return h.Config.Quorum
+	}
+	return 1
+}
+
+func (h *Health) observationTimeout() time.Duration {
+	if h.Config.ObservationTimeout > 0 {
+		return h.Config.ObservationTimeout
+	}
+	interval := h.Config.Interval
+	if h.Config.RecoveryInterval > interval {
+		interval = h.Config.RecoveryInterval
+	}
+	return 3 * interval
+}
+
+func (h *Health) successThreshold() int {
+	if h.Config.SuccessThreshold > 0 {
+		return h.Config.SuccessThreshold
+	}
+	return 1
+}
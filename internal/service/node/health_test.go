@@ -0,0 +1,369 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"malta/internal/service"
+)
+
+func TestHealthScheduleJitter(t *testing.T) {
+	interval := time.Second
+	h := Health{
+		Config: HealthConfig{Interval: interval, Jitter: 0.2},
+		random: rand.New(rand.NewSource(1)),
+	}
+	now := time.Now()
+
+	var initialMin, initialMax, nextMin, nextMax time.Duration
+	for i := 0; i < 1000; i++ {
+		initial := &healthEntry{index: -1}
+		h.schedule(now, initial, true)
+		next := &healthEntry{index: -1}
+		h.schedule(now, next, false)
+
+		initialDelay, nextDelay := initial.next.Sub(now), next.next.Sub(now)
+		if initialDelay < 0 || initialDelay >= interval {
+			t.Fatalf("initial delay '%s' outside of the interval", initialDelay)
+		}
+		if nextDelay < 800*time.Millisecond || nextDelay > 1200*time.Millisecond {
+			t.Fatalf("delay '%s' outside of the jitter", nextDelay)
+		}
+		if i == 0 || initialDelay < initialMin {
+			initialMin = initialDelay
+		}
+		if i == 0 || initialDelay > initialMax {
+			initialMax = initialDelay
+		}
+		if i == 0 || nextDelay < nextMin {
+			nextMin = nextDelay
+		}
+		if i == 0 || nextDelay > nextMax {
+			nextMax = nextDelay
+		}
+	}
+
+	if initialMin > 100*time.Millisecond || initialMax < 900*time.Millisecond {
+		t.Errorf("initial delays not spread over the interval: '%s' to '%s'", initialMin, initialMax)
+	}
+	if nextMin > 850*time.Millisecond || nextMax < 1150*time.Millisecond {
+		t.Errorf("delays not spread over the jitter: '%s' to '%s'", nextMin, nextMax)
+	}
+	if len(h.queue) != 2000 {
+		t.Errorf("expected 2000 queued entries, got %d", len(h.queue))
+	}
+}
+
+func TestHealthScheduleNonPositiveInterval(t *testing.T) {
+	h := Health{random: rand.New(rand.NewSource(1))}
+	now := time.Now()
+
+	for _, recovering := range []bool{false, true} {
+		entry := &healthEntry{index: -1, recovering: recovering}
+		h.schedule(now, entry, true)
+		if !entry.next.Equal(now) {
+			t.Errorf("expected the check right away, got '%s'", entry.next.Sub(now))
+		}
+	}
+}
+
+func TestHealthChangesWhileChecking(t *testing.T) {
+	manager := newTestManager(service.Node{ID: 1, Address: "a", Active: true})
+	checker := newTestChecker()
+	h := newTestHealth(manager, checker)
+	if err := h.Start(); err != nil {
+		t.Fatalf("failed to start: %s", err)
+	}
+	defer h.Stop()
+
+	// The node is updated while being checked, the next check uses the new state.
+	call := checker.wait(t)
+	if call.node.Address != "a" {
+		t.Fatalf("expected the address 'a', got '%s'", call.node.Address)
+	}
+	manager.update(service.Node{ID: 1, Address: "b", Active: true})
+	close(call.release)
+	call = checker.wait(t)
+	if call.node.Address != "b" {
+		t.Fatalf("expected the address 'b', got '%s'", call.node.Address)
+	}
+
+	// The node is deleted and created again while being checked, only the new entry is checked.
+	manager.delete(1)
+	manager.create(service.Node{ID: 1, Address: "c", Active: true})
+	close(call.release)
+	for i := 0; i < 3; i++ {
+		call = checker.wait(t)
+		if call.node.Address != "c" {
+			t.Fatalf("expected the address 'c', got '%s'", call.node.Address)
+		}
+		close(call.release)
+	}
+
+	// The node is deleted while being checked, it's not checked anymore.
+	call = checker.wait(t)
+	manager.delete(1)
+	close(call.release)
+	checker.idle(t, 10*testHealthInterval)
+}
+
+func TestHealthPrepare(t *testing.T) {
+	manager := newTestManager(service.Node{ID: 1, Address: "a", Active: true})
+	checker := &testPreparedChecker{testChecker: newTestChecker()}
+	h := newTestHealth(manager, checker.testChecker)
+	h.Config.Checkers[service.NodeCheckTypeHTTP] = checker
+	if err := h.Start(); err != nil {
+		t.Fatalf("failed to start: %s", err)
+	}
+	defer h.Stop()
+
+	// The check is prepared again only when the node check changes.
+	call := checker.wait(t)
+	manager.update(service.Node{ID: 1, Address: "a", Active: true, ExpiresAt: time.Now()})
+	close(call.release)
+	call = checker.wait(t)
+	if prepares := checker.prepared(); prepares != 1 {
+		t.Fatalf("expected a single prepare, got %d", prepares)
+	}
+
+	node := service.Node{ID: 1, Address: "a", Active: true}
+	node.Check.HTTP.Path = "/ready"
+	manager.update(node)
+	close(call.release)
+	call = checker.wait(t)
+	defer close(call.release)
+	if prepares := checker.prepared(); prepares != 2 {
+		t.Fatalf("expected the check to be prepared again, got %d prepares", prepares)
+	}
+	if call.node.Check.HTTP.Path != "/ready" {
+		t.Fatalf("expected the path '/ready', got '%s'", call.node.Check.HTTP.Path)
+	}
+}
+
+func TestHealthQuorumWarning(t *testing.T) {
+	for _, quorum := range []int{1, 2} {
+		var logs bytes.Buffer
+		manager := newTestManager(service.Node{ID: 1, Address: "a", Active: true})
+		h := newTestHealth(manager, newTestChecker())
+		h.Config.CheckRepository = testCheckRepository{failures: 1}
+		h.Config.MaxFailures = 1
+		h.Config.Quorum = quorum
+		h.Config.Logger = zerolog.New(&logs)
+
+		if err := h.transition(context.Background(), false, manager.List()[0]); err != nil {
+			t.Fatalf("failed to transition: %s", err)
+		}
+		warned := strings.Contains(logs.String(), "the quorum can't be reached")
+		active := manager.List()[0].Active
+		if warned != (quorum == 2) || active != (quorum == 2) {
+			t.Errorf(
+				"unexpected state with the quorum %d: warned '%t', active '%t'", quorum, warned, active,
+			)
+		}
+	}
+}
+
+func TestHealthStopWhileChecking(t *testing.T) {
+	var nodes []service.Node
+	for id := 1; id <= 3; id++ {
+		nodes = append(nodes, service.Node{ID: id, Address: "a", Active: true})
+	}
+	manager := newTestManager(nodes...)
+	checker := newTestChecker()
+	h := newTestHealth(manager, checker)
+	if err := h.Start(); err != nil {
+		t.Fatalf("failed to start: %s", err)
+	}
+
+	// The checks are never released, they're only finished by the cancellation.
+	for range nodes {
+		checker.wait(t)
+	}
+	stopped := make(chan struct{})
+	go func() {
+		h.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("stop didn't wait for the running checks to be canceled")
+	}
+	checker.idle(t, 5*testHealthInterval)
+}
+
+const testHealthInterval = 10 * time.Millisecond
+
+func newTestHealth(manager *testManager, checker *testChecker) *Health {
+	return &Health{Config: HealthConfig{
+		Interval:        testHealthInterval,
+		Manager:         manager,
+		CheckRepository: testCheckRepository{},
+		ObserverID:      "test",
+		Concurrency:     4,
+		MaxFailures:     1000,
+		Checkers:        map[service.NodeCheckType]Checker{service.NodeCheckTypeHTTP: checker},
+		Logger:          zerolog.Nop(),
+	}}
+}
+
+// testManager keeps the nodes in memory and publishes the changes made by the test.
+type testManager struct {
+	mutex      sync.Mutex
+	nodes      map[int]service.Node
+	subscriber func(service.NodeEvent)
+}
+
+func newTestManager(nodes ...service.Node) *testManager {
+	m := &testManager{nodes: make(map[int]service.Node)}
+	for _, node := range nodes {
+		m.nodes[node.ID] = node
+	}
+	return m
+}
+
+func (m *testManager) List() []service.Node {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	nodes := make([]service.Node, 0, len(m.nodes))
+	for _, node := range m.nodes {
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+func (m *testManager) Change(
+	_ context.Context, id int, fn func(node *service.Node) bool,
+) (service.Node, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	node, ok := m.nodes[id]
+	if !ok {
+		return service.Node{}, service.NewError(service.ErrorKindNotFound, "node '%d' not found", id)
+	}
+	if fn(&node) {
+		m.nodes[id] = node
+	}
+	return node, nil
+}
+
+func (m *testManager) Subscribe(fn func(service.NodeEvent)) func() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.subscriber = fn
+	return func() {}
+}
+
+func (m *testManager) create(node service.Node) {
+	m.publish(service.NodeEvent{Type: service.NodeEventTypeCreated, Node: node})
+}
+
+func (m *testManager) update(node service.Node) {
+	m.publish(service.NodeEvent{Type: service.NodeEventTypeUpdated, Node: node})
+}
+
+func (m *testManager) delete(id int) {
+	m.mutex.Lock()
+	node := m.nodes[id]
+	m.mutex.Unlock()
+	m.publish(service.NodeEvent{Type: service.NodeEventTypeDeleted, Node: node})
+}
+
+func (m *testManager) publish(event service.NodeEvent) {
+	m.mutex.Lock()
+	if event.Type == service.NodeEventTypeDeleted {
+		delete(m.nodes, event.Node.ID)
+	} else {
+		m.nodes[event.Node.ID] = event.Node
+	}
+	subscriber := m.subscriber
+	m.mutex.Unlock()
+	subscriber(event)
+}
+
+// testCheckRepository returns the same counter for every check, the nodes are always healthy unless
+// the failures are set.
+type testCheckRepository struct {
+	failures int
+}
+
+func (r testCheckRepository) Record(
+	context.Context, int, string, bool, int,
+) (service.NodeCheckCounter, error) {
+	if r.failures > 0 {
+		return service.NodeCheckCounter{Failures: r.failures}, nil
+	}
+	return service.NodeCheckCounter{Successes: 1}, nil
+}
+
+func (testCheckRepository) Reset(context.Context, int, string) error {
+	return nil
+}
+
+// testChecker hands each check to the test, which decides when it finishes.
+type testChecker struct {
+	calls chan testCheckerCall
+}
+
+type testCheckerCall struct {
+	node    service.Node
+	release chan struct{}
+}
+
+func newTestChecker() *testChecker {
+	return &testChecker{calls: make(chan testCheckerCall, 100)}
+}
+
+func (c *testChecker) Check(ctx context.Context, node service.Node) (int, error) {
+	call := testCheckerCall{node: node, release: make(chan struct{})}
+	c.calls <- call
+	select {
+	case <-call.release:
+		return 200, nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+func (c *testChecker) wait(t *testing.T) testCheckerCall {
+	t.Helper()
+	select {
+	case call := <-c.calls:
+		return call
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for a check")
+		return testCheckerCall{}
+	}
+}
+
+func (c *testChecker) idle(t *testing.T, wait time.Duration) {
+	t.Helper()
+	select {
+	case call := <-c.calls:
+		t.Fatalf("unexpected check of node '%d'", call.node.ID)
+	case <-time.After(wait):
+	}
+}
+
+// testPreparedChecker counts the checks prepared.
+type testPreparedChecker struct {
+	*testChecker
+	prepares int64
+}
+
+func (c *testPreparedChecker) Prepare(service.Node) (Checker, error) {
+	atomic.AddInt64(&c.prepares, 1)
+	return c.testChecker, nil
+}
+
+func (c *testPreparedChecker) prepared() int64 {
+	return atomic.LoadInt64(&c.prepares)
+}
@@ -0,0 +1,79 @@
+package node
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type jsonPathSegment struct {
+	key   string
+	index int
+	array bool
+}
+
+// parseJSONPath parse a subset of JSONPath with only child keys and array indexes, like
+// '$.checks[0].state'.
+func parseJSONPath(path string) ([]jsonPathSegment, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("path should start with '$'")
+	}
+
+	var (
+		segments []jsonPathSegment
+		rest     = path[1:]
+	)
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end == -1 {
+				end = len(rest) - 1
+			}
+			key := rest[1 : end+1]
+			if key == "" {
+				return nil, fmt.Errorf("empty key at '%s'", path)
+			}
+			segments = append(segments, jsonPathSegment{key: key})
+			rest = rest[end+1:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end == -1 {
+				return nil, fmt.Errorf("unclosed bracket at '%s'", path)
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid index '%s' at '%s'", rest[1:end], path)
+			}
+			segments = append(segments, jsonPathSegment{index: index, array: true})
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("unexpected character '%c' at '%s'", rest[0], path)
+		}
+	}
+	return segments, nil
+}
+
+// evalJSONPath return the value found at the path of a decoded JSON document.
+func evalJSONPath(document interface{}, segments []jsonPathSegment) (interface{}, bool) {
+	value := document
+	for _, segment := range segments {
+		if segment.array {
+			values, ok := value.([]interface{})
+			if !ok || segment.index >= len(values) {
+				return nil, false
+			}
+			value = values[segment.index]
+			continue
+		}
+
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = object[segment.key]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
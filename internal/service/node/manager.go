@@ -1,4 +1,510 @@
 package node
 
-// Manager is responsible for keeping track of the health state of each node of the cluster.
-type Manager struct{}
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"malta/internal/database"
+	"malta/internal/service"
+)
+
+// managerLocks is the quantity of locks used to serialize the changes of the nodes, the nodes share
+// them by id.
+const managerLocks = 64
+
+// ManagerRepository is used to load and persist the nodes.
+type ManagerRepository interface {
+	Select(ctx context.Context, query service.NodeQuery) ([]service.Node, error)
+	SelectOne(ctx context.Context, id string) (service.Node, error)
+	SelectOneTx(tx *sql.Tx, id string) (service.Node, error)
+	SelectOneByAddressTx(tx *sql.Tx, address string) (service.Node, error)
+	Insert(tx *sql.Tx, node service.Node) (service.Node, bool, error)
+	UpdateTx(tx *sql.Tx, node service.Node) error
+	ResetCheck(tx *sql.Tx, id int) error
+	Delete(tx *sql.Tx, id int) error
+}
+
+// ManagerOutboxRepository is used to write the changes made by the manager to the outbox.
+type ManagerOutboxRepository interface {
+	Insert(tx *sql.Tx, event service.NodeOutboxEvent) error
+}
+
+// ManagerAuditRepository is used to record the changes made by the manager at the audit history.
+type ManagerAuditRepository interface {
+	Insert(tx *sql.Tx, event service.NodeAuditEvent) error
+}
+
+// ManagerOutbox delivers the changes of the nodes made by all the servers.
+type ManagerOutbox interface {
+	Position(ctx context.Context) (int, error)
+	Subscribe(position int, fn func(context.Context, service.NodeOutboxEvent) error) func()
+	Dispatch(ctx context.Context)
+}
+
+// ManagerConfig used to setup the manager internal state.
+type ManagerConfig struct {
+	Repository         ManagerRepository
+	OutboxRepository   ManagerOutboxRepository
+	AuditRepository    ManagerAuditRepository
+	Outbox             ManagerOutbox
+	Transaction        database.Transaction
+	TransactionHandler func(*sql.Tx, error) error
+
+	// SyncInterval used to reload all the nodes. The changes made by the other servers sharing the
+	// database are delivered by the outbox, the sync only catches the ones discarded by the outbox
+	// retention before being seen. The sync is disabled if the interval is zero.
+	SyncInterval time.Duration
+
+	Logger zerolog.Logger
+}
+
+// Manager is responsible for keeping track of the health state of each node of the cluster. Every
+// change of the nodes goes through it and is persisted before it's visible at the in memory view
+// and delivered to the subscribers. The in memory view only moves with the outbox, so the revision
+// of each change is the id of its outbox event and it's the same at all the servers.
+type Manager struct {
+	Config ManagerConfig
+
+	// The mutex guards the in memory state and the locks serialize the changes of each node, this
+	// way the database isn't accessed while holding the mutex.
+	mutex       sync.RWMutex
+	locks       [managerLocks]sync.Mutex
+	nodes       map[int]service.Node
+	revision    int
+	subscribers map[int]func(service.NodeEvent)
+	sequence    int
+	unsubscribe func()
+
+	ctx       context.Context
+	ctxCancel func()
+	wg        sync.WaitGroup
+}
+
+// Init internal state.
+func (m *Manager) Init() error {
+	if m.Config.Repository == nil {
+		return fmt.Errorf("missing repository")
+	}
+	if m.Config.OutboxRepository == nil {
+		return fmt.Errorf("missing outbox repository")
+	}
+	if m.Config.Outbox == nil {
+		return fmt.Errorf("missing outbox")
+	}
+	if m.Config.AuditRepository == nil {
+		return fmt.Errorf("missing audit repository")
+	}
+	m.nodes = make(map[int]service.Node)
+	m.subscribers = make(map[int]func(service.NodeEvent))
+	return nil
+}
+
+// Start load the nodes and keep them in sync with the database. The outbox position is taken
+// before the load, so no change is missed in between.
+func (m *Manager) Start() error {
+	position, err := m.Config.Outbox.Position(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to fetch the outbox position: %w", err)
+	}
+	nodes, err := m.Config.Repository.Select(
+		context.Background(), service.NodeQuery{State: service.NodeQueryStateAll},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to fetch the nodes: %w", err)
+	}
+
+	m.mutex.Lock()
+	for _, node := range nodes {
+		m.set(node, uint64(position))
+	}
+	m.revision = position
+	m.mutex.Unlock()
+
+	m.unsubscribe = m.Config.Outbox.Subscribe(position, m.apply)
+	if m.Config.SyncInterval == 0 {
+		return nil
+	}
+
+	m.ctx, m.ctxCancel = context.WithCancel(context.Background())
+	m.wg.Add(1)
+	go m.process()
+	return nil
+}
+
+// Stop the sync.
+func (m *Manager) Stop() {
+	if m.unsubscribe != nil {
+		m.unsubscribe()
+	}
+	if m.ctxCancel == nil {
+		return
+	}
+	m.ctxCancel()
+	m.wg.Wait()
+}
+
+// Get a node.
+func (m *Manager) Get(id int) (service.Node, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	node, ok := m.nodes[id]
+	return node, ok
+}
+
+// List all the nodes.
+func (m *Manager) List() []service.Node {
+	nodes, _ := m.Snapshot()
+	return nodes
+}
+
+// Snapshot return all the nodes and the revision of the last change applied to them.
+func (m *Manager) Snapshot() ([]service.Node, uint64) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	nodes := make([]service.Node, 0, len(m.nodes))
+	for _, node := range m.nodes {
+		nodes = append(nodes, node)
+	}
+	return nodes, uint64(m.revision)
+}
+
+// Register a node. If a node with the same address already exists, it's changed by the function
+// instead and its check starts from scratch, the boolean is true only when a new node was created.
+// The registration is recorded at the audit history as made by the API, unless the context has an
+// actor.
+func (m *Manager) Register(
+	ctx context.Context, node service.Node, fn func(node *service.Node),
+) (_ service.Node, created bool, err error) {
+	// The node is only known by its address, the lock taken is the one of the node registered with
+	// it. The registration of a new address doesn't need one, the transaction holds the write lock of
+	// the database as it begins.
+	id, _ := m.lookup(node.Address)
+	err = m.write(ctx, id, func(tx *sql.Tx) (bool, error) {
+		inserted, ok, err := m.Config.Repository.Insert(tx, node)
+		if err != nil {
+			return false, fmt.Errorf("failed to insert the node: %w", err)
+		}
+		if ok {
+			node, created = inserted, true
+			auditEvent := newAuditEvent(
+				ctx, service.NodeAuditEventTypeRegistered, service.NodeAuditActorKindAPI, node.ID,
+				map[string]string{}, auditState(node),
+			)
+			return true, m.record(
+				tx, newOutboxEvent(service.NodeEventTypeCreated, service.Node{}, node), &auditEvent,
+			)
+		}
+
+		current, err := m.Config.Repository.SelectOneByAddressTx(tx, node.Address)
+		if err != nil {
+			return false, fmt.Errorf("failed to fetch the registered node: %w", err)
+		}
+		previous := auditState(current)
+		node = current
+		fn(&node)
+		if err := m.Config.Repository.UpdateTx(tx, node); err != nil {
+			return false, fmt.Errorf("failed to update the registered node: %w", err)
+		}
+		if err := m.Config.Repository.ResetCheck(tx, node.ID); err != nil {
+			return false, fmt.Errorf("failed to reset the node check: %w", err)
+		}
+		before, after := auditDiff(previous, auditState(node))
+		auditEvent := newAuditEvent(
+			ctx, service.NodeAuditEventTypeRegistered, service.NodeAuditActorKindAPI, node.ID,
+			before, after,
+		)
+		return true, m.record(
+			tx, newOutboxEvent(service.NodeEventTypeUpdated, current, node), &auditEvent,
+		)
+	})
+	if err != nil {
+		return service.Node{}, false, err
+	}
+	return node, created, nil
+}
+
+// Update a node with the given function and persist it. The change is discarded if the function
+// returns false or an error, the error is returned as is. The node is read and written at the same
+// transaction while holding the lock of the node, so the function always receives the latest state
+// and the changes made in between by another server are not overwritten. The change is recorded at
+// the audit history as made by the given actor kind, unless the context has an actor. The audit
+// event is skipped if no audited field changed.
+func (m *Manager) Update(
+	ctx context.Context,
+	id int,
+	kind service.NodeAuditActorKind,
+	fn func(node *service.Node) (bool, error),
+) (service.Node, error) {
+	var node service.Node
+	err := m.write(ctx, id, func(tx *sql.Tx) (bool, error) {
+		current, err := m.Config.Repository.SelectOneTx(tx, strconv.Itoa(id))
+		if err != nil {
+			return false, fmt.Errorf("failed to fetch the node: %w", err)
+		}
+		previous := auditState(current)
+		node = current
+		if ok, err := fn(&node); err != nil || !ok {
+			node = current
+			return false, err
+		}
+
+		if err := m.Config.Repository.UpdateTx(tx, node); err != nil {
+			return false, fmt.Errorf("failed to update the node: %w", err)
+		}
+		event := newOutboxEvent(service.NodeEventTypeUpdated, current, node)
+		before, after := auditDiff(previous, auditState(node))
+		if len(before) == 0 && len(after) == 0 {
+			return true, m.record(tx, event, nil)
+		}
+		auditEvent := newAuditEvent(ctx, auditEventType(current, node), kind, id, before, after)
+		return true, m.record(tx, event, &auditEvent)
+	})
+	if err != nil {
+		return service.Node{}, err
+	}
+	return node, nil
+}
+
+// Change a node with the given function, it's an update made by the health checker. Only the nodes
+// already known are changed.
+func (m *Manager) Change(
+	ctx context.Context, id int, fn func(node *service.Node) bool,
+) (service.Node, error) {
+	if _, ok := m.Get(id); !ok {
+		return service.Node{}, service.NewError(service.ErrorKindNotFound, "node '%d' not found", id)
+	}
+	return m.Update(ctx, id, service.NodeAuditActorKindHealth, func(node *service.Node) (bool, error) {
+		return fn(node), nil
+	})
+}
+
+// Delete a node together with its checks, statuses and allocations. The deletion is recorded at the
+// audit history as made by the API, unless the context has an actor.
+func (m *Manager) Delete(ctx context.Context, id int) error {
+	return m.write(ctx, id, func(tx *sql.Tx) (bool, error) {
+		node, err := m.Config.Repository.SelectOneTx(tx, strconv.Itoa(id))
+		if err != nil {
+			return false, fmt.Errorf("failed to fetch the node: %w", err)
+		}
+		if err := m.Config.Repository.Delete(tx, id); err != nil {
+			return false, fmt.Errorf("failed to delete the node: %w", err)
+		}
+		auditEvent := newAuditEvent(
+			ctx, service.NodeAuditEventTypeDeleted, service.NodeAuditActorKindAPI, id,
+			auditState(node), map[string]string{},
+		)
+		return true, m.record(tx, newOutboxEvent(service.NodeEventTypeDeleted, node, node), &auditEvent)
+	})
+}
+
+// Subscribe to the changes of the nodes. The function is called in the order of the changes and
+// should not block.
+func (m *Manager) Subscribe(fn func(service.NodeEvent)) (unsubscribe func()) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.sequence++
+	id := m.sequence
+	m.subscribers[id] = fn
+	return func() {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+		delete(m.subscribers, id)
+	}
+}
+
+// apply an outbox event. The node is reloaded, so an event delivered twice or late doesn't
+// overwrite a newer state. The outbox delivers the events one at a time.
+func (m *Manager) apply(ctx context.Context, event service.NodeOutboxEvent) error {
+	node, err := m.Config.Repository.SelectOne(ctx, strconv.Itoa(event.NodeID))
+	if err != nil && service.ErrorKindOf(err) != service.ErrorKindNotFound {
+		return fmt.Errorf("failed to fetch the node: %w", err)
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if err != nil {
+		m.remove(event.NodeID, uint64(event.ID))
+	} else {
+		m.set(node, uint64(event.ID))
+	}
+	m.revision = event.ID
+	return nil
+}
+
+// write run the function at a transaction while holding the lock of the node, no lock is taken if
+// the id is zero. The function returns if it changed something, in that case the outbox delivers
+// the changes after the commit.
+func (m *Manager) write(ctx context.Context, id int, fn func(tx *sql.Tx) (bool, error)) error {
+	changed, err := func() (_ bool, err error) {
+		if id > 0 {
+			lock := m.lock(id)
+			lock.Lock()
+			defer lock.Unlock()
+		}
+
+		tx, err := m.Config.Transaction.Begin(ctx, false, sql.LevelDefault)
+		if err != nil {
+			return false, fmt.Errorf("failed to create the transaction: %w", err)
+		}
+		defer func() { err = m.Config.TransactionHandler(tx, err) }()
+		return fn(tx)
+	}()
+	if err != nil {
+		return err
+	}
+	if changed {
+		m.Config.Outbox.Dispatch(ctx)
+	}
+	return nil
+}
+
+// record write the change of a node to the outbox and to the audit history, the audit event is
+// optional.
+func (m *Manager) record(
+	tx *sql.Tx, event service.NodeOutboxEvent, auditEvent *service.NodeAuditEvent,
+) error {
+	if err := m.Config.OutboxRepository.Insert(tx, event); err != nil {
+		return fmt.Errorf("failed to write the outbox event: %w", err)
+	}
+	if auditEvent == nil {
+		return nil
+	}
+	if err := m.Config.AuditRepository.Insert(tx, *auditEvent); err != nil {
+		return fmt.Errorf("failed to record the node event: %w", err)
+	}
+	return nil
+}
+
+// lookup the id of the node with the given address.
+func (m *Manager) lookup(address string) (int, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	for id, node := range m.nodes {
+		if node.Address == address {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+func (m *Manager) lock(id int) *sync.Mutex {
+	return &m.locks[id%managerLocks]
+}
+
+func (m *Manager) process() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(m.Config.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := m.sync(m.ctx); err != nil {
+			m.Config.Logger.Error().Err(err).Msg("failed to sync the nodes")
+		}
+	}
+}
+
+// sync reload all the nodes and publish the differences. The nodes are loaded without holding the
+// lock and merged afterwards. The merge only happens if nothing was written during the load and the
+// outbox already delivered every change, otherwise the differences are changes still on their way
+// and the sync is retried later.
+func (m *Manager) sync(ctx context.Context) error {
+	position, err := m.Config.Outbox.Position(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch the outbox position: %w", err)
+	}
+	nodes, err := m.Config.Repository.Select(ctx, service.NodeQuery{State: service.NodeQueryStateAll})
+	if err != nil {
+		return fmt.Errorf("failed to fetch the nodes: %w", err)
+	}
+	current, err := m.Config.Outbox.Position(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch the outbox position: %w", err)
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if position != current || position != m.revision {
+		return nil
+	}
+
+	found := make(map[int]bool, len(nodes))
+	for _, node := range nodes {
+		found[node.ID] = true
+		m.set(node, 0)
+	}
+	for id := range m.nodes {
+		if !found[id] {
+			m.remove(id, 0)
+		}
+	}
+	return nil
+}
+
+// set store the node and publish the change. Nothing is published if the node didn't change.
+func (m *Manager) set(node service.Node, revision uint64) {
+	previous, ok := m.nodes[node.ID]
+	if ok && sameNode(previous, node) {
+		return
+	}
+	m.nodes[node.ID] = node
+
+	event := service.NodeEvent{
+		Type:     service.NodeEventTypeUpdated,
+		Node:     node,
+		Previous: previous,
+		Revision: revision,
+	}
+	if !ok {
+		event.Type = service.NodeEventTypeCreated
+	}
+	m.publish(event)
+}
+
+func (m *Manager) remove(id int, revision uint64) {
+	node, ok := m.nodes[id]
+	if !ok {
+		return
+	}
+	delete(m.nodes, id)
+	m.publish(service.NodeEvent{
+		Type:     service.NodeEventTypeDeleted,
+		Node:     node,
+		Previous: node,
+		Revision: revision,
+	})
+}
+
+func (m *Manager) publish(event service.NodeEvent) {
+	for _, fn := range m.subscribers {
+		fn(event)
+	}
+}
+
+// sameNode compare two nodes ignoring the time representation, the nodes loaded from the database
+// don't have the monotonic clock nor the same location as the ones created in memory.
+func sameNode(a, b service.Node) bool {
+	for _, node := range []*service.Node{&a, &b} {
+		node.CreatedAt = node.CreatedAt.UTC()
+		node.LastSeen = node.LastSeen.UTC()
+		node.ExpiresAt = node.ExpiresAt.UTC()
+		node.ReactivatedAt = node.ReactivatedAt.UTC()
+		node.HealthChangedAt = node.HealthChangedAt.UTC()
+		node.RegisteredAt = node.RegisteredAt.UTC()
+	}
+	return reflect.DeepEqual(a, b)
+}
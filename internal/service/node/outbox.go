@@ -0,0 +1,212 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"malta/internal/service"
+)
+
+const (
+	defaultOutboxPollInterval = time.Second
+	defaultOutboxRetention    = time.Hour
+	outboxBatchSize           = 100
+	outboxCompactInterval     = time.Minute
+)
+
+// OutboxConfigRepository is used to read the events written by the node changes.
+type OutboxConfigRepository interface {
+	Position(ctx context.Context) (int, error)
+	Select(ctx context.Context, after int, limit int) ([]service.NodeOutboxEvent, error)
+	Compact(ctx context.Context, before time.Time) error
+}
+
+// OutboxConfig used to setup the outbox internal state.
+type OutboxConfig struct {
+	Repository OutboxConfigRepository
+
+	// PollInterval used to look for the events written by the other servers sharing the database and
+	// the ones that failed to be delivered.
+	PollInterval time.Duration
+
+	// Retention is how long the events are kept at the database. The events are kept past it until
+	// every persisted subscriber, like the webhooks, has seen them.
+	Retention time.Duration
+
+	Logger zerolog.Logger
+}
+
+// Outbox delivers the changes of the nodes to the subscribers. The changes are written to the
+// database in the same transaction as the node, so they survive a crash between the commit and the
+// delivery. Each subscriber has its own position, which only moves after the subscriber accepted the
+// event, so the events are delivered at least once and in order.
+type Outbox struct {
+	Config OutboxConfig
+
+	mutex       sync.Mutex
+	subscribers map[int]*outboxSubscriber
+	sequence    int
+
+	ctx       context.Context
+	ctxCancel func()
+	wg        sync.WaitGroup
+}
+
+type outboxSubscriber struct {
+	position int
+	fn       func(context.Context, service.NodeOutboxEvent) error
+}
+
+// Init internal state.
+func (o *Outbox) Init() error {
+	if o.Config.Repository == nil {
+		return fmt.Errorf("missing repository")
+	}
+	if o.Config.PollInterval == 0 {
+		o.Config.PollInterval = defaultOutboxPollInterval
+	}
+	if o.Config.Retention == 0 {
+		o.Config.Retention = defaultOutboxRetention
+	}
+	o.subscribers = make(map[int]*outboxSubscriber)
+	return nil
+}
+
+// Start the process.
+func (o *Outbox) Start() error {
+	o.ctx, o.ctxCancel = context.WithCancel(context.Background())
+	o.wg.Add(1)
+	go o.process()
+	return nil
+}
+
+// Stop the process.
+func (o *Outbox) Stop() {
+	if o.ctxCancel == nil {
+		return
+	}
+	o.ctxCancel()
+	o.wg.Wait()
+}
+
+// Position return the position of the last event written. A subscriber that loaded the state of
+// the nodes should get the position before the load and subscribe from it.
+func (o *Outbox) Position(ctx context.Context) (int, error) {
+	return o.Config.Repository.Position(ctx)
+}
+
+// Subscribe to the events after the given position. The function should be idempotent, if it fails
+// the event is delivered again later.
+func (o *Outbox) Subscribe(
+	position int, fn func(context.Context, service.NodeOutboxEvent) error,
+) (unsubscribe func()) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.sequence++
+	id := o.sequence
+	o.subscribers[id] = &outboxSubscriber{position: position, fn: fn}
+	return func() {
+		o.mutex.Lock()
+		defer o.mutex.Unlock()
+		delete(o.subscribers, id)
+	}
+}
+
+// Dispatch deliver the pending events right away. It's called after a node change is committed,
+// the events that fail are retried at the next poll.
+func (o *Outbox) Dispatch(ctx context.Context) {
+	if err := o.dispatch(ctx); err != nil {
+		o.Config.Logger.Error().Err(err).Msg("failed to dispatch the outbox events")
+	}
+}
+
+func (o *Outbox) process() {
+	defer o.wg.Done()
+
+	ticker := time.NewTicker(o.Config.PollInterval)
+	defer ticker.Stop()
+
+	compactTicker := time.NewTicker(outboxCompactInterval)
+	defer compactTicker.Stop()
+
+	for {
+		select {
+		case <-o.ctx.Done():
+			return
+		case <-ticker.C:
+			o.Dispatch(o.ctx)
+		case <-compactTicker.C:
+			before := time.Now().Add(-o.Config.Retention)
+			if err := o.Config.Repository.Compact(o.ctx, before); err != nil {
+				o.Config.Logger.Error().Err(err).Msg("failed to compact the outbox")
+			}
+		}
+	}
+}
+
+func (o *Outbox) dispatch(ctx context.Context) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	for len(o.subscribers) > 0 {
+		position := -1
+		for _, subscriber := range o.subscribers {
+			if position == -1 || subscriber.position < position {
+				position = subscriber.position
+			}
+		}
+
+		events, err := o.Config.Repository.Select(ctx, position, outboxBatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to fetch the outbox events: %w", err)
+		}
+		// A failing subscriber doesn't hold the others back, it catches up at the next dispatch.
+		var deliverErr error
+		for _, subscriber := range o.subscribers {
+			if err := subscriber.deliver(ctx, events); err != nil && deliverErr == nil {
+				deliverErr = err
+			}
+		}
+		if deliverErr != nil {
+			return deliverErr
+		}
+		if len(events) < outboxBatchSize {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (s *outboxSubscriber) deliver(ctx context.Context, events []service.NodeOutboxEvent) error {
+	for _, event := range events {
+		if event.ID <= s.position {
+			continue
+		}
+		if err := s.fn(ctx, event); err != nil {
+			return fmt.Errorf("failed to deliver the outbox event '%d': %w", event.ID, err)
+		}
+		s.position = event.ID
+	}
+	return nil
+}
+
+// newOutboxEvent build the event of a change from the state of the node before and after it. The
+// state before a creation is empty and a deleted node keeps its last state.
+func newOutboxEvent(
+	eventType service.NodeEventType, previous, node service.Node,
+) service.NodeOutboxEvent {
+	watchType, _ := watchEventType(eventType, previous, node)
+	node.Check = service.NodeCheck{}
+	return service.NodeOutboxEvent{
+		NodeID:    node.ID,
+		Type:      eventType,
+		WatchType: watchType,
+		Node:      node,
+		CreatedAt: time.Now(),
+	}
+}
@@ -0,0 +1,118 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"malta/internal/service"
+)
+
+// ReaperConfigRepository is used to find the nodes with an expired lease.
+type ReaperConfigRepository interface {
+	SelectExpired(ctx context.Context, now time.Time) ([]service.Node, error)
+}
+
+// ReaperConfigManager is used to deactivate the nodes.
+type ReaperConfigManager interface {
+	Update(
+		ctx context.Context,
+		id int,
+		kind service.NodeAuditActorKind,
+		fn func(node *service.Node) (bool, error),
+	) (service.Node, error)
+}
+
+// ReaperConfig used to setup the reaper internal state.
+type ReaperConfig struct {
+	// Interval used to look for expired nodes. The reaper is disabled if the interval is zero.
+	Interval time.Duration
+
+	Repository ReaperConfigRepository
+	Manager    ReaperConfigManager
+	Logger     zerolog.Logger
+}
+
+// Reaper is used to deactivate the nodes that didn't renew their lease.
+type Reaper struct {
+	Config ReaperConfig
+
+	ctx       context.Context
+	ctxCancel func()
+	wg        sync.WaitGroup
+}
+
+// Start the process.
+func (r *Reaper) Start() error {
+	if r.Config.Interval == 0 {
+		return nil
+	}
+
+	r.ctx, r.ctxCancel = context.WithCancel(context.Background())
+	r.wg.Add(1)
+	go r.process()
+	return nil
+}
+
+// Stop the process.
+func (r *Reaper) Stop() {
+	if r.ctxCancel == nil {
+		return
+	}
+	r.ctxCancel()
+	r.wg.Wait()
+}
+
+func (r *Reaper) process() {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(r.Config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := r.reap(r.ctx); err != nil {
+			r.Config.Logger.Error().Err(err).Msg("failed to deactivate the expired nodes")
+		}
+	}
+}
+
+// reap deactivate the nodes with an expired lease. The lease is checked again by the manager, a
+// node that renewed it after being found stays active.
+func (r *Reaper) reap(ctx context.Context) error {
+	now := time.Now().UTC()
+	expired, err := r.Config.Repository.SelectExpired(ctx, now)
+	if err != nil {
+		return fmt.Errorf("failed to fetch the expired nodes: %w", err)
+	}
+
+	for _, node := range expired {
+		var deactivated bool
+		_, err := r.Config.Manager.Update(
+			ctx, node.ID, service.NodeAuditActorKindReaper, func(node *service.Node) (bool, error) {
+				if !node.Active || node.ExpiresAt.IsZero() || !node.ExpiresAt.Before(now) {
+					return false, nil
+				}
+				node.Active = false
+				deactivated = true
+				return true, nil
+			},
+		)
+		switch {
+		case service.ErrorKindOf(err) == service.ErrorKindNotFound:
+		case err != nil:
+			return fmt.Errorf("failed to deactivate the node '%d': %w", node.ID, err)
+		case deactivated:
+			r.Config.Logger.Info().Int("nodeID", node.ID).Msg("node lease expired, deactivating it")
+		}
+	}
+	return nil
+}
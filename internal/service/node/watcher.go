@@ -0,0 +1,226 @@
+package node
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"malta/internal/service"
+)
+
+const (
+	defaultWatcherBufferSize  = 1000
+	defaultWatcherChannelSize = 256
+)
+
+// WatcherConfigManager is the source of the nodes and their changes.
+type WatcherConfigManager interface {
+	Snapshot() ([]service.Node, uint64)
+	Subscribe(fn func(service.NodeEvent)) (unsubscribe func())
+}
+
+// WatcherConfig used to setup the watcher internal state.
+type WatcherConfig struct {
+	Manager WatcherConfigManager
+
+	// Quantity of recent events kept to resume the watches, the default is 1000.
+	BufferSize int
+}
+
+// Watcher assign revisions to the node changes and deliver them to the watches. Only the membership
+// and health changes are delivered, the lease renewals are not.
+//
+// The revisions are the ids of the outbox events of the changes, so they keep increasing across
+// restarts and a watch can be resumed at any server sharing the database. A watch from a revision
+// that is no longer at the buffer receives a snapshot instead.
+type Watcher struct {
+	Config WatcherConfig
+
+	mutex       sync.Mutex
+	unsubscribe func()
+	stopped     bool
+	revision    uint64
+	oldest      uint64
+	nodes       map[int]service.Node
+	buffer      []service.NodeWatchEvent
+	watches     map[int]chan service.NodeWatchEvent
+	sequence    int
+}
+
+// Init internal state.
+func (w *Watcher) Init() error {
+	if w.Config.Manager == nil {
+		return fmt.Errorf("missing manager")
+	}
+	w.nodes = make(map[int]service.Node)
+	w.watches = make(map[int]chan service.NodeWatchEvent)
+	return nil
+}
+
+// Start follow the changes of the nodes.
+func (w *Watcher) Start() error {
+	// The subscription happens before the listing to not miss any change, the listing only adds the
+	// nodes not seen yet. The watches can only be resumed from the revision of the listing.
+	w.unsubscribe = w.Config.Manager.Subscribe(w.process)
+	nodes, revision := w.Config.Manager.Snapshot()
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for _, node := range nodes {
+		if _, ok := w.nodes[node.ID]; !ok {
+			w.nodes[node.ID] = node
+		}
+	}
+	if revision > w.revision {
+		w.revision = revision
+	}
+	w.oldest = w.revision
+	w.buffer = nil
+	return nil
+}
+
+// Stop following the changes and close the watches.
+func (w *Watcher) Stop() {
+	if w.unsubscribe == nil {
+		return
+	}
+	w.unsubscribe()
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.stopped = true
+	for id, events := range w.watches {
+		delete(w.watches, id)
+		close(events)
+	}
+}
+
+// Watch the changes after the given revision. The revision zero always starts from a snapshot.
+func (w *Watcher) Watch(after uint64) service.NodeWatch {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	watch := service.NodeWatch{Revision: w.revision}
+	if backlog, ok := w.backlog(after); ok {
+		watch.Resumed = true
+		watch.Backlog = backlog
+	} else {
+		watch.Snapshot = make([]service.Node, 0, len(w.nodes))
+		for _, node := range w.nodes {
+			watch.Snapshot = append(watch.Snapshot, node)
+		}
+		sort.Slice(watch.Snapshot, func(i, j int) bool {
+			return watch.Snapshot[i].ID < watch.Snapshot[j].ID
+		})
+	}
+
+	events := make(chan service.NodeWatchEvent, defaultWatcherChannelSize)
+	watch.Events = events
+	if w.stopped {
+		close(events)
+		watch.Close = func() {}
+		return watch
+	}
+
+	w.sequence++
+	id := w.sequence
+	w.watches[id] = events
+	watch.Close = func() {
+		w.mutex.Lock()
+		defer w.mutex.Unlock()
+		if _, ok := w.watches[id]; ok {
+			delete(w.watches, id)
+			close(events)
+		}
+	}
+	return watch
+}
+
+// backlog return the buffered events after the given revision, it's false if any of the events
+// since then is no longer at the buffer. The buffer has all the events after the oldest revision,
+// the revisions have gaps, so any revision in between is accepted.
+func (w *Watcher) backlog(after uint64) ([]service.NodeWatchEvent, bool) {
+	if after == 0 || after < w.oldest || after > w.revision {
+		return nil, false
+	}
+	index := sort.Search(len(w.buffer), func(i int) bool {
+		return w.buffer[i].Revision > after
+	})
+	backlog := make([]service.NodeWatchEvent, len(w.buffer)-index)
+	copy(backlog, w.buffer[index:])
+	return backlog, true
+}
+
+// process is called by the manager and should not block, the watches that can't keep up are closed.
+func (w *Watcher) process(event service.NodeEvent) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	previous := w.nodes[event.Node.ID]
+	if event.Type == service.NodeEventTypeDeleted {
+		delete(w.nodes, event.Node.ID)
+	} else {
+		w.nodes[event.Node.ID] = event.Node
+	}
+	eventType, ok := watchEventType(event.Type, previous, event.Node)
+	if !ok {
+		return
+	}
+
+	watchEvent := service.NodeWatchEvent{Revision: event.Revision, Type: eventType, Node: event.Node}
+	if event.Revision > w.revision {
+		w.revision = event.Revision
+		w.buffer = append(w.buffer, watchEvent)
+		if size := w.bufferSize(); len(w.buffer) > size {
+			w.oldest = w.buffer[len(w.buffer)-size-1].Revision
+			w.buffer = append(w.buffer[:0], w.buffer[len(w.buffer)-size:]...)
+		}
+	} else {
+		// The change was found by reloading the nodes and it doesn't have a revision of its own, the
+		// watches can't be resumed from before it anymore.
+		watchEvent.Revision = w.revision
+		w.oldest = w.revision + 1
+		w.buffer = nil
+	}
+
+	for id, events := range w.watches {
+		select {
+		case events <- watchEvent:
+		default:
+			delete(w.watches, id)
+			close(events)
+		}
+	}
+}
+
+func (w *Watcher) bufferSize() int {
+	if w.Config.BufferSize > 0 {
+		return w.Config.BufferSize
+	}
+	return defaultWatcherBufferSize
+}
+
+// watchEventType return the change seen by the watchers, it's false if only the lease was renewed.
+func watchEventType(
+	eventType service.NodeEventType, previous, node service.Node,
+) (service.NodeWatchEventType, bool) {
+	switch {
+	case eventType == service.NodeEventTypeCreated:
+		return service.NodeWatchEventTypeCreated, true
+	case eventType == service.NodeEventTypeDeleted:
+		return service.NodeWatchEventTypeDeleted, true
+	case onlyLeaseChanged(previous, node):
+		return "", false
+	case previous.Active && !node.Active:
+		return service.NodeWatchEventTypeDeactivated, true
+	default:
+		return service.NodeWatchEventTypeUpdated, true
+	}
+}
+
+// onlyLeaseChanged check if the only difference between the nodes is the lease renewal.
+func onlyLeaseChanged(previous, node service.Node) bool {
+	previous.LastSeen = node.LastSeen
+	previous.ExpiresAt = node.ExpiresAt
+	return sameNode(previous, node)
+}
@@ -0,0 +1,210 @@
+package node
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"malta/internal/service"
+)
+
+func TestWatcherResume(t *testing.T) {
+	// The buffer keeps the last three events, the oldest revision is the last one evicted.
+	w := newTestWatcher(t, 3, 10, service.Node{ID: 1, Active: true})
+	w.publish(12, service.NodeEventTypeCreated, service.Node{ID: 2, Active: true})
+	w.publish(15, service.NodeEventTypeUpdated, service.Node{ID: 1, Active: false})
+	w.publish(17, service.NodeEventTypeDeleted, service.Node{ID: 2, Active: true})
+	w.publish(20, service.NodeEventTypeCreated, service.Node{ID: 3, Active: true})
+
+	tests := []struct {
+		name      string
+		after     uint64
+		resumed   bool
+		revisions []uint64
+	}{
+		{name: "without revision", after: 0},
+		{name: "before the oldest", after: 11},
+		{name: "at the oldest", after: 12, resumed: true, revisions: []uint64{15, 17, 20}},
+		{name: "inside the buffer", after: 15, resumed: true, revisions: []uint64{17, 20}},
+		{name: "at a gap", after: 16, resumed: true, revisions: []uint64{17, 20}},
+		{name: "at the current", after: 20, resumed: true, revisions: []uint64{}},
+		{name: "after the current", after: 21},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			watch := w.Watch(tt.after)
+			defer watch.Close()
+			if watch.Revision != 20 {
+				t.Errorf("expected the revision 20, got %d", watch.Revision)
+			}
+			if watch.Resumed != tt.resumed {
+				t.Fatalf("expected resumed '%t', got '%t'", tt.resumed, watch.Resumed)
+			}
+			if !tt.resumed {
+				if ids := nodeIDs(watch.Snapshot); !reflect.DeepEqual(ids, []int{1, 3}) {
+					t.Errorf("expected the snapshot of the nodes [1 3], got %v", ids)
+				}
+				return
+			}
+			revisions := eventRevisions(watch.Backlog)
+			if !reflect.DeepEqual(revisions, tt.revisions) {
+				t.Errorf("expected the revisions %v, got %v", tt.revisions, revisions)
+			}
+		})
+	}
+}
+
+func TestWatcherEvents(t *testing.T) {
+	node := service.Node{ID: 1, Address: "a", Active: true}
+	w := newTestWatcher(t, 10, 1, node)
+	watch := w.Watch(1)
+	defer watch.Close()
+
+	// The lease renewals are not delivered, the following change is.
+	renewed := node
+	renewed.LastSeen = time.Now()
+	renewed.ExpiresAt = renewed.LastSeen.Add(time.Minute)
+	w.publish(2, service.NodeEventTypeUpdated, renewed)
+	deactivated := renewed
+	deactivated.Active = false
+	w.publish(3, service.NodeEventTypeUpdated, deactivated)
+
+	event := receive(t, watch)
+	if event.Revision != 3 || event.Type != service.NodeWatchEventTypeDeactivated {
+		t.Fatalf("expected the deactivation at the revision 3, got '%+v'", event)
+	}
+	revisions := eventRevisions(w.Watch(1).Backlog)
+	if !reflect.DeepEqual(revisions, []uint64{3}) {
+		t.Errorf("expected only the revision 3 at the backlog, got %v", revisions)
+	}
+}
+
+func TestWatcherReload(t *testing.T) {
+	w := newTestWatcher(t, 10, 1, service.Node{ID: 1, Active: true})
+	w.publish(2, service.NodeEventTypeCreated, service.Node{ID: 2, Active: true})
+	watch := w.Watch(2)
+	defer watch.Close()
+
+	// A change found by reloading the nodes has no revision, it's delivered at the current one and
+	// the watches can't be resumed from before it.
+	w.publish(0, service.NodeEventTypeUpdated, service.Node{ID: 2, Active: false})
+	if event := receive(t, watch); event.Revision != 2 {
+		t.Fatalf("expected the current revision, got %d", event.Revision)
+	}
+	for _, after := range []uint64{1, 2} {
+		if resumed := w.Watch(after); resumed.Resumed {
+			t.Errorf("expected a snapshot resuming from %d", after)
+		}
+	}
+
+	// The next change with a revision starts the buffer again, after the reloaded change.
+	w.publish(5, service.NodeEventTypeDeleted, service.Node{ID: 2})
+	receive(t, watch)
+	if resumed := w.Watch(2); resumed.Resumed {
+		t.Error("expected a snapshot resuming from the reloaded change")
+	}
+	resumed := w.Watch(3)
+	if !resumed.Resumed || !reflect.DeepEqual(eventRevisions(resumed.Backlog), []uint64{5}) {
+		t.Errorf("expected to resume with the revision 5, got %v", eventRevisions(resumed.Backlog))
+	}
+}
+
+func TestWatcherSlowWatch(t *testing.T) {
+	w := newTestWatcher(t, 10, 1)
+	slow := w.Watch(0)
+	fast := w.Watch(0)
+	defer fast.Close()
+
+	// The slow watch isn't read and it's closed once its channel is full, the other watches and the
+	// manager aren't blocked by it.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range fast.Events {
+		}
+	}()
+	for i := 0; i <= defaultWatcherChannelSize; i++ {
+		w.publish(uint64(i+2), service.NodeEventTypeCreated, service.Node{ID: i + 1, Active: true})
+	}
+
+	var received int
+	for range slow.Events {
+		received++
+	}
+	if received != defaultWatcherChannelSize {
+		t.Errorf("expected %d events before closing, got %d", defaultWatcherChannelSize, received)
+	}
+	slow.Close()
+
+	w.Stop()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the other watch wasn't closed by the stop")
+	}
+}
+
+// testWatcher is a watcher fed by the test instead of the manager.
+type testWatcher struct {
+	*Watcher
+	nodes    []service.Node
+	revision uint64
+	fn       func(service.NodeEvent)
+}
+
+func newTestWatcher(t *testing.T, size int, revision uint64, nodes ...service.Node) *testWatcher {
+	t.Helper()
+	w := &testWatcher{nodes: nodes, revision: revision}
+	w.Watcher = &Watcher{Config: WatcherConfig{Manager: w, BufferSize: size}}
+	if err := w.Init(); err != nil {
+		t.Fatalf("failed to initialize: %s", err)
+	}
+	if err := w.Start(); err != nil {
+		t.Fatalf("failed to start: %s", err)
+	}
+	return w
+}
+
+func (w *testWatcher) Snapshot() ([]service.Node, uint64) {
+	return w.nodes, w.revision
+}
+
+func (w *testWatcher) Subscribe(fn func(service.NodeEvent)) func() {
+	w.fn = fn
+	return func() {}
+}
+
+func (w *testWatcher) publish(revision uint64, eventType service.NodeEventType, node service.Node) {
+	w.fn(service.NodeEvent{Type: eventType, Node: node, Revision: revision})
+}
+
+func receive(t *testing.T, watch service.NodeWatch) service.NodeWatchEvent {
+	t.Helper()
+	select {
+	case event, ok := <-watch.Events:
+		if !ok {
+			t.Fatal("watch closed")
+		}
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for an event")
+		return service.NodeWatchEvent{}
+	}
+}
+
+func nodeIDs(nodes []service.Node) []int {
+	ids := make([]int, 0, len(nodes))
+	for _, node := range nodes {
+		ids = append(ids, node.ID)
+	}
+	return ids
+}
+
+func eventRevisions(events []service.NodeWatchEvent) []uint64 {
+	revisions := make([]uint64, 0, len(events))
+	for _, event := range events {
+		revisions = append(revisions, event.Revision)
+	}
+	return revisions
+}
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// NodeSort is the field used to order the nodes.
+type NodeSort string
+
+// Fields the nodes can be ordered by.
+const (
+	NodeSortID        NodeSort = "id"
+	NodeSortCreatedAt NodeSort = "created_at"
+	NodeSortAddress   NodeSort = "address"
+)
+
+// Valid check if the sort is known.
+func (s NodeSort) Valid() bool {
+	switch s {
+	case NodeSortID, NodeSortCreatedAt, NodeSortAddress:
+		return true
+	default:
+		return false
+	}
+}
+
+// Cursor return the position of the node at the listing.
+func (s NodeSort) Cursor(node Node) NodeCursor {
+	cursor := NodeCursor{Sort: s, ID: node.ID}
+	switch s {
+	case NodeSortID:
+		cursor.Value = strconv.Itoa(node.ID)
+	case NodeSortCreatedAt:
+		cursor.Value = node.CreatedAt.Format(time.RFC3339Nano)
+	case NodeSortAddress:
+		cursor.Value = node.Address
+	}
+	return cursor
+}
+
+// NodeQueryState is used to filter the nodes by their state.
+type NodeQueryState string
+
+// States the nodes can be filtered by.
+const (
+	NodeQueryStateActive   NodeQueryState = "active"
+	NodeQueryStateInactive NodeQueryState = "inactive"
+	NodeQueryStateAll      NodeQueryState = "all"
+)
+
+// Valid check if the state is known.
+func (s NodeQueryState) Valid() bool {
+	switch s {
+	case NodeQueryStateActive, NodeQueryStateInactive, NodeQueryStateAll:
+		return true
+	default:
+		return false
+	}
+}
+
+// NodeCursor is the position of a node at a listing ordered by the sort field. The listing
+// continues after the node.
+type NodeCursor struct {
+	Sort  NodeSort
+	ID    int
+	Value string
+}
+
+type nodeCursorRecord struct {
+	Sort  string `json:"s"`
+	ID    int    `json:"i"`
+	Value string `json:"v"`
+}
+
+// Encode the cursor into an opaque value to be sent to the clients.
+func (c NodeCursor) Encode() (string, error) {
+	payload, err := json.Marshal(nodeCursorRecord{Sort: string(c.Sort), ID: c.ID, Value: c.Value})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal the cursor: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(payload), nil
+}
+
+// ParseNodeCursor decode a cursor encoded by NodeCursor.Encode. The cursor comes from the clients,
+// so it's rejected if it wasn't generated by a listing.
+func ParseNodeCursor(value string) (NodeCursor, error) {
+	cursor, err := parseNodeCursor(value)
+	if err != nil {
+		return NodeCursor{}, ValidationError{Fields: map[string]string{"cursor": err.Error()}}
+	}
+	return cursor, nil
+}
+
+func parseNodeCursor(value string) (NodeCursor, error) {
+	payload, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return NodeCursor{}, fmt.Errorf("invalid encoding")
+	}
+	var record nodeCursorRecord
+	if err := json.Unmarshal(payload, &record); err != nil {
+		return NodeCursor{}, fmt.Errorf("invalid payload")
+	}
+
+	cursor := NodeCursor{Sort: NodeSort(record.Sort), ID: record.ID, Value: record.Value}
+	if !cursor.Sort.Valid() {
+		return NodeCursor{}, fmt.Errorf("unknown sort '%s'", cursor.Sort)
+	}
+	if cursor.ID <= 0 {
+		return NodeCursor{}, fmt.Errorf("invalid id '%d'", cursor.ID)
+	}
+	switch cursor.Sort {
+	case NodeSortID:
+		if cursor.Value != strconv.Itoa(cursor.ID) {
+			return NodeCursor{}, fmt.Errorf("invalid value '%s'", cursor.Value)
+		}
+	case NodeSortCreatedAt:
+		if _, err := time.Parse(time.RFC3339Nano, cursor.Value); err != nil {
+			return NodeCursor{}, fmt.Errorf("invalid value '%s'", cursor.Value)
+		}
+	}
+	return cursor, nil
+}
+
+// NodeQuery is used to filter the nodes.
+type NodeQuery struct {
+	// Every requirement should match for the node to be selected.
+	Selector []NodeSelectorRequirement
+
+	// State of the nodes, the default is to return only the active ones.
+	State NodeQueryState
+
+	// Health states of the nodes, any state is selected if empty.
+	Health []NodeHealth
+
+	// Sort is the field used to order the nodes, the default is the creation date.
+	Sort NodeSort
+
+	// Limit the quantity of nodes, it's unbounded if zero.
+	Limit int
+
+	// After is used to continue a previous listing.
+	After *NodeCursor
+}
+
+// NodeCheckResultQuery is used to filter the check history of a node.
+type NodeCheckResultQuery struct {
+	NodeID int
+
+	// Period of the checks, both ends are inclusive.
+	From time.Time
+	To   time.Time
+
+	Limit int
+}
+
+// NodeAuditQuery is used to filter the audit history of the nodes. The events are returned from the
+// newest to the oldest.
+type NodeAuditQuery struct {
+	// NodeID of the events, the events of every node are selected if zero.
+	NodeID int
+
+	// Types of the events, any type is selected if empty.
+	Types []NodeAuditEventType
+
+	// ActorKind of the events, any actor is selected if empty.
+	ActorKind NodeAuditActorKind
+
+	// Period of the events, both ends are inclusive and unbounded if zero.
+	From time.Time
+	To   time.Time
+
+	Limit int
+
+	// Before is used to continue a previous listing, only the events with a lower id are selected.
+	Before int
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNodeCursor(t *testing.T) {
+	node := Node{
+		ID:        42,
+		Address:   "http://node:8080/a b",
+		CreatedAt: time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC),
+	}
+	for _, sort := range []NodeSort{NodeSortID, NodeSortCreatedAt, NodeSortAddress} {
+		sort := sort
+		t.Run(string(sort), func(t *testing.T) {
+			cursor := sort.Cursor(node)
+			value, err := cursor.Encode()
+			if err != nil {
+				t.Fatalf("failed to encode: %s", err)
+			}
+			parsed, err := ParseNodeCursor(value)
+			if err != nil {
+				t.Fatalf("failed to parse: %s", err)
+			}
+			if parsed != cursor {
+				t.Errorf("expected '%+v', got '%+v'", cursor, parsed)
+			}
+		})
+	}
+}
+
+func TestParseNodeCursor(t *testing.T) {
+	encode := func(payload string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(payload))
+	}
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{name: "not base64", value: "not a cursor!"},
+		{name: "padded base64", value: base64.URLEncoding.EncodeToString([]byte(`{"s":"id"}`))},
+		{name: "truncated", value: encode(`{"s":"id","i":1,"v":"1"}`)[:10]},
+		{name: "not json", value: encode("cursor")},
+		{name: "wrong types", value: encode(`{"s":"id","i":"1","v":"1"}`)},
+		{name: "empty", value: encode(`{}`)},
+		{name: "unknown sort", value: encode(`{"s":"name","i":1,"v":"a"}`)},
+		{name: "missing id", value: encode(`{"s":"address","v":"a"}`)},
+		{name: "negative id", value: encode(`{"s":"address","i":-1,"v":"a"}`)},
+		{name: "id mismatch", value: encode(`{"s":"id","i":1,"v":"2"}`)},
+		{name: "id not a number", value: encode(`{"s":"id","i":1,"v":"1 OR 1=1"}`)},
+		{name: "invalid time", value: encode(`{"s":"created_at","i":1,"v":"yesterday"}`)},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseNodeCursor(tt.value)
+			var verr ValidationError
+			if !errors.As(err, &verr) || verr.Fields["cursor"] == "" {
+				t.Fatalf("expected a cursor validation error, got '%v'", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NodeSelectorOperator is the comparison done against the node metadata.
+type NodeSelectorOperator string
+
+// Operators supported by the node selector.
+const (
+	NodeSelectorOperatorEquals    NodeSelectorOperator = "="
+	NodeSelectorOperatorNotEquals NodeSelectorOperator = "!="
+	NodeSelectorOperatorExists    NodeSelectorOperator = "exists"
+	NodeSelectorOperatorNotExists NodeSelectorOperator = "!exists"
+)
+
+// NodeSelectorRequirement is a single requirement a node metadata must match.
+type NodeSelectorRequirement struct {
+	Key      string
+	Operator NodeSelectorOperator
+	Value    string
+}
+
+// ParseNodeSelector parse a comma separated list of requirements like
+// 'zone=us-east,tier!=spot,gpu,!preemptible'.
+func ParseNodeSelector(raw string) ([]NodeSelectorRequirement, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+
+	values := strings.Split(raw, ",")
+	requirements := make([]NodeSelectorRequirement, 0, len(values))
+	for _, value := range values {
+		requirement, err := parseNodeSelectorRequirement(strings.TrimSpace(value))
+		if err != nil {
+			return nil, ValidationError{Fields: map[string]string{"selector": err.Error()}}
+		}
+		requirements = append(requirements, requirement)
+	}
+	return requirements, nil
+}
+
+func parseNodeSelectorRequirement(value string) (NodeSelectorRequirement, error) {
+	var requirement NodeSelectorRequirement
+	switch {
+	case strings.Contains(value, "!="):
+		fragments := strings.SplitN(value, "!=", 2)
+		requirement.Key, requirement.Value = fragments[0], fragments[1]
+		requirement.Operator = NodeSelectorOperatorNotEquals
+	case strings.Contains(value, "=="):
+		fragments := strings.SplitN(value, "==", 2)
+		requirement.Key, requirement.Value = fragments[0], fragments[1]
+		requirement.Operator = NodeSelectorOperatorEquals
+	case strings.Contains(value, "="):
+		fragments := strings.SplitN(value, "=", 2)
+		requirement.Key, requirement.Value = fragments[0], fragments[1]
+		requirement.Operator = NodeSelectorOperatorEquals
+	case strings.HasPrefix(value, "!"):
+		requirement.Key = strings.TrimPrefix(value, "!")
+		requirement.Operator = NodeSelectorOperatorNotExists
+	default:
+		requirement.Key = value
+		requirement.Operator = NodeSelectorOperatorExists
+	}
+
+	requirement.Key = strings.TrimSpace(requirement.Key)
+	requirement.Value = strings.TrimSpace(requirement.Value)
+	if requirement.Key == "" {
+		return NodeSelectorRequirement{}, fmt.Errorf("missing key at '%s'", value)
+	}
+	if strings.ContainsAny(requirement.Key, "\"!= ") {
+		return NodeSelectorRequirement{}, fmt.Errorf("invalid key '%s'", requirement.Key)
+	}
+	return requirement, nil
+}
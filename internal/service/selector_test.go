@@ -0,0 +1,100 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseNodeSelector(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		expected []NodeSelectorRequirement
+		err      bool
+	}{
+		{name: "empty", raw: ""},
+		{name: "blank", raw: "   "},
+		{
+			name:     "equals",
+			raw:      "zone=us-east",
+			expected: []NodeSelectorRequirement{{Key: "zone", Operator: "=", Value: "us-east"}},
+		},
+		{
+			name:     "double equals",
+			raw:      "zone==us-east",
+			expected: []NodeSelectorRequirement{{Key: "zone", Operator: "=", Value: "us-east"}},
+		},
+		{
+			name:     "not equals",
+			raw:      "tier!=spot",
+			expected: []NodeSelectorRequirement{{Key: "tier", Operator: "!=", Value: "spot"}},
+		},
+		{
+			name:     "exists",
+			raw:      "gpu",
+			expected: []NodeSelectorRequirement{{Key: "gpu", Operator: "exists"}},
+		},
+		{
+			name:     "not exists",
+			raw:      "!preemptible",
+			expected: []NodeSelectorRequirement{{Key: "preemptible", Operator: "!exists"}},
+		},
+		{
+			name:     "empty value",
+			raw:      "zone=",
+			expected: []NodeSelectorRequirement{{Key: "zone", Operator: "="}},
+		},
+		{
+			name: "value with the operators",
+			raw:  "url=a=b,query!=c!=d",
+			expected: []NodeSelectorRequirement{
+				{Key: "url", Operator: "=", Value: "a=b"},
+				{Key: "query", Operator: "!=", Value: "c!=d"},
+			},
+		},
+		{
+			name:     "quoted value",
+			raw:      `zone="us-east"`,
+			expected: []NodeSelectorRequirement{{Key: "zone", Operator: "=", Value: `"us-east"`}},
+		},
+		{
+			name: "multiple with spaces",
+			raw:  " zone = us-east , tier!=spot ,gpu, !preemptible ",
+			expected: []NodeSelectorRequirement{
+				{Key: "zone", Operator: "=", Value: "us-east"},
+				{Key: "tier", Operator: "!=", Value: "spot"},
+				{Key: "gpu", Operator: "exists"},
+				{Key: "preemptible", Operator: "!exists"},
+			},
+		},
+		{name: "missing key at equals", raw: "=us-east", err: true},
+		{name: "missing key at not equals", raw: "!=spot", err: true},
+		{name: "missing key at not exists", raw: "!", err: true},
+		{name: "empty requirement", raw: "zone=us-east,,gpu", err: true},
+		{name: "trailing comma", raw: "gpu,", err: true},
+		{name: "quoted key", raw: `"zone"=us-east`, err: true},
+		{name: "key with space", raw: "my zone=us-east", err: true},
+		{name: "double negation", raw: "!!gpu", err: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			requirements, err := ParseNodeSelector(tt.raw)
+			if tt.err {
+				var verr ValidationError
+				if !errors.As(err, &verr) || verr.Fields["selector"] == "" {
+					t.Fatalf("expected a selector validation error, got '%v'", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(requirements, tt.expected) {
+				t.Errorf("expected '%+v', got '%+v'", tt.expected, requirements)
+			}
+		})
+	}
+}
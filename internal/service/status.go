@@ -0,0 +1,42 @@
+package service
+
+import "time"
+
+// NodeStatusValue is the status reported by a node, for the node as a whole or for one of its
+// components.
+type NodeStatusValue string
+
+// Status values a node can report. A warning still counts as healthy.
+const (
+	NodeStatusPass NodeStatusValue = "pass"
+	NodeStatusWarn NodeStatusValue = "warn"
+	NodeStatusFail NodeStatusValue = "fail"
+)
+
+// Valid check if the status value is known.
+func (v NodeStatusValue) Valid() bool {
+	switch v {
+	case NodeStatusPass, NodeStatusWarn, NodeStatusFail:
+		return true
+	default:
+		return false
+	}
+}
+
+// NodeStatusComponent is the status of one of the components of a node, like a database connection.
+type NodeStatusComponent struct {
+	Status NodeStatusValue
+	Output string
+}
+
+// NodeStatus is the health a node reports about itself.
+type NodeStatus struct {
+	NodeID     int
+	Status     NodeStatusValue
+	Components map[string]NodeStatusComponent
+
+	// Gauges are free-form measures like the load or the free disk space.
+	Gauges map[string]float64
+
+	ReportedAt time.Time
+}
@@ -0,0 +1,64 @@
+package service
+
+import "time"
+
+// Webhook is a subscription to the node changes, each change is posted to the URL.
+type Webhook struct {
+	ID  int
+	URL string
+
+	// Events the webhook is interested at, all of them if empty.
+	Events []NodeWatchEventType
+
+	// Secret used to sign the payloads.
+	Secret string
+
+	CreatedAt time.Time
+}
+
+// Accept check if the webhook is interested at the event type.
+func (w Webhook) Accept(eventType NodeWatchEventType) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, value := range w.Events {
+		if value == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDeliveryStatus is the state of a delivery.
+type WebhookDeliveryStatus string
+
+// States of a delivery. A pending delivery is retried until it succeeds or the attempts are
+// exhausted.
+const (
+	WebhookDeliveryStatusPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliveryStatusSucceeded WebhookDeliveryStatus = "succeeded"
+	WebhookDeliveryStatusFailed    WebhookDeliveryStatus = "failed"
+)
+
+// WebhookDelivery is a node change to be posted to a webhook.
+type WebhookDelivery struct {
+	ID        int
+	WebhookID int
+	Event     NodeWatchEventType
+	NodeID    int
+
+	// Key identifies the change, the same change observed by several servers is delivered once.
+	Key     string
+	Payload []byte
+
+	Status        WebhookDeliveryStatus
+	Attempts      int
+	NextAttemptAt time.Time
+
+	// Outcome of the last attempt.
+	LastStatus int
+	LastError  string
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
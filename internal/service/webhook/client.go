@@ -0,0 +1,160 @@
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"malta/internal/database"
+	"malta/internal/service"
+)
+
+const (
+	defaultDeliveryPageSize = 100
+	maxDeliveryPageSize     = 1000
+	secretSize              = 32
+)
+
+// ClientRepository implements the webhook logic at the database layer.
+type ClientRepository interface {
+	Select(ctx context.Context) ([]service.Webhook, error)
+	SelectOne(ctx context.Context, id int) (service.Webhook, error)
+	Insert(ctx context.Context, webhook service.Webhook) (service.Webhook, error)
+	Delete(tx *sql.Tx, id int) error
+}
+
+// ClientDeliveryRepository is used to read the delivery log.
+type ClientDeliveryRepository interface {
+	Select(ctx context.Context, webhookID int, limit int) ([]service.WebhookDelivery, error)
+}
+
+// Client implements the webhook business logic.
+type Client struct {
+	Repository         ClientRepository
+	DeliveryRepository ClientDeliveryRepository
+	Transaction        database.Transaction
+	TransactionHandler func(*sql.Tx, error) error
+}
+
+// Index list the webhooks.
+func (c *Client) Index(ctx context.Context) ([]service.Webhook, error) {
+	webhooks, err := c.Repository.Select(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the webhooks: %w", err)
+	}
+	return webhooks, nil
+}
+
+// FindOne return a webhook.
+func (c *Client) FindOne(ctx context.Context, id string) (service.Webhook, error) {
+	webhookID, err := strconv.Atoi(id)
+	if err != nil {
+		return service.Webhook{}, service.NewError(
+			service.ErrorKindNotFound, "webhook '%s' not found", id,
+		)
+	}
+	webhook, err := c.Repository.SelectOne(ctx, webhookID)
+	if err != nil {
+		if service.ErrorKindOf(err) == service.ErrorKindNotFound {
+			return service.Webhook{}, service.NewError(
+				service.ErrorKindNotFound, "webhook '%s' not found", id,
+			)
+		}
+		return service.Webhook{}, fmt.Errorf("failed to fetch the webhook: %w", err)
+	}
+	return webhook, nil
+}
+
+// Create a webhook. A random secret is generated if none is given.
+func (c *Client) Create(ctx context.Context, webhook service.Webhook) (service.Webhook, error) {
+	if err := validateWebhook(webhook); err != nil {
+		return service.Webhook{}, err
+	}
+	if webhook.Secret == "" {
+		secret := make([]byte, secretSize)
+		if _, err := rand.Read(secret); err != nil {
+			return service.Webhook{}, fmt.Errorf("failed to generate the secret: %w", err)
+		}
+		webhook.Secret = hex.EncodeToString(secret)
+	}
+	webhook.CreatedAt = time.Now().UTC()
+
+	webhook, err := c.Repository.Insert(ctx, webhook)
+	if err != nil {
+		return service.Webhook{}, fmt.Errorf("failed to insert the webhook: %w", err)
+	}
+	return webhook, nil
+}
+
+// Delete a webhook and its deliveries.
+func (c *Client) Delete(ctx context.Context, id string) (err error) {
+	webhookID, err := strconv.Atoi(id)
+	if err != nil {
+		return service.NewError(service.ErrorKindNotFound, "webhook '%s' not found", id)
+	}
+
+	tx, err := c.Transaction.Begin(ctx, false, sql.LevelDefault)
+	if err != nil {
+		return fmt.Errorf("failed to create the transaction: %w", err)
+	}
+	defer func() { err = c.TransactionHandler(tx, err) }()
+
+	if err := c.Repository.Delete(tx, webhookID); err != nil {
+		if service.ErrorKindOf(err) == service.ErrorKindNotFound {
+			return service.NewError(service.ErrorKindNotFound, "webhook '%s' not found", id)
+		}
+		return fmt.Errorf("failed to delete the webhook: %w", err)
+	}
+	return nil
+}
+
+// Deliveries list the deliveries of a webhook from the newest to the oldest.
+func (c *Client) Deliveries(
+	ctx context.Context, id string, limit int,
+) ([]service.WebhookDelivery, error) {
+	switch {
+	case limit == 0:
+		limit = defaultDeliveryPageSize
+	case limit < 0 || limit > maxDeliveryPageSize:
+		return nil, service.ValidationError{
+			Fields: map[string]string{
+				"limit": fmt.Sprintf("should be between 1 and %d", maxDeliveryPageSize),
+			},
+		}
+	}
+
+	webhook, err := c.FindOne(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	deliveries, err := c.DeliveryRepository.Select(ctx, webhook.ID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+func validateWebhook(webhook service.Webhook) error {
+	fields := make(map[string]string)
+	u, err := url.Parse(webhook.URL)
+	switch {
+	case webhook.URL == "":
+		fields["url"] = "can't be empty"
+	case err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https"):
+		fields["url"] = "should be an absolute http or https URL"
+	}
+	for _, event := range webhook.Events {
+		if !event.Valid() {
+			fields["events"] = fmt.Sprintf("unknown event '%s'", event)
+		}
+	}
+	if len(fields) > 0 {
+		return service.ValidationError{Fields: fields}
+	}
+	return nil
+}
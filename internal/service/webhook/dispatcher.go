@@ -0,0 +1,447 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"malta/internal/service"
+)
+
+const (
+	defaultTimeout      = 10 * time.Second
+	defaultPollInterval = time.Second
+	defaultMaxAttempts  = 10
+	defaultBackoff      = time.Second
+	defaultMaxBackoff   = time.Hour
+	defaultConcurrency  = 4
+	defaultLogSize      = 1000
+)
+
+// DispatcherConfigOutbox is the source of the node changes.
+type DispatcherConfigOutbox interface {
+	Subscribe(position int, fn func(context.Context, service.NodeOutboxEvent) error) func()
+}
+
+// DispatcherConfigRepository is used to fetch the webhooks.
+type DispatcherConfigRepository interface {
+	Select(ctx context.Context) ([]service.Webhook, error)
+	SelectOne(ctx context.Context, id int) (service.Webhook, error)
+}
+
+// DispatcherConfigDeliveryRepository is used to queue and attempt the deliveries. The position is
+// the last outbox event queued, it's shared by the servers.
+type DispatcherConfigDeliveryRepository interface {
+	Position(ctx context.Context) (int, error)
+	Advance(ctx context.Context, position int) error
+	Insert(ctx context.Context, delivery service.WebhookDelivery) (bool, error)
+	SelectDue(ctx context.Context, now time.Time, limit int) ([]service.WebhookDelivery, error)
+	Claim(ctx context.Context, id int, now, until time.Time) (bool, error)
+	Update(ctx context.Context, delivery service.WebhookDelivery) error
+	Compact(ctx context.Context, webhookID int, size int) error
+}
+
+// DispatcherConfig used to setup the dispatcher internal state.
+type DispatcherConfig struct {
+	Outbox             DispatcherConfigOutbox
+	Repository         DispatcherConfigRepository
+	DeliveryRepository DispatcherConfigDeliveryRepository
+	HTTPClient         *http.Client
+	Logger             zerolog.Logger
+
+	// Timeout of each attempt.
+	Timeout time.Duration
+
+	// PollInterval is how often the due deliveries are looked up. The deliveries queued by this
+	// server are attempted right away.
+	PollInterval time.Duration
+
+	// MaxAttempts before a delivery is marked as failed.
+	MaxAttempts int
+
+	// Backoff is the wait after the first failed attempt, it doubles at each attempt up to
+	// MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// Concurrency is the number of deliveries attempted at the same time.
+	Concurrency int
+
+	// LogSize is the number of finished deliveries kept per webhook.
+	LogSize int
+}
+
+// Dispatcher turns the node changes into webhook deliveries and posts them. The changes are read
+// from the outbox after the persisted position, so the changes made while no server was running are
+// queued at the next start.
+type Dispatcher struct {
+	Config DispatcherConfig
+
+	position    int
+	unsubscribe func()
+	notify      chan struct{}
+	ctx         context.Context
+	ctxCancel   func()
+	wg          sync.WaitGroup
+}
+
+// Init the dispatcher internal state.
+func (d *Dispatcher) Init() error {
+	if d.Config.Outbox == nil {
+		return fmt.Errorf("missing outbox")
+	}
+	if d.Config.Repository == nil {
+		return fmt.Errorf("missing repository")
+	}
+	if d.Config.DeliveryRepository == nil {
+		return fmt.Errorf("missing delivery repository")
+	}
+	if d.Config.Timeout == 0 {
+		d.Config.Timeout = defaultTimeout
+	}
+	if d.Config.PollInterval == 0 {
+		d.Config.PollInterval = defaultPollInterval
+	}
+	if d.Config.MaxAttempts == 0 {
+		d.Config.MaxAttempts = defaultMaxAttempts
+	}
+	if d.Config.Backoff == 0 {
+		d.Config.Backoff = defaultBackoff
+	}
+	if d.Config.MaxBackoff == 0 {
+		d.Config.MaxBackoff = defaultMaxBackoff
+	}
+	if d.Config.Concurrency == 0 {
+		d.Config.Concurrency = defaultConcurrency
+	}
+	if d.Config.LogSize == 0 {
+		d.Config.LogSize = defaultLogSize
+	}
+	if d.Config.HTTPClient == nil {
+		d.Config.HTTPClient = &http.Client{Timeout: d.Config.Timeout}
+	}
+	d.notify = make(chan struct{}, 1)
+	return nil
+}
+
+// Start the process.
+func (d *Dispatcher) Start() error {
+	position, err := d.Config.DeliveryRepository.Position(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to fetch the webhook position: %w", err)
+	}
+	d.position = position
+	d.unsubscribe = d.Config.Outbox.Subscribe(position, d.enqueue)
+
+	d.ctx, d.ctxCancel = context.WithCancel(context.Background())
+	d.wg.Add(1)
+	go d.deliver()
+	return nil
+}
+
+// Stop the process.
+func (d *Dispatcher) Stop() {
+	if d.unsubscribe != nil {
+		d.unsubscribe()
+	}
+	if d.ctxCancel == nil {
+		return
+	}
+	d.ctxCancel()
+	d.wg.Wait()
+}
+
+// enqueue queue a delivery of the node change for each interested webhook and then advance the
+// position. It's called by the outbox one event at a time and the event is delivered again if it
+// fails, the same change is only queued once per webhook.
+func (d *Dispatcher) enqueue(ctx context.Context, event service.NodeOutboxEvent) error {
+	if event.ID > d.position+1 {
+		d.Config.Logger.Warn().Int("position", d.position).Int("outboxEventID", event.ID).Msg(
+			"node changes were discarded by the outbox, some webhook deliveries were skipped",
+		)
+	}
+	// The lease renewals are not delivered.
+	if event.WatchType == "" {
+		d.position = event.ID
+		return nil
+	}
+
+	webhooks, err := d.Config.Repository.Select(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch the webhooks: %w", err)
+	}
+
+	var queued bool
+	for _, webhook := range webhooks {
+		if !webhook.Accept(event.WatchType) {
+			continue
+		}
+
+		delivery, err := newDelivery(webhook.ID, event)
+		if err != nil {
+			return fmt.Errorf("failed to create the webhook delivery: %w", err)
+		}
+		if _, err := d.Config.DeliveryRepository.Insert(ctx, delivery); err != nil {
+			return fmt.Errorf("failed to queue the delivery to the webhook '%d': %w", webhook.ID, err)
+		}
+		queued = true
+	}
+
+	if err := d.Config.DeliveryRepository.Advance(ctx, event.ID); err != nil {
+		return fmt.Errorf("failed to advance the webhook position: %w", err)
+	}
+	d.position = event.ID
+
+	if queued {
+		select {
+		case d.notify <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// deliver attempt the due deliveries whenever a delivery is queued or at every poll interval.
+func (d *Dispatcher) deliver() {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(d.Config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.notify:
+		}
+
+		if err := d.attemptDue(d.ctx); err != nil {
+			d.Config.Logger.Error().Err(err).Msg("failed to attempt the webhook deliveries")
+		}
+	}
+}
+
+func (d *Dispatcher) attemptDue(ctx context.Context) error {
+	deliveries, err := d.Config.DeliveryRepository.SelectDue(ctx, time.Now(), d.Config.Concurrency)
+	if err != nil {
+		return fmt.Errorf("failed to fetch the due deliveries: %w", err)
+	}
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for _, delivery := range deliveries {
+		// The claim lasts longer than the attempt, so a crashed server only delays the delivery.
+		now := time.Now()
+		claimed, err := d.Config.DeliveryRepository.Claim(
+			ctx, delivery.ID, now, now.Add(2*d.Config.Timeout),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to claim the delivery: %w", err)
+		}
+		if !claimed {
+			continue
+		}
+
+		wg.Add(1)
+		go func(delivery service.WebhookDelivery) {
+			defer wg.Done()
+			d.attempt(ctx, delivery)
+		}(delivery)
+	}
+
+	// A full batch means there may be more due deliveries.
+	if len(deliveries) == d.Config.Concurrency {
+		select {
+		case d.notify <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, delivery service.WebhookDelivery) {
+	logger := d.Config.Logger.With().
+		Int("webhookID", delivery.WebhookID).
+		Int("deliveryID", delivery.ID).
+		Logger()
+
+	webhook, err := d.Config.Repository.SelectOne(ctx, delivery.WebhookID)
+	if err != nil {
+		// The deliveries are deleted with the webhook.
+		if service.ErrorKindOf(err) != service.ErrorKindNotFound {
+			logger.Error().Err(err).Msg("failed to fetch the webhook")
+		}
+		return
+	}
+
+	status, err := d.post(ctx, webhook, delivery)
+	now := time.Now()
+	delivery.Attempts++
+	delivery.LastStatus = status
+	delivery.LastError = ""
+	delivery.UpdatedAt = now
+	switch {
+	case err == nil:
+		delivery.Status = service.WebhookDeliveryStatusSucceeded
+	case delivery.Attempts >= d.Config.MaxAttempts:
+		delivery.Status = service.WebhookDeliveryStatusFailed
+		delivery.LastError = err.Error()
+		logger.Warn().Err(err).Msg("webhook delivery failed, giving up")
+	default:
+		delivery.NextAttemptAt = now.Add(d.backoff(delivery.Attempts))
+		delivery.LastError = err.Error()
+		logger.Warn().Err(err).Time("nextAttemptAt", delivery.NextAttemptAt).Msg(
+			"webhook delivery failed, retrying",
+		)
+	}
+
+	if err := d.Config.DeliveryRepository.Update(ctx, delivery); err != nil {
+		logger.Error().Err(err).Msg("failed to update the webhook delivery")
+		return
+	}
+	if delivery.Status == service.WebhookDeliveryStatusPending {
+		return
+	}
+	if err := d.Config.DeliveryRepository.Compact(ctx, webhook.ID, d.Config.LogSize); err != nil {
+		logger.Error().Err(err).Msg("failed to compact the webhook deliveries")
+	}
+}
+
+// post the payload to the webhook. The status code is returned even if the delivery failed.
+func (d *Dispatcher) post(
+	ctx context.Context, webhook service.Webhook, delivery service.WebhookDelivery,
+) (int, error) {
+	ctx, ctxCancel := context.WithTimeout(ctx, d.Config.Timeout)
+	defer ctxCancel()
+
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create the request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "malta")
+	req.Header.Set("X-Malta-Event", string(delivery.Event))
+	req.Header.Set("X-Malta-Delivery", strconv.Itoa(delivery.ID))
+	req.Header.Set("X-Malta-Signature", "sha256="+Sign(webhook.Secret, delivery.Payload))
+
+	resp, err := d.Config.HTTPClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to execute the request: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status code '%d'", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	wait := d.Config.Backoff
+	for i := 1; i < attempts && wait < d.Config.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > d.Config.MaxBackoff {
+		wait = d.Config.MaxBackoff
+	}
+	return wait
+}
+
+// Sign the payload with the webhook secret, the receiver should compare it with the
+// X-Malta-Signature header.
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+type payload struct {
+	Event      service.NodeWatchEventType `json:"event"`
+	Revision   uint64                     `json:"revision"`
+	OccurredAt time.Time                  `json:"occurredAt"`
+	Node       payloadNode                `json:"node"`
+}
+
+type payloadNode struct {
+	ID              int               `json:"id"`
+	Address         string            `json:"address"`
+	Metadata        map[string]string `json:"metadata,omitempty"`
+	TTL             string            `json:"ttl,omitempty"`
+	Active          bool              `json:"active"`
+	Health          string            `json:"health,omitempty"`
+	HealthChangedAt *time.Time        `json:"healthChangedAt,omitempty"`
+	CreatedAt       time.Time         `json:"createdAt"`
+	RegisteredAt    *time.Time        `json:"registeredAt,omitempty"`
+	ReactivatedAt   *time.Time        `json:"reactivatedAt,omitempty"`
+}
+
+// newDelivery build the delivery of an event. The key is the id of the outbox event, which is also
+// the revision of the change, so the same change queued by several servers is delivered once and a
+// node that goes back to a previous state is delivered again.
+func newDelivery(webhookID int, event service.NodeOutboxEvent) (service.WebhookDelivery, error) {
+	now := time.Now()
+	rawPayload, err := json.Marshal(payload{
+		Event:      event.WatchType,
+		Revision:   uint64(event.ID),
+		OccurredAt: event.CreatedAt.UTC(),
+		Node:       toPayloadNode(event.Node),
+	})
+	if err != nil {
+		return service.WebhookDelivery{}, fmt.Errorf("failed to marshal the payload: %w", err)
+	}
+
+	return service.WebhookDelivery{
+		WebhookID:     webhookID,
+		Event:         event.WatchType,
+		NodeID:        event.NodeID,
+		Key:           strconv.Itoa(event.ID),
+		Payload:       rawPayload,
+		Status:        service.WebhookDeliveryStatusPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}, nil
+}
+
+func toPayloadNode(node service.Node) payloadNode {
+	optionalTime := func(value time.Time) *time.Time {
+		if value.IsZero() {
+			return nil
+		}
+		value = value.UTC()
+		return &value
+	}
+
+	var ttl string
+	if node.TTL > 0 {
+		ttl = node.TTL.String()
+	}
+	return payloadNode{
+		ID:              node.ID,
+		Address:         node.Address,
+		Metadata:        node.Metadata,
+		TTL:             ttl,
+		Active:          node.Active,
+		Health:          string(node.Health),
+		HealthChangedAt: optionalTime(node.HealthChangedAt),
+		CreatedAt:       node.CreatedAt.UTC(),
+		RegisteredAt:    optionalTime(node.RegisteredAt),
+		ReactivatedAt:   optionalTime(node.ReactivatedAt),
+	}
+}
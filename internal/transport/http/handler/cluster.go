@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"malta/internal/service"
+	"malta/internal/transport/http/shared"
+)
+
+type clusterRepository interface {
+	Capacity(ctx context.Context) (service.ClusterCapacity, error)
+}
+
+// Cluster is the HTTP logic around the state of the cluster as a whole.
+type Cluster struct {
+	Repository clusterRepository
+	Writer     shared.Writer
+}
+
+// Init internal state.
+func (c *Cluster) Init() error {
+	if c.Repository == nil {
+		return fmt.Errorf("repository can't be nil")
+	}
+	return nil
+}
+
+// Capacity is used to show the allocatable and allocated capacity of the cluster and of each active
+// node.
+func (c *Cluster) Capacity(w http.ResponseWriter, r *http.Request) {
+	capacity, err := c.Repository.Capacity(r.Context())
+	if err != nil {
+		c.Writer.Error(w, "failed to fetch the cluster capacity", err, errorStatus(err))
+		return
+	}
+	c.Writer.Response(w, toClusterViewCapacity(capacity), http.StatusOK, nil)
+}
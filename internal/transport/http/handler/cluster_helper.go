@@ -0,0 +1,23 @@
+package handler
+
+import "malta/internal/service"
+
+type clusterViewCapacity struct {
+	Allocatable nodeViewResources  `json:"allocatable"`
+	Allocated   nodeViewResources  `json:"allocated"`
+	Available   nodeViewResources  `json:"available"`
+	Nodes       []nodeViewCapacity `json:"nodes"`
+}
+
+func toClusterViewCapacity(capacity service.ClusterCapacity) clusterViewCapacity {
+	view := clusterViewCapacity{
+		Allocatable: toNodeViewResources(capacity.Allocatable),
+		Allocated:   toNodeViewResources(capacity.Allocated),
+		Available:   toNodeViewResources(capacity.Available()),
+		Nodes:       make([]nodeViewCapacity, 0, len(capacity.Nodes)),
+	}
+	for _, node := range capacity.Nodes {
+		view.Nodes = append(view.Nodes, toNodeViewCapacity(node))
+	}
+	return view
+}
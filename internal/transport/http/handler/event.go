@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"malta/internal/service"
+	"malta/internal/transport/http/shared"
+)
+
+type eventRepository interface {
+	Events(ctx context.Context, query service.NodeAuditQuery) ([]service.NodeAuditEvent, int, error)
+	NodeEvents(
+		ctx context.Context, id string, query service.NodeAuditQuery,
+	) ([]service.NodeAuditEvent, int, error)
+}
+
+// Event is the HTTP logic around the audit history of the nodes.
+type Event struct {
+	Repository       eventRepository
+	Writer           shared.Writer
+	IndexAddress     func(url.Values) string
+	NodeIndexAddress func(id string, query url.Values) string
+	ResourceID       func(*http.Request) string
+}
+
+// Init internal state.
+func (e *Event) Init() error {
+	if e.Repository == nil {
+		return fmt.Errorf("repository can't be nil")
+	}
+	return nil
+}
+
+// Index is used to list the events of all the nodes.
+func (e *Event) Index(w http.ResponseWriter, r *http.Request) {
+	query, err := toNodeAuditQuery(r.URL.Query())
+	if err != nil {
+		e.Writer.Error(w, "invalid query", err, http.StatusBadRequest)
+		return
+	}
+
+	events, before, err := e.Repository.Events(r.Context(), query)
+	if err != nil {
+		e.Writer.Error(w, "failed to fetch the events", err, errorStatus(err))
+		return
+	}
+
+	view := toEventViewList(events)
+	if before != 0 {
+		values := r.URL.Query()
+		values.Set("before", strconv.Itoa(before))
+		view.Next = e.IndexAddress(values)
+	}
+	e.Writer.Response(w, view, http.StatusOK, nil)
+}
+
+// NodeIndex is used to list the events of a node, including the nodes that were deleted.
+func (e *Event) NodeIndex(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	values.Del("node")
+	query, err := toNodeAuditQuery(values)
+	if err != nil {
+		e.Writer.Error(w, "invalid query", err, http.StatusBadRequest)
+		return
+	}
+
+	id := e.ResourceID(r)
+	events, before, err := e.Repository.NodeEvents(r.Context(), id, query)
+	if err != nil {
+		e.Writer.Error(w, "failed to fetch the node events", err, errorStatus(err))
+		return
+	}
+
+	view := toEventViewList(events)
+	if before != 0 {
+		values.Set("before", strconv.Itoa(before))
+		view.Next = e.NodeIndexAddress(id, values)
+	}
+	e.Writer.Response(w, view, http.StatusOK, nil)
+}
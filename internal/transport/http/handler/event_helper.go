@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	"malta/internal/service"
+)
+
+type eventViewList struct {
+	Events []eventView `json:"events"`
+	Next   string      `json:"next,omitempty"`
+}
+
+type eventView struct {
+	ID        int               `json:"id"`
+	NodeID    int               `json:"nodeID"`
+	Type      string            `json:"type"`
+	Actor     eventViewActor    `json:"actor"`
+	Before    map[string]string `json:"before"`
+	After     map[string]string `json:"after"`
+	CreatedAt string            `json:"createdAt"`
+}
+
+type eventViewActor struct {
+	Kind string `json:"kind"`
+	ID   string `json:"id,omitempty"`
+}
+
+func toEventViewList(events []service.NodeAuditEvent) eventViewList {
+	view := eventViewList{Events: make([]eventView, 0, len(events))}
+	for _, event := range events {
+		before, after := event.Before, event.After
+		if before == nil {
+			before = make(map[string]string)
+		}
+		if after == nil {
+			after = make(map[string]string)
+		}
+		view.Events = append(view.Events, eventView{
+			ID:     event.ID,
+			NodeID: event.NodeID,
+			Type:   string(event.Type),
+			Actor: eventViewActor{
+				Kind: string(event.Actor.Kind),
+				ID:   event.Actor.ID,
+			},
+			Before:    before,
+			After:     after,
+			CreatedAt: formatTime(event.CreatedAt),
+		})
+	}
+	return view
+}
+
+func toNodeAuditQuery(values url.Values) (service.NodeAuditQuery, error) {
+	var (
+		query service.NodeAuditQuery
+		err   error
+	)
+	if value := values.Get("node"); value != "" {
+		query.NodeID, err = strconv.Atoi(value)
+		if err != nil {
+			return service.NodeAuditQuery{}, service.ValidationError{
+				Fields: map[string]string{"node": "invalid id"},
+			}
+		}
+	}
+	if value := values.Get("type"); value != "" {
+		for _, eventType := range strings.Split(value, ",") {
+			query.Types = append(query.Types, service.NodeAuditEventType(strings.TrimSpace(eventType)))
+		}
+	}
+	query.ActorKind = service.NodeAuditActorKind(values.Get("actor"))
+	if query.From, err = parseQueryTime(values, "from"); err != nil {
+		return service.NodeAuditQuery{}, err
+	}
+	if query.To, err = parseQueryTime(values, "to"); err != nil {
+		return service.NodeAuditQuery{}, err
+	}
+
+	if value := values.Get("limit"); value != "" {
+		query.Limit, err = strconv.Atoi(value)
+		if err != nil {
+			return service.NodeAuditQuery{}, service.ValidationError{
+				Fields: map[string]string{"limit": "invalid number"},
+			}
+		}
+	}
+	if value := values.Get("before"); value != "" {
+		query.Before, err = strconv.Atoi(value)
+		if err != nil {
+			return service.NodeAuditQuery{}, service.ValidationError{
+				Fields: map[string]string{"before": "invalid id"},
+			}
+		}
+	}
+	return query, nil
+}
@@ -18,5 +18,5 @@ func (i *Invalid) NotFound(w http.ResponseWriter, r *http.Request) {
 
 // MethodNotAllowed handler.
 func (i *Invalid) MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
-	i.Writer.Error(w, "method not allowed", nil, http.StatusBadRequest)
+	i.Writer.Error(w, "method not allowed", nil, http.StatusMethodNotAllowed)
 }
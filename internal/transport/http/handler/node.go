@@ -5,23 +5,53 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
 	"malta/internal/service"
 	"malta/internal/transport/http/shared"
 )
 
+// watchKeepAliveInterval is used to send comments to the idle streams, this way the proxies don't
+// close them.
+const watchKeepAliveInterval = 15 * time.Second
+
 type nodeRepository interface {
-	Index(ctx context.Context) ([]service.Node, error)
+	Index(ctx context.Context, query service.NodeQuery) ([]service.Node, *service.NodeCursor, error)
 	FindOne(ctx context.Context, id string) (service.Node, error)
-	Create(ctx context.Context, node service.Node) (service.Node, error)
+	Create(ctx context.Context, node service.Node) (service.Node, bool, error)
+	Update(ctx context.Context, id string, patch service.NodePatch) (service.Node, error)
+	Heartbeat(ctx context.Context, id string) (service.Node, error)
+	Checks(
+		ctx context.Context, id string, query service.NodeCheckResultQuery,
+	) ([]service.NodeCheckResult, service.NodeUptime, error)
+	Observations(ctx context.Context, id string) ([]service.NodeObservation, error)
+	Status(ctx context.Context, id string) (service.NodeStatus, error)
+	ReportStatus(ctx context.Context, id string, status service.NodeStatus) (service.NodeStatus, error)
+	Allocations(
+		ctx context.Context, id string,
+	) ([]service.NodeAllocation, service.NodeCapacity, error)
+	Allocate(
+		ctx context.Context, id string, allocation service.NodeAllocation,
+	) (service.NodeAllocation, error)
+	Release(ctx context.Context, id string, allocationID string) error
+	Delete(ctx context.Context, id string) error
+}
+
+type nodeWatcher interface {
+	Watch(after uint64) service.NodeWatch
 }
 
 // Node is the HTTP logic around the node business logic.
 type Node struct {
 	Repository      nodeRepository
+	Watcher         nodeWatcher
 	Writer          shared.Writer
 	ResourceAddress func(service.Node) string
+	IndexAddress    func(url.Values) string
 	ResourceID      func(*http.Request) string
+	AllocationID    func(*http.Request) string
 }
 
 // Init internal state.
@@ -29,18 +59,37 @@ func (n *Node) Init() error {
 	if n.Repository == nil {
 		return fmt.Errorf("repository can't be nil")
 	}
+	if n.Watcher == nil {
+		return fmt.Errorf("watcher can't be nil")
+	}
 	return nil
 }
 
 // Index is used to list the nodes.
 func (n *Node) Index(w http.ResponseWriter, r *http.Request) {
-	rawNodes, err := n.Repository.Index(r.Context())
+	query, err := toNodeQuery(r.URL.Query())
+	if err != nil {
+		n.Writer.Error(w, "invalid query", err, http.StatusBadRequest)
+		return
+	}
+
+	rawNodes, cursor, err := n.Repository.Index(r.Context(), query)
 	if err != nil {
-		n.Writer.Error(w, "failed to fetch the nodes", err, http.StatusInternalServerError)
+		n.Writer.Error(w, "failed to fetch the nodes", err, errorStatus(err))
 		return
 	}
 
 	nodes := toNodeViewList(rawNodes)
+	if cursor != nil {
+		value, err := cursor.Encode()
+		if err != nil {
+			n.Writer.Error(w, "failed to generate the next page", err, http.StatusInternalServerError)
+			return
+		}
+		values := r.URL.Query()
+		values.Set("cursor", value)
+		nodes.Next = n.IndexAddress(values)
+	}
 	n.Writer.Response(w, nodes, http.StatusOK, nil)
 }
 
@@ -48,7 +97,7 @@ func (n *Node) Index(w http.ResponseWriter, r *http.Request) {
 func (n *Node) Show(w http.ResponseWriter, r *http.Request) {
 	rawNode, err := n.Repository.FindOne(r.Context(), n.ResourceID(r))
 	if err != nil {
-		n.Writer.Error(w, "failed to fetch the node", err, http.StatusInternalServerError)
+		n.Writer.Error(w, "failed to fetch the node", err, errorStatus(err))
 		return
 	}
 
@@ -62,13 +111,19 @@ func (n *Node) Create(w http.ResponseWriter, r *http.Request) {
 	decoder := json.NewDecoder(r.Body)
 	decoder.DisallowUnknownFields()
 	if err := decoder.Decode(&nv); err != nil {
-		n.Writer.Error(w, "failed parse request body", err, http.StatusInternalServerError)
+		n.Writer.Error(w, "failed parse request body", err, http.StatusBadRequest)
 		return
 	}
 
-	rawNode, err := n.Repository.Create(r.Context(), toNode(nv))
+	rawNode, err := toNode(nv)
 	if err != nil {
-		n.Writer.Error(w, "failed to create the the node", err, http.StatusInternalServerError)
+		n.Writer.Error(w, "invalid node", err, http.StatusBadRequest)
+		return
+	}
+
+	rawNode, created, err := n.Repository.Create(r.Context(), rawNode)
+	if err != nil {
+		n.Writer.Error(w, "failed to create the the node", err, errorStatus(err))
 		return
 	}
 	node := toNodeView(rawNode)
@@ -78,5 +133,232 @@ func (n *Node) Create(w http.ResponseWriter, r *http.Request) {
 			n.ResourceAddress(rawNode),
 		},
 	}
-	n.Writer.Response(w, node, http.StatusCreated, headers)
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	n.Writer.Response(w, node, status, headers)
+}
+
+// Update partially a node.
+func (n *Node) Update(w http.ResponseWriter, r *http.Request) {
+	var nv nodeViewUpdate
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&nv); err != nil {
+		n.Writer.Error(w, "failed parse request body", err, http.StatusBadRequest)
+		return
+	}
+
+	patch, err := toNodePatch(nv)
+	if err != nil {
+		n.Writer.Error(w, "invalid node", err, http.StatusBadRequest)
+		return
+	}
+
+	rawNode, err := n.Repository.Update(r.Context(), n.ResourceID(r), patch)
+	if err != nil {
+		n.Writer.Error(w, "failed to update the node", err, errorStatus(err))
+		return
+	}
+
+	node := toNodeView(rawNode)
+	n.Writer.Response(w, node, http.StatusOK, nil)
+}
+
+// Checks is used to list the results of the checks of a node.
+func (n *Node) Checks(w http.ResponseWriter, r *http.Request) {
+	query, err := toNodeCheckResultQuery(r.URL.Query())
+	if err != nil {
+		n.Writer.Error(w, "invalid query", err, http.StatusBadRequest)
+		return
+	}
+
+	results, uptime, err := n.Repository.Checks(r.Context(), n.ResourceID(r), query)
+	if err != nil {
+		n.Writer.Error(w, "failed to fetch the node checks", err, errorStatus(err))
+		return
+	}
+	n.Writer.Response(w, toNodeViewCheckResultList(results, uptime), http.StatusOK, nil)
+}
+
+// Observations is used to list the health of a node as seen by each observer.
+func (n *Node) Observations(w http.ResponseWriter, r *http.Request) {
+	observations, err := n.Repository.Observations(r.Context(), n.ResourceID(r))
+	if err != nil {
+		n.Writer.Error(w, "failed to fetch the node observations", err, errorStatus(err))
+		return
+	}
+	n.Writer.Response(w, toNodeViewObservationList(observations), http.StatusOK, nil)
+}
+
+// Status is used to fetch the last status reported by a node.
+func (n *Node) Status(w http.ResponseWriter, r *http.Request) {
+	status, err := n.Repository.Status(r.Context(), n.ResourceID(r))
+	if err != nil {
+		n.Writer.Error(w, "failed to fetch the node status", err, errorStatus(err))
+		return
+	}
+	n.Writer.Response(w, toNodeViewStatus(status), http.StatusOK, nil)
+}
+
+// ReportStatus is used by the nodes to report their own status.
+func (n *Node) ReportStatus(w http.ResponseWriter, r *http.Request) {
+	var nv nodeViewStatus
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&nv); err != nil {
+		n.Writer.Error(w, "failed parse request body", err, http.StatusBadRequest)
+		return
+	}
+
+	status, err := n.Repository.ReportStatus(r.Context(), n.ResourceID(r), toNodeStatus(nv))
+	if err != nil {
+		n.Writer.Error(w, "failed to report the node status", err, errorStatus(err))
+		return
+	}
+	n.Writer.Response(w, toNodeViewStatus(status), http.StatusOK, nil)
+}
+
+// Allocations is used to list the allocations of a node together with its capacity.
+func (n *Node) Allocations(w http.ResponseWriter, r *http.Request) {
+	allocations, capacity, err := n.Repository.Allocations(r.Context(), n.ResourceID(r))
+	if err != nil {
+		n.Writer.Error(w, "failed to fetch the node allocations", err, errorStatus(err))
+		return
+	}
+	n.Writer.Response(w, toNodeViewAllocationList(allocations, capacity), http.StatusOK, nil)
+}
+
+// Allocate take a share of the capacity of a node.
+func (n *Node) Allocate(w http.ResponseWriter, r *http.Request) {
+	var nv nodeViewAllocationCreate
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&nv); err != nil {
+		n.Writer.Error(w, "failed parse request body", err, http.StatusBadRequest)
+		return
+	}
+
+	allocation, err := n.Repository.Allocate(r.Context(), n.ResourceID(r), toNodeAllocation(nv))
+	if err != nil {
+		n.Writer.Error(w, "failed to allocate the node capacity", err, errorStatus(err))
+		return
+	}
+	n.Writer.Response(w, toNodeViewAllocation(allocation), http.StatusCreated, nil)
+}
+
+// Release an allocation of a node.
+func (n *Node) Release(w http.ResponseWriter, r *http.Request) {
+	err := n.Repository.Release(r.Context(), n.ResourceID(r), n.AllocationID(r))
+	if err != nil {
+		n.Writer.Error(w, "failed to release the allocation", err, errorStatus(err))
+		return
+	}
+	n.Writer.Response(w, nil, http.StatusNoContent, nil)
+}
+
+// Watch stream the changes of the nodes as server-sent events. The stream resumes after the revision
+// at the 'Last-Event-ID' header or the 'revision' parameter, otherwise it starts with a snapshot of
+// the nodes.
+func (n *Node) Watch(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		n.Writer.Error(w, "streaming not supported", nil, http.StatusInternalServerError)
+		return
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("revision")
+	}
+	var revision uint64
+	if lastEventID != "" {
+		var err error
+		revision, err = strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			err = service.ValidationError{Fields: map[string]string{"revision": "invalid revision"}}
+			n.Writer.Error(w, "invalid revision", err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	watch := n.Watcher.Watch(revision)
+	defer watch.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	if !watch.Resumed {
+		snapshot := toNodeViewWatchSnapshot(watch.Revision, watch.Snapshot)
+		if err := writeEvent(w, watch.Revision, "snapshot", snapshot); err != nil {
+			return
+		}
+	}
+	for _, event := range watch.Backlog {
+		if err := writeWatchEvent(w, event); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(watchKeepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case event, ok := <-watch.Events:
+			if !ok {
+				return
+			}
+			if err := writeWatchEvent(w, event); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// Heartbeat renew the lease of a node.
+func (n *Node) Heartbeat(w http.ResponseWriter, r *http.Request) {
+	rawNode, err := n.Repository.Heartbeat(r.Context(), n.ResourceID(r))
+	if err != nil {
+		n.Writer.Error(w, "failed to renew the node lease", err, errorStatus(err))
+		return
+	}
+
+	node := toNodeView(rawNode)
+	n.Writer.Response(w, node, http.StatusOK, nil)
+}
+
+// Delete a node.
+func (n *Node) Delete(w http.ResponseWriter, r *http.Request) {
+	if err := n.Repository.Delete(r.Context(), n.ResourceID(r)); err != nil {
+		n.Writer.Error(w, "failed to delete the node", err, errorStatus(err))
+		return
+	}
+	n.Writer.Response(w, nil, http.StatusNoContent, nil)
+}
+
+// errorStatus translate the service errors into HTTP status codes.
+func errorStatus(err error) int {
+	switch service.ErrorKindOf(err) {
+	case service.ErrorKindNotFound:
+		return http.StatusNotFound
+	case service.ErrorKindValidation:
+		return http.StatusBadRequest
+	case service.ErrorKindConflict:
+		return http.StatusConflict
+	case service.ErrorKindUnavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
 }
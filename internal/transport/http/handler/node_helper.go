@@ -1,38 +1,204 @@
 package handler
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"malta/internal/service"
 )
 
+// redactedValue replace the values of the check headers at the responses, they usually have
+// credentials like auth tokens.
+const redactedValue = "[redacted]"
+
 type nodeViewCreate struct {
 	Address  string            `json:"address"`
 	Metadata map[string]string `json:"metadata"`
+	TTL      string            `json:"ttl"`
+	Check    nodeViewCheck     `json:"check"`
+	Capacity nodeViewResources `json:"capacity"`
+}
+
+type nodeViewResources struct {
+	CPU       int64            `json:"cpu"`
+	Memory    int64            `json:"memory"`
+	Disk      int64            `json:"disk"`
+	Slots     int64            `json:"slots"`
+	Resources map[string]int64 `json:"resources,omitempty"`
+}
+
+type nodeViewCheck struct {
+	Type        string            `json:"type,omitempty"`
+	GRPCService string            `json:"grpcService,omitempty"`
+	GracePeriod string            `json:"gracePeriod,omitempty"`
+	HTTP        nodeViewCheckHTTP `json:"http"`
+}
+
+type nodeViewCheckHTTP struct {
+	Path          string            `json:"path,omitempty"`
+	Method        string            `json:"method,omitempty"`
+	Headers       map[string]string `json:"headers,omitempty"`
+	Statuses      []string          `json:"statuses,omitempty"`
+	BodyRegex     string            `json:"bodyRegex,omitempty"`
+	BodyJSONPath  string            `json:"bodyJSONPath,omitempty"`
+	BodyJSONValue string            `json:"bodyJSONValue,omitempty"`
+}
+
+type nodeViewUpdate struct {
+	Address  *string            `json:"address"`
+	Metadata map[string]*string `json:"metadata"`
+	Check    *nodeViewCheck     `json:"check"`
+	Capacity *nodeViewResources `json:"capacity"`
+}
+
+type nodeViewAllocationCreate struct {
+	ID        string            `json:"id"`
+	Resources nodeViewResources `json:"resources"`
+}
+
+type nodeViewAllocation struct {
+	ID        string            `json:"id"`
+	Resources nodeViewResources `json:"resources"`
+	CreatedAt string            `json:"createdAt"`
+}
+
+type nodeViewAllocationList struct {
+	Allocations []nodeViewAllocation `json:"allocations"`
+	Capacity    nodeViewCapacity     `json:"capacity"`
+}
+
+type nodeViewCapacity struct {
+	NodeID      int               `json:"nodeID"`
+	Address     string            `json:"address"`
+	Allocatable nodeViewResources `json:"allocatable"`
+	Allocated   nodeViewResources `json:"allocated"`
+	Available   nodeViewResources `json:"available"`
 }
 
 type nodeViewList struct {
 	Nodes []nodeView `json:"nodes"`
+	Next  string     `json:"next,omitempty"`
+}
+
+type nodeViewCheckResultList struct {
+	Checks []nodeViewCheckResult `json:"checks"`
+	Uptime nodeViewUptime        `json:"uptime"`
+}
+
+type nodeViewCheckResult struct {
+	ID         int    `json:"id"`
+	ObserverID string `json:"observerID,omitempty"`
+	Type       string `json:"type"`
+	CheckedAt  string `json:"checkedAt"`
+	Latency    string `json:"latency"`
+	Status     int    `json:"status,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Healthy    bool   `json:"healthy"`
+}
+
+type nodeViewObservationList struct {
+	Observations []nodeViewObservation `json:"observations"`
+}
+
+type nodeViewObservation struct {
+	ObserverID string `json:"observerID"`
+	Health     string `json:"health"`
+	ObservedAt string `json:"observedAt"`
+}
+
+type nodeViewUptime struct {
+	From       string  `json:"from"`
+	To         string  `json:"to"`
+	Checks     int     `json:"checks"`
+	Healthy    int     `json:"healthy"`
+	Percentage float64 `json:"percentage"`
+}
+
+type nodeViewStatus struct {
+	Status     string                             `json:"status"`
+	Components map[string]nodeViewStatusComponent `json:"components"`
+	Gauges     map[string]float64                 `json:"gauges"`
+	ReportedAt string                             `json:"reportedAt,omitempty"`
+}
+
+type nodeViewStatusComponent struct {
+	Status string `json:"status"`
+	Output string `json:"output,omitempty"`
+}
+
+type nodeViewWatchSnapshot struct {
+	Revision uint64     `json:"revision"`
+	Nodes    []nodeView `json:"nodes"`
+}
+
+type nodeViewWatchEvent struct {
+	Revision uint64   `json:"revision"`
+	Type     string   `json:"type"`
+	Node     nodeView `json:"node"`
 }
 
 type nodeView struct {
-	ID        int               `json:"id"`
-	Address   string            `json:"address"`
-	Metadata  map[string]string `json:"metadata"`
-	TTL       string            `json:"ttl"`
-	Active    bool              `json:"active"`
-	CreatedAt string            `json:"createdAt"`
+	ID              int               `json:"id"`
+	Address         string            `json:"address"`
+	Metadata        map[string]string `json:"metadata"`
+	TTL             string            `json:"ttl"`
+	Check           nodeViewCheck     `json:"check"`
+	Capacity        nodeViewResources `json:"capacity"`
+	Active          bool              `json:"active"`
+	Health          string            `json:"health"`
+	HealthChangedAt string            `json:"healthChangedAt,omitempty"`
+	CreatedAt       string            `json:"createdAt"`
+	LastSeen        string            `json:"lastSeen,omitempty"`
+	ExpiresAt       string            `json:"expiresAt,omitempty"`
+	ReactivatedAt   string            `json:"reactivatedAt,omitempty"`
+	RegisteredAt    string            `json:"registeredAt,omitempty"`
 }
 
 func toNodeView(n service.Node) nodeView {
 	return nodeView{
-		ID:        n.ID,
-		Address:   n.Address,
-		Metadata:  n.Metadata,
-		TTL:       n.TTL.String(),
-		Active:    n.Active,
-		CreatedAt: n.CreatedAt.Format(time.RFC3339),
+		ID:              n.ID,
+		Address:         n.Address,
+		Metadata:        n.Metadata,
+		TTL:             n.TTL.String(),
+		Check:           toNodeViewCheck(n.Check),
+		Capacity:        toNodeViewResources(n.Capacity),
+		Active:          n.Active,
+		Health:          string(n.Health),
+		HealthChangedAt: formatTime(n.HealthChangedAt),
+		CreatedAt:       n.CreatedAt.Format(time.RFC3339),
+		LastSeen:        formatTime(n.LastSeen),
+		ExpiresAt:       formatTime(n.ExpiresAt),
+		ReactivatedAt:   formatTime(n.ReactivatedAt),
+		RegisteredAt:    formatTime(n.RegisteredAt),
+	}
+}
+
+func toNodeViewWatchSnapshot(revision uint64, nodes []service.Node) nodeViewWatchSnapshot {
+	return nodeViewWatchSnapshot{Revision: revision, Nodes: toNodeViewList(nodes).Nodes}
+}
+
+func writeWatchEvent(w io.Writer, event service.NodeWatchEvent) error {
+	view := nodeViewWatchEvent{
+		Revision: event.Revision,
+		Type:     string(event.Type),
+		Node:     toNodeView(event.Node),
+	}
+	return writeEvent(w, event.Revision, string(event.Type), view)
+}
+
+// writeEvent write a server-sent event with the JSON representation of the data.
+func writeEvent(w io.Writer, id uint64, event string, data interface{}) error {
+	content, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal the event: %w", err)
 	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", id, event, content)
+	return err
 }
 
 func toNodeViewList(nodes []service.Node) nodeViewList {
@@ -46,9 +212,319 @@ func toNodeViewList(nodes []service.Node) nodeViewList {
 	return result
 }
 
-func toNode(nv nodeViewCreate) service.Node {
-	return service.Node{
+func toNodeViewCheckResultList(
+	results []service.NodeCheckResult, uptime service.NodeUptime,
+) nodeViewCheckResultList {
+	view := nodeViewCheckResultList{
+		Checks: make([]nodeViewCheckResult, 0, len(results)),
+		Uptime: nodeViewUptime{
+			From:       formatTime(uptime.From),
+			To:         formatTime(uptime.To),
+			Checks:     uptime.Checks,
+			Healthy:    uptime.Healthy,
+			Percentage: uptime.Percentage(),
+		},
+	}
+	for _, result := range results {
+		view.Checks = append(view.Checks, nodeViewCheckResult{
+			ID:         result.ID,
+			ObserverID: result.ObserverID,
+			Type:       string(result.Type),
+			CheckedAt:  formatTime(result.CheckedAt),
+			Latency:    result.Latency.String(),
+			Status:     result.Status,
+			Error:      result.Error,
+			Healthy:    result.Healthy,
+		})
+	}
+	return view
+}
+
+func toNodeViewObservationList(observations []service.NodeObservation) nodeViewObservationList {
+	view := nodeViewObservationList{
+		Observations: make([]nodeViewObservation, 0, len(observations)),
+	}
+	for _, observation := range observations {
+		view.Observations = append(view.Observations, nodeViewObservation{
+			ObserverID: observation.ObserverID,
+			Health:     string(observation.Health),
+			ObservedAt: formatTime(observation.ObservedAt),
+		})
+	}
+	return view
+}
+
+func toNodeViewStatus(status service.NodeStatus) nodeViewStatus {
+	view := nodeViewStatus{
+		Status:     string(status.Status),
+		Components: make(map[string]nodeViewStatusComponent, len(status.Components)),
+		Gauges:     status.Gauges,
+		ReportedAt: formatTime(status.ReportedAt),
+	}
+	if view.Gauges == nil {
+		view.Gauges = make(map[string]float64)
+	}
+	for name, component := range status.Components {
+		view.Components[name] = nodeViewStatusComponent{
+			Status: string(component.Status),
+			Output: component.Output,
+		}
+	}
+	return view
+}
+
+func toNodeStatus(nv nodeViewStatus) service.NodeStatus {
+	status := service.NodeStatus{
+		Status:     service.NodeStatusValue(nv.Status),
+		Components: make(map[string]service.NodeStatusComponent, len(nv.Components)),
+		Gauges:     nv.Gauges,
+	}
+	for name, component := range nv.Components {
+		status.Components[name] = service.NodeStatusComponent{
+			Status: service.NodeStatusValue(component.Status),
+			Output: component.Output,
+		}
+	}
+	return status
+}
+
+func toNode(nv nodeViewCreate) (service.Node, error) {
+	check, err := toNodeCheck(nv.Check)
+	if err != nil {
+		return service.Node{}, err
+	}
+	node := service.Node{
 		Address:  nv.Address,
 		Metadata: nv.Metadata,
+		Check:    check,
+		Capacity: toNodeResources(nv.Capacity),
+	}
+
+	if nv.TTL != "" {
+		ttl, err := time.ParseDuration(nv.TTL)
+		if err != nil {
+			return service.Node{}, service.ValidationError{
+				Fields: map[string]string{"ttl": "invalid duration"},
+			}
+		}
+		node.TTL = ttl
+	}
+	return node, nil
+}
+
+func toNodePatch(nv nodeViewUpdate) (service.NodePatch, error) {
+	patch := service.NodePatch{
+		Address:  nv.Address,
+		Metadata: nv.Metadata,
+	}
+	if nv.Check != nil {
+		check, err := toNodeCheck(*nv.Check)
+		if err != nil {
+			return service.NodePatch{}, err
+		}
+		patch.Check = &check
+	}
+	if nv.Capacity != nil {
+		capacity := toNodeResources(*nv.Capacity)
+		patch.Capacity = &capacity
+	}
+	return patch, nil
+}
+
+func toNodeViewResources(resources service.NodeResources) nodeViewResources {
+	view := nodeViewResources{
+		CPU:    resources.CPU,
+		Memory: resources.Memory,
+		Disk:   resources.Disk,
+		Slots:  resources.Slots,
+	}
+	if len(resources.Custom) > 0 {
+		view.Resources = resources.Custom
+	}
+	return view
+}
+
+func toNodeResources(nv nodeViewResources) service.NodeResources {
+	return service.NodeResources{
+		CPU:    nv.CPU,
+		Memory: nv.Memory,
+		Disk:   nv.Disk,
+		Slots:  nv.Slots,
+		Custom: nv.Resources,
+	}
+}
+
+func toNodeViewCapacity(capacity service.NodeCapacity) nodeViewCapacity {
+	return nodeViewCapacity{
+		NodeID:      capacity.NodeID,
+		Address:     capacity.Address,
+		Allocatable: toNodeViewResources(capacity.Allocatable),
+		Allocated:   toNodeViewResources(capacity.Allocated),
+		Available:   toNodeViewResources(capacity.Available()),
+	}
+}
+
+func toNodeViewAllocation(allocation service.NodeAllocation) nodeViewAllocation {
+	return nodeViewAllocation{
+		ID:        allocation.ID,
+		Resources: toNodeViewResources(allocation.Resources),
+		CreatedAt: formatTime(allocation.CreatedAt),
+	}
+}
+
+func toNodeViewAllocationList(
+	allocations []service.NodeAllocation, capacity service.NodeCapacity,
+) nodeViewAllocationList {
+	view := nodeViewAllocationList{
+		Allocations: make([]nodeViewAllocation, 0, len(allocations)),
+		Capacity:    toNodeViewCapacity(capacity),
+	}
+	for _, allocation := range allocations {
+		view.Allocations = append(view.Allocations, toNodeViewAllocation(allocation))
+	}
+	return view
+}
+
+func toNodeAllocation(nv nodeViewAllocationCreate) service.NodeAllocation {
+	return service.NodeAllocation{ID: nv.ID, Resources: toNodeResources(nv.Resources)}
+}
+
+// toNodeViewCheck render the check of a node. The values of the headers are redacted, so a check
+// sent back with PATCH should have the headers again.
+func toNodeViewCheck(check service.NodeCheck) nodeViewCheck {
+	var gracePeriod string
+	if check.GracePeriod > 0 {
+		gracePeriod = check.GracePeriod.String()
+	}
+	var headers map[string]string
+	if len(check.HTTP.Headers) > 0 {
+		headers = make(map[string]string, len(check.HTTP.Headers))
+		for name := range check.HTTP.Headers {
+			headers[name] = redactedValue
+		}
+	}
+	return nodeViewCheck{
+		Type:        string(check.Type),
+		GRPCService: check.GRPCService,
+		GracePeriod: gracePeriod,
+		HTTP: nodeViewCheckHTTP{
+			Path:          check.HTTP.Path,
+			Method:        check.HTTP.Method,
+			Headers:       headers,
+			Statuses:      check.HTTP.Statuses,
+			BodyRegex:     check.HTTP.BodyRegex,
+			BodyJSONPath:  check.HTTP.BodyJSONPath,
+			BodyJSONValue: check.HTTP.BodyJSONValue,
+		},
+	}
+}
+
+func toNodeCheck(nv nodeViewCheck) (service.NodeCheck, error) {
+	var gracePeriod time.Duration
+	if nv.GracePeriod != "" {
+		var err error
+		gracePeriod, err = time.ParseDuration(nv.GracePeriod)
+		if err != nil {
+			return service.NodeCheck{}, service.ValidationError{
+				Fields: map[string]string{"check.gracePeriod": "invalid duration"},
+			}
+		}
+	}
+	return service.NodeCheck{
+		Type:        service.NodeCheckType(nv.Type),
+		GRPCService: nv.GRPCService,
+		GracePeriod: gracePeriod,
+		HTTP: service.NodeCheckHTTP{
+			Path:          nv.HTTP.Path,
+			Method:        nv.HTTP.Method,
+			Headers:       nv.HTTP.Headers,
+			Statuses:      nv.HTTP.Statuses,
+			BodyRegex:     nv.HTTP.BodyRegex,
+			BodyJSONPath:  nv.HTTP.BodyJSONPath,
+			BodyJSONValue: nv.HTTP.BodyJSONValue,
+		},
+	}, nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func toNodeQuery(values url.Values) (service.NodeQuery, error) {
+	var (
+		query service.NodeQuery
+		err   error
+	)
+	query.Selector, err = service.ParseNodeSelector(values.Get("selector"))
+	if err != nil {
+		return service.NodeQuery{}, err
+	}
+	query.State = service.NodeQueryState(values.Get("state"))
+	if value := values.Get("health"); value != "" {
+		for _, health := range strings.Split(value, ",") {
+			query.Health = append(query.Health, service.NodeHealth(strings.TrimSpace(health)))
+		}
+	}
+	query.Sort = service.NodeSort(values.Get("sort"))
+
+	if value := values.Get("limit"); value != "" {
+		query.Limit, err = strconv.Atoi(value)
+		if err != nil {
+			return service.NodeQuery{}, service.ValidationError{
+				Fields: map[string]string{"limit": "invalid number"},
+			}
+		}
+	}
+
+	if value := values.Get("cursor"); value != "" {
+		cursor, err := service.ParseNodeCursor(value)
+		if err != nil {
+			return service.NodeQuery{}, err
+		}
+		if query.Sort == "" {
+			query.Sort = cursor.Sort
+		}
+		query.After = &cursor
+	}
+	return query, nil
+}
+
+func toNodeCheckResultQuery(values url.Values) (service.NodeCheckResultQuery, error) {
+	var (
+		query service.NodeCheckResultQuery
+		err   error
+	)
+	if query.From, err = parseQueryTime(values, "from"); err != nil {
+		return service.NodeCheckResultQuery{}, err
+	}
+	if query.To, err = parseQueryTime(values, "to"); err != nil {
+		return service.NodeCheckResultQuery{}, err
+	}
+
+	if value := values.Get("limit"); value != "" {
+		query.Limit, err = strconv.Atoi(value)
+		if err != nil {
+			return service.NodeCheckResultQuery{}, service.ValidationError{
+				Fields: map[string]string{"limit": "invalid number"},
+			}
+		}
+	}
+	return query, nil
+}
+
+func parseQueryTime(values url.Values, key string) (time.Time, error) {
+	value := values.Get(key)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, service.ValidationError{
+			Fields: map[string]string{key: "invalid time, expected RFC3339"},
+		}
 	}
+	return t, nil
 }
@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"malta/internal/service"
+	"malta/internal/transport/http/shared"
+)
+
+type webhookRepository interface {
+	Index(ctx context.Context) ([]service.Webhook, error)
+	FindOne(ctx context.Context, id string) (service.Webhook, error)
+	Create(ctx context.Context, webhook service.Webhook) (service.Webhook, error)
+	Delete(ctx context.Context, id string) error
+	Deliveries(ctx context.Context, id string, limit int) ([]service.WebhookDelivery, error)
+}
+
+// Webhook is the HTTP logic around the webhook business logic.
+type Webhook struct {
+	Repository      webhookRepository
+	Writer          shared.Writer
+	ResourceAddress func(service.Webhook) string
+	ResourceID      func(*http.Request) string
+}
+
+// Init internal state.
+func (wh *Webhook) Init() error {
+	if wh.Repository == nil {
+		return fmt.Errorf("repository can't be nil")
+	}
+	return nil
+}
+
+// Index is used to list the webhooks.
+func (wh *Webhook) Index(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := wh.Repository.Index(r.Context())
+	if err != nil {
+		wh.Writer.Error(w, "failed to fetch the webhooks", err, errorStatus(err))
+		return
+	}
+	wh.Writer.Response(w, toWebhookViewList(webhooks), http.StatusOK, nil)
+}
+
+// Show is used to show a single webhook.
+func (wh *Webhook) Show(w http.ResponseWriter, r *http.Request) {
+	webhook, err := wh.Repository.FindOne(r.Context(), wh.ResourceID(r))
+	if err != nil {
+		wh.Writer.Error(w, "failed to fetch the webhook", err, errorStatus(err))
+		return
+	}
+	wh.Writer.Response(w, toWebhookView(webhook), http.StatusOK, nil)
+}
+
+// Create a webhook. The secret is only returned here.
+func (wh *Webhook) Create(w http.ResponseWriter, r *http.Request) {
+	var wv webhookViewCreate
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&wv); err != nil {
+		wh.Writer.Error(w, "failed parse request body", err, http.StatusBadRequest)
+		return
+	}
+
+	webhook, err := wh.Repository.Create(r.Context(), toWebhook(wv))
+	if err != nil {
+		wh.Writer.Error(w, "failed to create the webhook", err, errorStatus(err))
+		return
+	}
+
+	view := toWebhookView(webhook)
+	view.Secret = webhook.Secret
+	headers := http.Header{
+		"Location": []string{
+			wh.ResourceAddress(webhook),
+		},
+	}
+	wh.Writer.Response(w, view, http.StatusCreated, headers)
+}
+
+// Delete a webhook.
+func (wh *Webhook) Delete(w http.ResponseWriter, r *http.Request) {
+	if err := wh.Repository.Delete(r.Context(), wh.ResourceID(r)); err != nil {
+		wh.Writer.Error(w, "failed to delete the webhook", err, errorStatus(err))
+		return
+	}
+	wh.Writer.Response(w, nil, http.StatusNoContent, nil)
+}
+
+// Deliveries is used to list the last deliveries of a webhook.
+func (wh *Webhook) Deliveries(w http.ResponseWriter, r *http.Request) {
+	var limit int
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil {
+			err = service.ValidationError{Fields: map[string]string{"limit": "invalid number"}}
+			wh.Writer.Error(w, "invalid query", err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	deliveries, err := wh.Repository.Deliveries(r.Context(), wh.ResourceID(r), limit)
+	if err != nil {
+		wh.Writer.Error(w, "failed to fetch the webhook deliveries", err, errorStatus(err))
+		return
+	}
+	wh.Writer.Response(w, toWebhookViewDeliveryList(deliveries), http.StatusOK, nil)
+}
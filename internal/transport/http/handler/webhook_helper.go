@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"encoding/json"
+
+	"malta/internal/service"
+)
+
+type webhookViewCreate struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Secret string   `json:"secret"`
+}
+
+type webhookViewList struct {
+	Webhooks []webhookView `json:"webhooks"`
+}
+
+type webhookView struct {
+	ID        int      `json:"id"`
+	URL       string   `json:"url"`
+	Events    []string `json:"events"`
+	Secret    string   `json:"secret,omitempty"`
+	CreatedAt string   `json:"createdAt"`
+}
+
+type webhookViewDeliveryList struct {
+	Deliveries []webhookViewDelivery `json:"deliveries"`
+}
+
+type webhookViewDelivery struct {
+	ID            int             `json:"id"`
+	Event         string          `json:"event"`
+	NodeID        int             `json:"nodeID"`
+	Status        string          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	NextAttemptAt string          `json:"nextAttemptAt,omitempty"`
+	LastStatus    int             `json:"lastStatus,omitempty"`
+	LastError     string          `json:"lastError,omitempty"`
+	Payload       json.RawMessage `json:"payload"`
+	CreatedAt     string          `json:"createdAt"`
+	UpdatedAt     string          `json:"updatedAt"`
+}
+
+func toWebhook(wv webhookViewCreate) service.Webhook {
+	webhook := service.Webhook{URL: wv.URL, Secret: wv.Secret}
+	for _, event := range wv.Events {
+		webhook.Events = append(webhook.Events, service.NodeWatchEventType(event))
+	}
+	return webhook
+}
+
+func toWebhookView(webhook service.Webhook) webhookView {
+	view := webhookView{
+		ID:        webhook.ID,
+		URL:       webhook.URL,
+		Events:    make([]string, 0, len(webhook.Events)),
+		CreatedAt: formatTime(webhook.CreatedAt),
+	}
+	for _, event := range webhook.Events {
+		view.Events = append(view.Events, string(event))
+	}
+	return view
+}
+
+func toWebhookViewList(webhooks []service.Webhook) webhookViewList {
+	view := webhookViewList{Webhooks: make([]webhookView, 0, len(webhooks))}
+	for _, webhook := range webhooks {
+		view.Webhooks = append(view.Webhooks, toWebhookView(webhook))
+	}
+	return view
+}
+
+func toWebhookViewDeliveryList(deliveries []service.WebhookDelivery) webhookViewDeliveryList {
+	view := webhookViewDeliveryList{
+		Deliveries: make([]webhookViewDelivery, 0, len(deliveries)),
+	}
+	for _, delivery := range deliveries {
+		var nextAttemptAt string
+		if delivery.Status == service.WebhookDeliveryStatusPending {
+			nextAttemptAt = formatTime(delivery.NextAttemptAt)
+		}
+		view.Deliveries = append(view.Deliveries, webhookViewDelivery{
+			ID:            delivery.ID,
+			Event:         string(delivery.Event),
+			NodeID:        delivery.NodeID,
+			Status:        string(delivery.Status),
+			Attempts:      delivery.Attempts,
+			NextAttemptAt: nextAttemptAt,
+			LastStatus:    delivery.LastStatus,
+			LastError:     delivery.LastError,
+			Payload:       json.RawMessage(delivery.Payload),
+			CreatedAt:     formatTime(delivery.CreatedAt),
+			UpdatedAt:     formatTime(delivery.UpdatedAt),
+		})
+	}
+	return view
+}
@@ -18,6 +18,9 @@ type ServerConfig struct {
 	Port    uint
 	Handler struct {
 		Node    handler.Node
+		Event   handler.Event
+		Cluster handler.Cluster
+		Webhook handler.Webhook
 		Invalid handler.Invalid
 	}
 	AsyncErrorHandler func(error)
@@ -38,21 +41,58 @@ func (s *Server) Init() error {
 
 	writer := shared.Writer{Logger: s.Config.Handler.Node.Writer.Logger}
 	s.Config.Handler.Node.Writer = writer
+	s.Config.Handler.Event.Writer = writer
+	s.Config.Handler.Cluster.Writer = writer
+	s.Config.Handler.Webhook.Writer = writer
 	s.Config.Handler.Invalid.Writer = writer
 
 	if err := s.Config.Handler.Node.Init(); err != nil {
 		return fmt.Errorf("node handler initialization error: %w", err)
 	}
+	if err := s.Config.Handler.Event.Init(); err != nil {
+		return fmt.Errorf("event handler initialization error: %w", err)
+	}
+	if err := s.Config.Handler.Cluster.Init(); err != nil {
+		return fmt.Errorf("cluster handler initialization error: %w", err)
+	}
+	if err := s.Config.Handler.Webhook.Init(); err != nil {
+		return fmt.Errorf("webhook handler initialization error: %w", err)
+	}
 	return nil
 }
 
+// Address return the base address used to reach the server.
+func (s *Server) Address() string {
+	return fmt.Sprintf("http://%s:%d", s.Config.Address, s.Config.Port)
+}
+
 // Start the server.
 func (s *Server) Start() {
 	r := chi.NewRouter()
 	r.Use(middleware.Logger(s.Config.Logger))
+	r.Use(middleware.Actor)
 	r.Get("/nodes", s.Config.Handler.Node.Index)
+	r.Get("/nodes/watch", s.Config.Handler.Node.Watch)
 	r.Get("/nodes/{id}", s.Config.Handler.Node.Show)
 	r.Post("/nodes", s.Config.Handler.Node.Create)
+	r.Patch("/nodes/{id}", s.Config.Handler.Node.Update)
+	r.Post("/nodes/{id}/heartbeat", s.Config.Handler.Node.Heartbeat)
+	r.Get("/nodes/{id}/checks", s.Config.Handler.Node.Checks)
+	r.Get("/nodes/{id}/observations", s.Config.Handler.Node.Observations)
+	r.Get("/nodes/{id}/status", s.Config.Handler.Node.Status)
+	r.Post("/nodes/{id}/status", s.Config.Handler.Node.ReportStatus)
+	r.Get("/nodes/{id}/events", s.Config.Handler.Event.NodeIndex)
+	r.Get("/nodes/{id}/allocations", s.Config.Handler.Node.Allocations)
+	r.Post("/nodes/{id}/allocations", s.Config.Handler.Node.Allocate)
+	r.Delete("/nodes/{id}/allocations/{allocation}", s.Config.Handler.Node.Release)
+	r.Delete("/nodes/{id}", s.Config.Handler.Node.Delete)
+	r.Get("/events", s.Config.Handler.Event.Index)
+	r.Get("/cluster/capacity", s.Config.Handler.Cluster.Capacity)
+	r.Get("/webhooks", s.Config.Handler.Webhook.Index)
+	r.Get("/webhooks/{id}", s.Config.Handler.Webhook.Show)
+	r.Post("/webhooks", s.Config.Handler.Webhook.Create)
+	r.Delete("/webhooks/{id}", s.Config.Handler.Webhook.Delete)
+	r.Get("/webhooks/{id}/deliveries", s.Config.Handler.Webhook.Deliveries)
 	r.NotFound(s.Config.Handler.Invalid.NotFound)
 	r.MethodNotAllowed(s.Config.Handler.Invalid.MethodNotAllowed)
 	s.instance.Handler = r
@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+
+	"malta/internal/service"
+)
+
+// Actor records the caller at the context, this way the changes made by the request are attributed
+// to it at the audit history of the nodes.
+func Actor(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		actor := service.NodeAuditActor{Kind: service.NodeAuditActorKindAPI, ID: r.RemoteAddr}
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			actor.ID = host
+		}
+		next.ServeHTTP(w, r.WithContext(service.WithNodeAuditActor(r.Context(), actor)))
+	}
+	return http.HandlerFunc(fn)
+}
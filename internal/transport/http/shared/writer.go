@@ -2,6 +2,7 @@ package shared
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/rs/zerolog"
@@ -68,7 +69,8 @@ func (wrt Writer) Error(w http.ResponseWriter, title string, err error, status i
 	if title != "" {
 		resp.Error.Title = title
 	}
-	if serr, ok := err.(sourceError); ok {
+	var serr sourceError
+	if errors.As(err, &serr) {
 		resp.Error.Source = serr.FieldErrors()
 	}
 	wrt.Response(w, &resp, status, nil)